@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/davidcharbonnier/alacarte-api/services"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ConsistencyCheck reports items whose field_values JSON and EAV rows disagree,
+// EAV rows left by deleted fields, and values the current schema refuses
+func ConsistencyCheck(c *gin.Context) {
+	runConsistencyCheck(c, services.ConsistencyOptions{})
+}
+
+// ConsistencyRepair checks items like ConsistencyCheck, and rebuilds the copy of
+// their field values that disagrees from the one named by ?source
+func ConsistencyRepair(c *gin.Context) {
+	source := c.Query("source")
+	if source == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source is required; use eav or json"})
+		return
+	}
+	runConsistencyCheck(c, services.ConsistencyOptions{Repair: source, UserID: utils.GetCurrentUserID(c)})
+}
+
+func runConsistencyCheck(c *gin.Context, opts services.ConsistencyOptions) {
+	report, err := queryBuilder.CheckConsistency(c.Query("schema"), opts)
+	if err != nil {
+		switch {
+		case strings.HasPrefix(err.Error(), "invalid repair source"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case strings.HasSuffix(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
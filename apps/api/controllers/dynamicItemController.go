@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -34,15 +37,54 @@ func DynamicItemList(c *gin.Context) {
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	params := listQueryParams(c, schemaType)
+	params.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	params.PerPage, _ = strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	params.Facets = parseCSVParam(c.Query("facets"))
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		params.UseCursor = true
+		params.Cursor = cursor
+	}
+
+	result, err := queryBuilder.BuildListQuery(params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := queryBuilder.ShapeItems(schemaType, result.Items, itemResponseOptions(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"items":    result.Items,
+		"total":    result.Total,
+		"per_page": result.PerPage,
+	}
+	if params.UseCursor {
+		response["next_cursor"] = result.NextCursor
+		response["has_more"] = result.HasMore
+	} else {
+		response["page"] = result.Page
+		response["total_pages"] = result.TotalPages
+	}
+	if result.Facets != nil {
+		response["facets"] = result.Facets
+	}
+
+	c.JSON(http.StatusOK, response)
+}
 
+// listQueryParams reads the sort, search and filter parameters shared by item
+// listing and export
+func listQueryParams(c *gin.Context, schemaType string) services.QueryParams {
 	params := services.QueryParams{
 		SchemaName: schemaType,
-		Page:       page,
-		PerPage:    perPage,
 		Sort:       c.Query("sort"),
 		Search:     c.Query("search"),
+		ViewerID:   utils.GetCurrentUserID(c),
 	}
 
 	// Parse filter parameters from query string
@@ -63,19 +105,76 @@ func DynamicItemList(c *gin.Context) {
 		}
 	}
 
-	result, err := queryBuilder.BuildListQuery(params)
+	return params
+}
+
+// DynamicItemExport streams every item matching the list filters as CSV, NDJSON
+// or XLSX. With include=my_rating the current user's grade and note are added.
+func DynamicItemExport(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	cached, ok := getOrRefreshSchema(schemaType)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
+		return
+	}
+
+	format := c.DefaultQuery("format", services.ExportFormatCSV)
+	switch format {
+	case services.ExportFormatCSV, services.ExportFormatNDJSON, services.ExportFormatXLSX:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format; use csv, ndjson or xlsx"})
+		return
+	}
+
+	includeRatings := false
+	for _, include := range parseCSVParam(c.Query("include")) {
+		if include != services.IncludeMyRating {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown include '%s'", include)})
+			return
+		}
+		includeRatings = true
+	}
+
+	columns, err := queryBuilder.ExportColumns(schemaType, includeRatings)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"items":       result.Items,
-		"total":       result.Total,
-		"page":        result.Page,
-		"per_page":    result.PerPage,
-		"total_pages": result.TotalPages,
+	c.Header("Content-Type", services.ExportContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, schemaType, format))
+	c.Status(http.StatusOK)
+
+	writer, err := services.NewExportWriter(format, c.Writer, cached.Schema.DisplayName, columns)
+	if err != nil {
+		log.Printf("WARNING: failed to start %s export: %v", schemaType, err)
+		return
+	}
+
+	// Rows are flushed as they are written so the response streams. Errors after
+	// this point can only cut the file short, as the status is already sent.
+	rows := 0
+	err = queryBuilder.ExportItems(listQueryParams(c, schemaType), includeRatings, func(item map[string]interface{}) error {
+		if err := writer.Write(item); err != nil {
+			return err
+		}
+		if rows++; rows%100 == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
 	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Printf("WARNING: %s export failed after %d rows: %v", schemaType, rows, err)
+		return
+	}
+	c.Writer.Flush()
 }
 
 func DynamicItemDetails(c *gin.Context) {
@@ -90,11 +189,114 @@ func DynamicItemDetails(c *gin.Context) {
 
 	item, err := queryBuilder.GetItem(schemaType, uint(id))
 	if err != nil {
+		// Merged items redirect to the item they were merged into
+		if targetID, ok := queryBuilder.ResolveRedirect(schemaType, uint(id)); ok {
+			location := fmt.Sprintf("/api/items/%s/%d", schemaType, targetID)
+			if c.Request.URL.RawQuery != "" {
+				location += "?" + c.Request.URL.RawQuery
+			}
+			c.Redirect(http.StatusMovedPermanently, location)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	shaped := []map[string]interface{}{*item}
+	if err := queryBuilder.ShapeItems(schemaType, shaped, itemResponseOptions(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setItemETag(c, *item)
+	c.JSON(http.StatusOK, shaped[0])
+}
+
+// itemETag is the entity tag of an item at a given version
+func itemETag(id uint, version uint) string {
+	return fmt.Sprintf(`"%d-%d"`, id, version)
+}
+
+func setItemETag(c *gin.Context, item map[string]interface{}) {
+	id, _ := item["id"].(uint)
+	version, _ := item["version"].(uint)
+	c.Header("ETag", itemETag(id, version))
+}
+
+// ifMatchVersion reads the item version expected by an If-Match header. It
+// returns nil when there is no precondition. A tag for another item or in an
+// unknown format yields version 0, which never matches.
+func ifMatchVersion(c *gin.Context, id uint) *uint {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	var expected uint
+	tag := strings.TrimSpace(strings.Split(header, ",")[0])
+	tag = strings.Trim(strings.TrimPrefix(tag, "W/"), `"`)
+	if itemID, version, found := strings.Cut(tag, "-"); found {
+		parsedID, idErr := strconv.ParseUint(itemID, 10, 32)
+		parsedVersion, versionErr := strconv.ParseUint(version, 10, 32)
+		if idErr == nil && versionErr == nil && uint(parsedID) == id {
+			expected = uint(parsedVersion)
+		}
+	}
+	return &expected
+}
+
+// respondVersionConflict answers a failed precondition with the item's current
+// state, so the client can merge its changes and retry
+func respondVersionConflict(c *gin.Context, schemaType string, id uint) {
+	current, err := queryBuilder.GetItem(schemaType, id)
+	if err != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "version_conflict"})
+		return
+	}
+
+	setItemETag(c, *current)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   "version_conflict",
+		"message": "The item was modified since it was last fetched",
+		"current": current,
+	})
+}
+
+// itemResponseOptions reads the ?fields= projection and ?include= expansions
+func itemResponseOptions(c *gin.Context) services.ItemResponseOptions {
+	return services.ItemResponseOptions{
+		Fields:   parseCSVParam(c.Query("fields")),
+		Include:  parseCSVParam(c.Query("include")),
+		ViewerID: utils.GetCurrentUserID(c),
+	}
+}
+
+func DynamicItemFieldSuggest(c *gin.Context) {
+	schemaType := c.Param("type")
+	fieldKey := c.Param("key")
+
+	if _, ok := getOrRefreshSchema(schemaType); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	suggestions, err := queryBuilder.SuggestFieldValues(schemaType, fieldKey, c.Query("prefix"), limit)
+	if err != nil {
+		if errors.Is(err, services.ErrFieldNotSuggestible) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Field does not support suggestions"})
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, item)
+	c.Header("Cache-Control", "private, max-age=60")
+	c.JSON(http.StatusOK, gin.H{
+		"field":       fieldKey,
+		"suggestions": suggestions,
+	})
 }
 
 func DynamicItemCreate(c *gin.Context) {
@@ -198,10 +400,22 @@ func DynamicItemUpdate(c *gin.Context) {
 		return
 	}
 
-	item, err := queryBuilder.UpdateItem(schemaType, uint(id), userID, fields)
+	isAdmin := false
+	if user, _ := utils.GetCurrentUser(c); user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	item, err := queryBuilder.UpdateItemWithOptions(schemaType, uint(id), userID, fields, services.UpdateOptions{
+		IsAdmin:         isAdmin,
+		ExpectedVersion: ifMatchVersion(c, uint(id)),
+	})
 	if err != nil {
 		if err.Error() == "unauthorized" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own items"})
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only update items you own or have edit rights on"})
+			return
+		}
+		if err.Error() == "version conflict" {
+			respondVersionConflict(c, schemaType, uint(id))
 			return
 		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -213,17 +427,20 @@ func DynamicItemUpdate(c *gin.Context) {
 		log.Printf("WARNING: failed to fetch item %d after update: %v", item.ID, err)
 	}
 	if updatedItem != nil {
+		setItemETag(c, *updatedItem)
 		c.JSON(http.StatusOK, updatedItem)
 	} else {
 		c.JSON(http.StatusOK, item)
 	}
 }
 
-func DynamicItemDelete(c *gin.Context) {
+// DynamicItemPatch applies an RFC 7396 merge patch or an RFC 6902 JSON Patch to
+// an item's field values, addressed by field key (e.g. "/origin"). The full
+// post-patch state is validated before it is stored.
+func DynamicItemPatch(c *gin.Context) {
 	schemaType := c.Param("type")
-	idStr := c.Param("id")
 
-	id, err := strconv.ParseUint(idStr, 10, 32)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
 		return
@@ -235,25 +452,119 @@ func DynamicItemDelete(c *gin.Context) {
 		return
 	}
 
-	user, _ := utils.GetCurrentUser(c)
+	data, err := c.GetRawData()
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	isJSONPatch := false
+	switch c.ContentType() {
+	case "application/json-patch+json":
+		isJSONPatch = true
+	case "application/merge-patch+json":
+	case "application/json", "":
+		// Plain JSON is read as a JSON Patch when it is an array of operations
+		isJSONPatch = bytes.TrimSpace(data)[0] == '['
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Use application/merge-patch+json or application/json-patch+json"})
+		return
+	}
+
+	current, version, err := queryBuilder.GetItemFieldValues(schemaType, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var patched interface{}
+	if isJSONPatch {
+		ops, err := services.ParseJSONPatch(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		patched, err = services.ApplyJSONPatch(current, ops)
+		if err != nil {
+			if err.Error() == "patch test failed" {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		var patch interface{}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merge patch document"})
+			return
+		}
+		patched = services.ApplyMergePatch(current, patch)
+	}
+
+	patchedFields, ok := patched.(map[string]interface{})
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Patched item must be a JSON object"})
+		return
+	}
+	state := make(map[string]interface{}, len(patchedFields))
+	for key, value := range patchedFields {
+		if value != nil {
+			state[key] = value
+		}
+	}
+
+	validationResult := validationEngine.ValidateCreate(schemaType, state)
+	if !validationResult.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "validation_failed",
+			"errors": validationResult.Errors,
+		})
+		return
+	}
+
+	// The patch was computed against the version just read, so it only applies
+	// on top of that version even without If-Match
+	expected := ifMatchVersion(c, uint(id))
+	if expected == nil {
+		expected = &version
+	}
+
 	isAdmin := false
-	if user != nil {
+	if user, _ := utils.GetCurrentUser(c); user != nil {
 		isAdmin = utils.IsUserAdmin(user)
 	}
 
-	if err := queryBuilder.DeleteItem(schemaType, uint(id), userID, isAdmin); err != nil {
+	item, err := queryBuilder.UpdateItemWithOptions(schemaType, uint(id), userID, services.ReplacementUpdates(current, state), services.UpdateOptions{
+		IsAdmin:         isAdmin,
+		ExpectedVersion: expected,
+	})
+	if err != nil {
 		if err.Error() == "unauthorized" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own items"})
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only update items you own or have edit rights on"})
+			return
+		}
+		if err.Error() == "version conflict" {
+			respondVersionConflict(c, schemaType, uint(id))
 			return
 		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Item deleted successfully"})
+	patchedItem, err := queryBuilder.GetItem(schemaType, item.ID)
+	if err != nil {
+		log.Printf("WARNING: failed to fetch item %d after patch: %v", item.ID, err)
+	}
+	if patchedItem != nil {
+		setItemETag(c, *patchedItem)
+		c.JSON(http.StatusOK, patchedItem)
+	} else {
+		c.JSON(http.StatusOK, item)
+	}
 }
 
-func DynamicItemUploadImage(c *gin.Context) {
+func DynamicItemDelete(c *gin.Context) {
 	schemaType := c.Param("type")
 	idStr := c.Param("id")
 
@@ -269,29 +580,28 @@ func DynamicItemUploadImage(c *gin.Context) {
 		return
 	}
 
-	item, err := utils.GetDynamicItem(schemaType, uint(id))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
-		return
+	user, _ := utils.GetCurrentUser(c)
+	isAdmin := false
+	if user != nil {
+		isAdmin = utils.IsUserAdmin(user)
 	}
 
-	if uint(item.UserID) != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage images for your own items"})
+	if err := queryBuilder.DeleteItem(schemaType, uint(id), userID, isAdmin); err != nil {
+		if err.Error() == "unauthorized" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete items you own or have edit rights on"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	processAndSaveImage(c, item, schemaType)
+	c.JSON(http.StatusOK, gin.H{"message": "Item deleted successfully"})
 }
 
-func DynamicItemDeleteImage(c *gin.Context) {
+// DynamicItemBatch applies a list of create, update and delete operations in one
+// transaction, either atomically or best effort, reporting a result per operation
+func DynamicItemBatch(c *gin.Context) {
 	schemaType := c.Param("type")
-	idStr := c.Param("id")
-
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
-		return
-	}
 
 	userID := utils.GetCurrentUserID(c)
 	if userID == 0 {
@@ -299,149 +609,1015 @@ func DynamicItemDeleteImage(c *gin.Context) {
 		return
 	}
 
-	item, err := utils.GetDynamicItem(schemaType, uint(id))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+	cached, ok := getOrRefreshSchema(schemaType)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
 		return
 	}
 
-	if uint(item.UserID) != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage images for your own items"})
+	if !cached.Schema.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Schema is not active"})
 		return
 	}
 
-	// Delete image from storage
-	imageURL := item.GetImageURL()
-	if imageURL == nil || *imageURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Item has no image"})
+	var body struct {
+		Mode       string                    `json:"mode"`
+		Operations []services.BatchOperation `json:"operations"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	filename := (*imageURL)[strings.LastIndex(*imageURL, "/")+1:]
-	if err := utils.DeleteFromStorage(filename); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+	if body.Mode == "" {
+		body.Mode = services.BatchModeAtomic
+	}
+	if body.Mode != services.BatchModeAtomic && body.Mode != services.BatchModeBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be 'atomic' or 'best_effort'"})
 		return
 	}
 
-	// Clear image URL in database
-	item.SetImageURL(nil)
-	if err := utils.SaveItem(item); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update database"})
+	if len(body.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "operations is required"})
+		return
+	}
+	if len(body.Operations) > services.MaxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A batch may contain at most %d operations", services.MaxBatchOperations)})
+		return
+	}
+
+	user, _ := utils.GetCurrentUser(c)
+	isAdmin := false
+	if user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	result, err := queryBuilder.ExecuteBatch(validationEngine, schemaType, userID, isAdmin, body.Operations, body.Mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
+	if !result.Committed {
+		c.JSON(http.StatusBadRequest, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
 }
 
-func DynamicItemDeleteImpact(c *gin.Context) {
+func DynamicItemHistory(c *gin.Context) {
 	schemaType := c.Param("type")
-	idStr := c.Param("id")
 
-	id, err := strconv.ParseUint(idStr, 10, 32)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
 		return
 	}
 
-	impact, err := queryBuilder.GetDeleteImpact(schemaType, uint(id))
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	history, err := queryBuilder.GetItemHistory(schemaType, uint(id), page, perPage)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, impact)
+	c.JSON(http.StatusOK, gin.H{
+		"item_id":     id,
+		"revisions":   history.Revisions,
+		"total":       history.Total,
+		"page":        history.Page,
+		"per_page":    history.PerPage,
+		"total_pages": history.TotalPages,
+	})
 }
 
-func DynamicItemSeed(c *gin.Context) {
+func DynamicItemRevert(c *gin.Context) {
 	schemaType := c.Param("type")
 
-	cached, ok := getOrRefreshSchema(schemaType)
-	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
 		return
 	}
 
-	data, err := utils.GetSeedData(c)
+	revisionID, err := strconv.ParseUint(c.Param("revision"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision ID"})
 		return
 	}
 
-	var rawData map[string]interface{}
-	if err := json.Unmarshal(data, &rawData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid JSON format: %v", err)})
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 		return
 	}
 
-	var items []map[string]interface{}
-
-	if itemsData, ok := rawData["items"].([]interface{}); ok {
-		for _, item := range itemsData {
-			if itemMap, ok := item.(map[string]interface{}); ok {
-				items = append(items, itemMap)
-			}
+	user, _ := utils.GetCurrentUser(c)
+	isAdmin := false
+	if user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	state, updates, err := queryBuilder.RevertFields(schemaType, uint(id), uint(revisionID), userID, isAdmin)
+	if err != nil {
+		if err.Error() == "unauthorized" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only revert items you own or have edit rights on"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The reverted state must still satisfy the current schema
+	validationResult := validationEngine.ValidateCreate(schemaType, state)
+	if !validationResult.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "validation_failed",
+			"errors": validationResult.Errors,
+		})
+		return
+	}
+
+	item, err := queryBuilder.UpdateItemWithOptions(schemaType, uint(id), userID, updates, services.UpdateOptions{
+		Action:          models.RevisionActionRevert,
+		IsAdmin:         isAdmin,
+		ExpectedVersion: ifMatchVersion(c, uint(id)),
+	})
+	if err != nil {
+		if err.Error() == "unauthorized" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only revert items you own or have edit rights on"})
+			return
+		}
+		if err.Error() == "version conflict" {
+			respondVersionConflict(c, schemaType, uint(id))
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	revertedItem, err := queryBuilder.GetItem(schemaType, item.ID)
+	if err != nil {
+		log.Printf("WARNING: failed to fetch item %d after revert: %v", item.ID, err)
+	}
+	if revertedItem != nil {
+		setItemETag(c, *revertedItem)
+		c.JSON(http.StatusOK, revertedItem)
+	} else {
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// DynamicItemTrash lists the trashed items of a schema: all of them for admins,
+// the caller's own for everyone else
+func DynamicItemTrash(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	params := services.TrashParams{SchemaName: schemaType, OwnerID: userID}
+	params.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	params.PerPage, _ = strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	if user, _ := utils.GetCurrentUser(c); user != nil && utils.IsUserAdmin(user) {
+		params.OwnerID = 0
+	}
+
+	respondTrash(c, params)
+}
+
+func respondTrash(c *gin.Context, params services.TrashParams) {
+	result, err := queryBuilder.ListTrash(params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":       result.Items,
+		"total":       result.Total,
+		"page":        result.Page,
+		"per_page":    result.PerPage,
+		"total_pages": result.TotalPages,
+	})
+}
+
+// DynamicItemRestore brings an item back from the trash
+func DynamicItemRestore(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	user, _ := utils.GetCurrentUser(c)
+	isAdmin := false
+	if user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	item, err := queryBuilder.RestoreItem(schemaType, uint(id), userID, isAdmin)
+	if err != nil {
+		switch err.Error() {
+		case "unauthorized":
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only restore items you own or have edit rights on"})
+		case "item not found in trash":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case "duplicate item":
+			c.JSON(http.StatusConflict, gin.H{"error": "duplicate item", "message": "Another item now has the same unique values; rename it before restoring this one"})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	restoredItem, err := queryBuilder.GetItem(schemaType, item.ID)
+	if err != nil {
+		log.Printf("WARNING: failed to fetch item %d after restore: %v", item.ID, err)
+	}
+	if restoredItem != nil {
+		setItemETag(c, *restoredItem)
+		c.JSON(http.StatusOK, restoredItem)
+	} else {
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+func DynamicItemUploadImage(c *gin.Context) {
+	schemaType := c.Param("type")
+	idStr := c.Param("id")
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	item, err := utils.GetDynamicItem(schemaType, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	isAdmin := false
+	if user, _ := utils.GetCurrentUser(c); user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	allowed, err := services.CanEdit(utils.DB, item, userID, isAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check edit rights"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage images for items you own or have edit rights on"})
+		return
+	}
+
+	if expected := ifMatchVersion(c, uint(id)); expected != nil && *expected != item.Version {
+		respondVersionConflict(c, schemaType, uint(id))
+		return
+	}
+
+	processAndSaveImage(c, item, schemaType)
+}
+
+func DynamicItemDeleteImage(c *gin.Context) {
+	schemaType := c.Param("type")
+	idStr := c.Param("id")
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	item, err := utils.GetDynamicItem(schemaType, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	isAdmin := false
+	if user, _ := utils.GetCurrentUser(c); user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	allowed, err := services.CanEdit(utils.DB, item, userID, isAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check edit rights"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage images for items you own or have edit rights on"})
+		return
+	}
+
+	if expected := ifMatchVersion(c, uint(id)); expected != nil && *expected != item.Version {
+		respondVersionConflict(c, schemaType, uint(id))
+		return
+	}
+
+	imageURL := item.GetImageURL()
+	if imageURL == nil || *imageURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Item has no image"})
+		return
+	}
+
+	// Clear image URL in database first, so a conflicting write leaves the image in place
+	item.SetImageURL(nil)
+	if err := utils.SaveItem(item); err != nil {
+		if err.Error() == "version conflict" {
+			respondVersionConflict(c, schemaType, uint(id))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update database"})
+		return
+	}
+
+	// Delete image from storage
+	filename := (*imageURL)[strings.LastIndex(*imageURL, "/")+1:]
+	if err := utils.DeleteFromStorage(filename); err != nil {
+		log.Printf("WARNING: failed to delete image of item %d: %v", item.ID, err)
+	}
+
+	c.Header("ETag", itemETag(item.ID, item.Version))
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully", "version": item.Version})
+}
+
+func DynamicItemDeleteImpact(c *gin.Context) {
+	schemaType := c.Param("type")
+	idStr := c.Param("id")
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	impact, err := queryBuilder.GetDeleteImpact(schemaType, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, impact)
+}
+
+// DynamicItemPurge permanently deletes a trashed item (admin only)
+func DynamicItemPurge(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	result, err := queryBuilder.PurgeItem(schemaType, uint(id))
+	if err != nil {
+		if err.Error() == "item not found in trash" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The rows are gone, so a failed storage delete only leaves an orphaned file
+	for _, imageURL := range result.ImageURLs {
+		if err := utils.DeleteImageURLFromStorage(imageURL); err != nil {
+			log.Printf("WARNING: failed to delete image of purged item %d: %v", id, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item permanently deleted"})
+}
+
+// DynamicItemDuplicates lists clusters of likely duplicate items (admin only)
+func DynamicItemDuplicates(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	threshold := services.DefaultDuplicateThreshold
+	if value := c.Query("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a number between 0 and 1"})
+			return
+		}
+		threshold = parsed
+	}
+
+	clusters, err := queryBuilder.FindDuplicates(schemaType, threshold)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"threshold": threshold,
+		"clusters":  clusters,
+		"total":     len(clusters),
+	})
+}
+
+// DynamicItemMerge merges duplicate items into a canonical one (admin only)
+func DynamicItemMerge(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	var body struct {
+		CanonicalID  uint                   `json:"canonical_id" binding:"required"`
+		DuplicateIDs []uint                 `json:"duplicate_ids" binding:"required"`
+		Fields       map[string]interface{} `json:"fields"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "canonical_id and duplicate_ids are required"})
+		return
+	}
+
+	state, err := queryBuilder.MergedFieldValues(schemaType, body.CanonicalID, body.DuplicateIDs, body.Fields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	validationResult := validationEngine.ValidateCreate(schemaType, state)
+	if !validationResult.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "validation_failed",
+			"errors": validationResult.Errors,
+		})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	result, err := queryBuilder.MergeItems(schemaType, body.CanonicalID, body.DuplicateIDs, state, userID, ifMatchVersion(c, body.CanonicalID))
+	if err != nil {
+		if err.Error() == "version conflict" {
+			respondVersionConflict(c, schemaType, body.CanonicalID)
+			return
+		}
+		if err.Error() == "duplicate item" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mergedItem, err := queryBuilder.GetItem(schemaType, result.Item.ID)
+	if err != nil {
+		log.Printf("WARNING: failed to fetch item %d after merge: %v", result.Item.ID, err)
+		c.JSON(http.StatusOK, gin.H{"item": result.Item, "merged_ids": result.MergedIDs})
+		return
+	}
+
+	setItemETag(c, *mergedItem)
+	c.JSON(http.StatusOK, gin.H{
+		"item":             mergedItem,
+		"merged_ids":       result.MergedIDs,
+		"ratings_moved":    result.RatingsMoved,
+		"ratings_combined": result.RatingsCombined,
+	})
+}
+
+// DynamicItemEditors lists the users who may edit an item besides its owner
+func DynamicItemEditors(c *gin.Context) {
+	id, userID, isAdmin, ok := editorRequest(c)
+	if !ok {
+		return
+	}
+
+	editors, err := queryBuilder.ListEditors(c.Param("type"), id, userID, isAdmin)
+	if err != nil {
+		respondEditorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"editors": editors})
+}
+
+// DynamicItemGrantEditor lets another user edit the item. Only the owner or an
+// admin can grant edit rights.
+func DynamicItemGrantEditor(c *gin.Context) {
+	id, userID, isAdmin, ok := editorRequest(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	if err := queryBuilder.GrantEditor(c.Param("type"), id, userID, isAdmin, body.UserID); err != nil {
+		respondEditorError(c, err)
+		return
+	}
+
+	editors, err := queryBuilder.ListEditors(c.Param("type"), id, userID, isAdmin)
+	if err != nil {
+		respondEditorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"editors": editors})
+}
+
+// DynamicItemRevokeEditor removes a user's edit rights. Editors can also remove
+// their own.
+func DynamicItemRevokeEditor(c *gin.Context) {
+	id, userID, isAdmin, ok := editorRequest(c)
+	if !ok {
+		return
+	}
+
+	editorID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := queryBuilder.RevokeEditor(c.Param("type"), id, userID, isAdmin, uint(editorID)); err != nil {
+		respondEditorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Edit rights revoked"})
+}
+
+// editorRequest reads the item ID and the current user, writing the error
+// response itself when either is missing
+func editorRequest(c *gin.Context) (uint, uint, bool, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return 0, 0, false, false
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return 0, 0, false, false
+	}
+
+	isAdmin := false
+	if user, _ := utils.GetCurrentUser(c); user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	return uint(id), userID, isAdmin, true
+}
+
+func respondEditorError(c *gin.Context, err error) {
+	switch msg := err.Error(); msg {
+	case "unauthorized":
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the item owner or an admin can manage editors"})
+	case "item not found", "user not found", "editor not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	}
+}
+
+// DynamicItemTransfer offers the item to another user, who becomes its owner
+// once they accept
+func DynamicItemTransfer(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var body struct {
+		UserID  uint   `json:"user_id" binding:"required"`
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	transfer, err := queryBuilder.RequestTransfer(schemaType, uint(id), userID, body.UserID, body.Message)
+	if err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// DynamicItemReassign gives an item to another user right away (admin only)
+func DynamicItemReassign(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var body struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	item, err := queryBuilder.ReassignItem(schemaType, uint(id), body.UserID, utils.GetCurrentUserID(c))
+	if err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	reassignedItem, err := queryBuilder.GetItem(schemaType, item.ID)
+	if err != nil {
+		log.Printf("WARNING: failed to fetch item %d after reassignment: %v", item.ID, err)
+	}
+	if reassignedItem != nil {
+		setItemETag(c, *reassignedItem)
+		c.JSON(http.StatusOK, reassignedItem)
+	} else {
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+func respondTransferError(c *gin.Context, err error) {
+	switch msg := err.Error(); {
+	case msg == "unauthorized":
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to act on this transfer"})
+	case msg == "item not found" || msg == "user not found" || msg == "transfer not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	case msg == "a transfer is already pending for this item" || msg == "transfer is no longer pending" ||
+		strings.HasPrefix(msg, "transfer is already") || strings.HasPrefix(msg, "the item changed owner"):
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	}
+}
+
+// DynamicItemSuggest records a suggested edit to someone else's item. The item
+// with the changes applied must pass validation, as an update by its owner would.
+func DynamicItemSuggest(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var body struct {
+		Changes map[string]interface{} `json:"changes" binding:"required"`
+		Message string                 `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.Changes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "changes are required"})
+		return
+	}
+
+	state, err := queryBuilder.SuggestionState(schemaType, uint(id), body.Changes)
+	if err != nil {
+		respondSuggestionError(c, err)
+		return
+	}
+
+	validationResult := validationEngine.ValidateCreate(schemaType, state)
+	if !validationResult.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "validation_failed",
+			"errors": validationResult.Errors,
+		})
+		return
+	}
+
+	suggestion, err := queryBuilder.SubmitSuggestion(schemaType, uint(id), userID, body.Changes, body.Message)
+	if err != nil {
+		respondSuggestionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, suggestion)
+}
+
+// DynamicItemSuggestions lists the suggestions made on one item, or with no item
+// the review queue: suggestions on the current user's items, or every item for
+// admins. Filter with ?status=pending|accepted|rejected.
+func DynamicItemSuggestions(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	params := services.SuggestionParams{
+		SchemaName: schemaType,
+		Status:     models.SuggestionStatus(c.Query("status")),
+	}
+	params.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	params.PerPage, _ = strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	isAdmin := false
+	if user, _ := utils.GetCurrentUser(c); user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	if idStr := c.Param("id"); idStr != "" {
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+			return
+		}
+		params.ItemID = uint(id)
+		if !isAdmin {
+			params.ViewerID = userID
+		}
+	} else if !isAdmin {
+		params.OwnerID = userID
+	}
+
+	respondSuggestions(c, params)
+}
+
+func respondSuggestions(c *gin.Context, params services.SuggestionParams) {
+	result, err := queryBuilder.ListSuggestions(params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if len(items) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No items to seed"})
+	c.JSON(http.StatusOK, gin.H{
+		"suggestions": result.Suggestions,
+		"total":       result.Total,
+		"page":        result.Page,
+		"per_page":    result.PerPage,
+		"total_pages": result.TotalPages,
+	})
+}
+
+// DynamicItemSuggestion returns a suggestion with its discussion
+func DynamicItemSuggestion(c *gin.Context) {
+	suggestionID, userID, isAdmin, ok := suggestionRequest(c)
+	if !ok {
+		return
+	}
+
+	suggestion, err := queryBuilder.GetSuggestion(c.Param("type"), suggestionID, userID, isAdmin)
+	if err != nil {
+		respondSuggestionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, suggestion)
+}
+
+// DynamicItemAcceptSuggestion applies a pending suggestion to the item. The item
+// owner or an admin reviews it; the change is checked again against the item as
+// it is now, since it may have moved on since the suggestion was made, and is
+// refused only when one of its fields was edited in the meantime.
+func DynamicItemAcceptSuggestion(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	suggestionID, userID, isAdmin, ok := suggestionRequest(c)
+	if !ok {
+		return
+	}
+
+	item, validationResult, err := queryBuilder.AcceptSuggestion(validationEngine, schemaType, suggestionID, userID, isAdmin)
+	if err != nil {
+		respondSuggestionError(c, err)
+		return
+	}
+	if validationResult != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "validation_failed",
+			"errors": validationResult.Errors,
+		})
+		return
+	}
+
+	updatedItem, err := queryBuilder.GetItem(schemaType, item.ID)
+	if err != nil {
+		log.Printf("WARNING: failed to fetch item %d after accepting suggestion: %v", item.ID, err)
+	}
+	if updatedItem != nil {
+		setItemETag(c, *updatedItem)
+		c.JSON(http.StatusOK, updatedItem)
+	} else {
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// DynamicItemRejectSuggestion closes a pending suggestion, with an optional reason
+func DynamicItemRejectSuggestion(c *gin.Context) {
+	suggestionID, userID, isAdmin, ok := suggestionRequest(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	c.ShouldBindJSON(&body)
+
+	if err := queryBuilder.RejectSuggestion(c.Param("type"), suggestionID, userID, isAdmin, body.Reason); err != nil {
+		respondSuggestionError(c, err)
+		return
+	}
+
+	suggestion, err := queryBuilder.GetSuggestion(c.Param("type"), suggestionID, userID, isAdmin)
+	if err != nil {
+		respondSuggestionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, suggestion)
+}
+
+// DynamicItemCommentSuggestion adds a comment to a suggestion's discussion
+func DynamicItemCommentSuggestion(c *gin.Context) {
+	suggestionID, userID, isAdmin, ok := suggestionRequest(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Body string `json:"body" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "comment body is required"})
+		return
+	}
+
+	comment, err := queryBuilder.CommentOnSuggestion(c.Param("type"), suggestionID, userID, isAdmin, body.Body)
+	if err != nil {
+		respondSuggestionError(c, err)
 		return
 	}
 
+	c.JSON(http.StatusCreated, comment)
+}
+
+// suggestionRequest reads the suggestion ID and the current user, writing the
+// error response itself when either is missing
+func suggestionRequest(c *gin.Context) (uint, uint, bool, bool) {
+	id, err := strconv.ParseUint(c.Param("suggestion"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suggestion ID"})
+		return 0, 0, false, false
+	}
+
 	userID := utils.GetCurrentUserID(c)
 	if userID == 0 {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return 0, 0, false, false
+	}
+
+	isAdmin := false
+	if user, _ := utils.GetCurrentUser(c); user != nil {
+		isAdmin = utils.IsUserAdmin(user)
+	}
+
+	return uint(id), userID, isAdmin, true
+}
+
+func respondSuggestionError(c *gin.Context, err error) {
+	switch msg := err.Error(); {
+	case msg == "unauthorized":
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to act on this suggestion"})
+	case msg == "item not found" || msg == "suggestion not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	case msg == "version conflict":
+		c.JSON(http.StatusConflict, gin.H{"error": "version_conflict", "message": "The item changed since this suggestion was made"})
+	case msg == "duplicate item" || msg == "suggestion is no longer pending" || strings.HasPrefix(msg, "suggestion is already"):
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	}
+}
+
+// DynamicItemSeed queues a job that seeds items from JSON data or a URL. The
+// data is fetched and parsed before the job is created, so those errors are
+// reported right away.
+func DynamicItemSeed(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	if _, ok := getOrRefreshSchema(schemaType); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
 		return
 	}
 
-	result := utils.SeedResult{Errors: []string{}}
+	opts, err := services.ParseSeedOptions(c.Query("mode"), c.Query("dry_run"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	for _, itemData := range items {
-		filters := make(map[string]interface{})
-		for _, key := range cached.UniqueFields {
-			if val, exists := itemData[key]; exists {
-				filters[key] = val
-			}
-		}
+	data, err := utils.GetSeedData(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		if len(filters) > 0 {
-			existingItems, err := queryBuilder.BuildListQuery(services.QueryParams{
-				SchemaName: schemaType,
-				Filters:    filters,
-			})
-			if err != nil {
-				result.Errors = append(result.Errors, fmt.Sprintf("Failed to check duplicates: %v", err))
-				continue
-			}
-			if existingItems.Total > 0 {
-				result.Skipped++
-				continue
+	var rawData map[string]interface{}
+	if err := json.Unmarshal(data, &rawData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid JSON format: %v", err)})
+		return
+	}
+
+	var items []map[string]interface{}
+
+	if itemsData, ok := rawData["items"].([]interface{}); ok {
+		for _, item := range itemsData {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				items = append(items, itemMap)
 			}
 		}
+	}
 
-		validationResult := validationEngine.ValidateCreate(schemaType, itemData)
-		if !validationResult.Valid {
-			result.Errors = append(result.Errors, fmt.Sprintf("Validation failed: %v", validationResult.Errors))
-			continue
-		}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No items to seed"})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
 
-		_, err := queryBuilder.CreateItem(schemaType, userID, itemData)
+	// Items whose image or ratings cannot be read are reported here
+	itemErrors := []string{}
+	var invalid []services.SeedPlanEntry
+	seedItems := make([]services.SeedItem, 0, len(items))
+	for i, item := range items {
+		seedItem, err := services.NewSeedItem(i+1, item)
 		if err != nil {
-			nameVal := "unknown"
-			if name, ok := itemData["name"].(string); ok {
-				nameVal = name
-			}
-			result.Errors = append(result.Errors, fmt.Sprintf("Failed to create %s: %v", nameVal, err))
+			itemErrors = append(itemErrors, fmt.Sprintf("Item %d: %v", i+1, err))
+			invalid = append(invalid, services.SeedPlanEntry{Position: i + 1, Action: services.SeedActionInvalid, Errors: []string{err.Error()}})
 			continue
 		}
-		result.Added++
+		seedItems = append(seedItems, seedItem)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"added":   result.Added,
-		"skipped": result.Skipped,
-		"errors":  result.Errors,
-	})
+	job, err := services.CreateSeedJob(models.JobKindSeed, schemaType, userID, seedItems, opts, itemErrors, invalid)
+	respondJobCreated(c, job, err)
+}
+
+// respondJobCreated acknowledges a seed or import handed to the job runner
+func respondJobCreated(c *gin.Context, job *services.JobEntry, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Location", fmt.Sprintf("/admin/jobs/%d", job.ID))
+	c.JSON(http.StatusAccepted, job)
 }
 
 func DynamicItemValidate(c *gin.Context) {
@@ -485,7 +1661,14 @@ func DynamicItemValidate(c *gin.Context) {
 		ItemCount: len(items),
 	}
 
-	for i, itemData := range items {
+	for i, rawItem := range items {
+		seedItem, err := services.NewSeedItem(i+1, rawItem)
+		if err != nil {
+			result.Valid = false
+			result.Errors = append(result.Errors, fmt.Sprintf("Item %d: %v", i+1, err))
+		}
+		itemData := seedItem.Fields
+
 		validationResult := validationEngine.ValidateCreate(schemaType, itemData)
 		if !validationResult.Valid {
 			result.Valid = false
@@ -505,6 +1688,210 @@ func DynamicItemValidate(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// maxImportFileSize bounds uploaded import files
+const maxImportFileSize = 10 << 20
+
+// DynamicItemImport imports items from an uploaded CSV or XLSX file. Columns are
+// mapped to fields by the "mapping" form value, or by matching headers to field
+// keys and labels when it is omitted. With preview=true nothing is written and the
+// first rows are returned with their validation errors; otherwise the rows are
+// seeded by a background job.
+func DynamicItemImport(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	cached, ok := getOrRefreshSchema(schemaType)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File is too large; the limit is %d MB", maxImportFileSize>>20)})
+		return
+	}
+
+	format, err := services.ImportFormat(c.PostForm("format"), header.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImportFileSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	table, err := services.ParseImportTable(format, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// An explicit mapping replaces the suggested one rather than adding to it
+	suggested := services.SuggestImportMapping(cached.Fields, table.Headers)
+	mapping := suggested
+	if raw := c.PostForm("mapping"); raw != "" {
+		mapping = map[string]string{}
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid mapping: %v", err)})
+			return
+		}
+	}
+
+	rows, err := services.BuildImportRows(cached.Fields, table, mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts, err := services.ParseSeedOptions(c.PostForm("mode"), c.PostForm("dry_run"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.PostForm("preview") == "true" {
+		limit, _ := strconv.Atoi(c.DefaultPostForm("limit", strconv.Itoa(services.DefaultImportPreviewRows)))
+		if limit < 1 {
+			limit = services.DefaultImportPreviewRows
+		}
+		if limit > services.MaxImportPreviewRows {
+			limit = services.MaxImportPreviewRows
+		}
+		if limit > len(rows) {
+			limit = len(rows)
+		}
+
+		previewRows := make([]gin.H, limit)
+		for i, row := range rows[:limit] {
+			errors := row.Errors
+			if validationResult := validationEngine.ValidateCreate(schemaType, row.Fields); !validationResult.Valid {
+				errors = append(errors, validationResult.Errors...)
+			}
+			if errors == nil {
+				errors = []services.ValidationError{}
+			}
+			previewRows[i] = gin.H{
+				"line":   row.Line,
+				"fields": row.Fields,
+				"valid":  len(errors) == 0,
+				"errors": errors,
+			}
+		}
+
+		unmapped := []string{}
+		for _, header := range table.Headers {
+			if key := mapping[header]; key == "" && header != "" {
+				unmapped = append(unmapped, header)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"format":            format,
+			"headers":           table.Headers,
+			"mapping":           mapping,
+			"suggested_mapping": suggested,
+			"unmapped_columns":  unmapped,
+			"total_rows":        len(rows),
+			"rows":              previewRows,
+		})
+		return
+	}
+
+	// Rows with cells of the wrong type are reported here; the others are
+	// validated by the seed job, against the matched item's state in upsert mode
+	opts.ErrorPrefix = "Line"
+	lineErrors := []string{}
+	var invalid []services.SeedPlanEntry
+	items := make([]services.SeedItem, 0, len(rows))
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			entry := services.SeedPlanEntry{Position: row.Line, Action: services.SeedActionInvalid, Errors: services.ValidationMessages(row.Errors)}
+			for _, message := range entry.Errors {
+				lineErrors = append(lineErrors, fmt.Sprintf("Line %d: %s", row.Line, message))
+			}
+			invalid = append(invalid, entry)
+			continue
+		}
+		items = append(items, services.SeedItem{Position: row.Line, Fields: row.Fields})
+	}
+
+	job, err := services.CreateSeedJob(models.JobKindImport, schemaType, userID, items, opts, lineErrors, invalid)
+	respondJobCreated(c, job, err)
+}
+
+// DynamicItemGenerate generates synthetic items for a schema, and optionally
+// users rating and sharing them. The same seed always generates the same data.
+// With preview=true the data is returned in the seed format without being
+// written; otherwise the users are created and the items seeded by a background
+// job.
+func DynamicItemGenerate(c *gin.Context) {
+	schemaType := c.Param("type")
+
+	cached, ok := getOrRefreshSchema(schemaType)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
+		return
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var body struct {
+		services.GenerateOptions
+		Preview bool `json:"preview"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	generated, err := services.GenerateData(cached, body.GenerateOptions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if body.Preview {
+		items := make([]map[string]interface{}, len(generated.Items))
+		for i, item := range generated.Items {
+			items[i] = item.SeedData()
+		}
+		c.JSON(http.StatusOK, gin.H{"seed": generated.Seed, "users": generated.Users, "items": items})
+		return
+	}
+
+	if err := services.CreateGeneratedUsers(generated.Users); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := services.CreateSeedJob(models.JobKindGenerate, schemaType, userID, generated.Items, services.SeedOptions{Mode: services.SeedModeInsert}, nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Location", fmt.Sprintf("/admin/jobs/%d", job.ID))
+	c.JSON(http.StatusAccepted, gin.H{"seed": generated.Seed, "users": len(generated.Users), "job": job})
+}
+
 func parseFilterParams(c *gin.Context) map[string]interface{} {
 	result := make(map[string]interface{})
 	for key, values := range c.Request.URL.Query() {
@@ -518,6 +1905,16 @@ func parseFilterParams(c *gin.Context) map[string]interface{} {
 	return result
 }
 
+func parseCSVParam(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
 func GetTypeStats(c *gin.Context) {
 	schemaType := c.Param("type")
 
@@ -1,10 +1,14 @@
 package controllers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -57,6 +61,8 @@ func setupDynamicItemControllerTest(t *testing.T) (*gin.Engine, string, func())
 		t.Fatalf("failed to generate jwt: %v", err)
 	}
 
+	services.GetJobRunner().Start()
+
 	router := gin.New()
 
 	// API routes (require auth)
@@ -66,14 +72,56 @@ func setupDynamicItemControllerTest(t *testing.T) (*gin.Engine, string, func())
 		items := api.Group("/items")
 		{
 			items.GET("/:type", DynamicItemList)
+			items.GET("/:type/export", DynamicItemExport)
+			items.GET("/:type/trash", DynamicItemTrash)
+			items.GET("/:type/suggestions", DynamicItemSuggestions)
+			items.GET("/:type/suggestions/:suggestion", DynamicItemSuggestion)
 			items.GET("/:type/:id", DynamicItemDetails)
 			items.POST("/:type", DynamicItemCreate)
+			items.POST("/:type/batch", DynamicItemBatch)
 			items.PUT("/:type/:id", DynamicItemUpdate)
+			items.PATCH("/:type/:id", DynamicItemPatch)
 			items.DELETE("/:type/:id", DynamicItemDelete)
+			items.GET("/:type/:id/history", DynamicItemHistory)
+			items.POST("/:type/:id/history/:revision/revert", DynamicItemRevert)
+			items.POST("/:type/:id/restore", DynamicItemRestore)
+			items.GET("/:type/:id/editors", DynamicItemEditors)
+			items.POST("/:type/:id/editors", DynamicItemGrantEditor)
+			items.DELETE("/:type/:id/editors/:userId", DynamicItemRevokeEditor)
+			items.POST("/:type/:id/transfer", DynamicItemTransfer)
+			items.GET("/:type/:id/suggestions", DynamicItemSuggestions)
+			items.POST("/:type/:id/suggestions", DynamicItemSuggest)
+			items.POST("/:type/suggestions/:suggestion/accept", DynamicItemAcceptSuggestion)
+			items.POST("/:type/suggestions/:suggestion/reject", DynamicItemRejectSuggestion)
+			items.POST("/:type/suggestions/:suggestion/comments", DynamicItemCommentSuggestion)
+			items.POST("/:type/:id/image", DynamicItemUploadImage)
+			items.DELETE("/:type/:id/image", DynamicItemDeleteImage)
+		}
+
+		user := api.Group("/user")
+		{
+			user.DELETE("/me", DeleteCurrentUser)
+			user.GET("/me/trash", GetCurrentUserTrash)
+			user.GET("/me/suggestions", GetCurrentUserSuggestions)
+			user.GET("/me/transfers", GetCurrentUserTransfers)
+		}
+
+		transfers := api.Group("/transfers")
+		{
+			transfers.POST("/:id/accept", TransferAccept)
+			transfers.POST("/:id/decline", TransferDecline)
+			transfers.POST("/:id/cancel", TransferCancel)
+		}
+
+		rating := api.Group("/rating")
+		{
+			rating.POST("/new", RatingCreate)
+			rating.PUT("/:id", RatingEdit)
 		}
 
 		stats := api.Group("/stats")
 		{
+			stats.GET("/community/:id", GetCommunityStats)
 			stats.GET("/type/:type", GetTypeStats)
 		}
 	}
@@ -85,6 +133,25 @@ func setupDynamicItemControllerTest(t *testing.T) (*gin.Engine, string, func())
 		itemAdmin := admin.Group("/items")
 		{
 			itemAdmin.GET("/:type/:id/delete-impact", DynamicItemDeleteImpact)
+			itemAdmin.DELETE("/:type/:id/purge", DynamicItemPurge)
+			itemAdmin.GET("/:type/duplicates", DynamicItemDuplicates)
+			itemAdmin.POST("/:type/merge", DynamicItemMerge)
+			itemAdmin.PUT("/:type/:id/owner", DynamicItemReassign)
+			itemAdmin.POST("/:type/seed", DynamicItemSeed)
+			itemAdmin.POST("/:type/import", DynamicItemImport)
+			itemAdmin.POST("/:type/generate", DynamicItemGenerate)
+		}
+
+		jobs := admin.Group("/jobs")
+		{
+			jobs.GET("/:id", JobDetails)
+			jobs.POST("/:id/cancel", JobCancel)
+		}
+
+		consistencyAdmin := admin.Group("/consistency")
+		{
+			consistencyAdmin.GET("", ConsistencyCheck)
+			consistencyAdmin.POST("/repair", ConsistencyRepair)
 		}
 	}
 
@@ -761,3 +828,1071 @@ func TestDynamicItemList_RatedBy(t *testing.T) {
 		t.Errorf("expected 1 total page, got %v", totalPages)
 	}
 }
+
+func TestDynamicItemHistoryAndRevert(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"name": "Tomme", "type": "Soft", "origin": "Savoie"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var createResp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResp)
+	itemID := fmt.Sprintf("%v", createResp["id"])
+
+	updateJSON, _ := json.Marshal(map[string]interface{}{"type": "Hard"})
+	w = performRequest(router, "PUT", "/api/items/cheese/"+itemID, token, updateJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "GET", "/api/items/cheese/"+itemID+"/history", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var history struct {
+		Revisions []struct {
+			ID      uint                              `json:"id"`
+			Action  string                            `json:"action"`
+			Changes map[string]map[string]interface{} `json:"changes"`
+		} `json:"revisions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(history.Revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(history.Revisions))
+	}
+	latest, created := history.Revisions[0], history.Revisions[1]
+	if latest.Action != "update" || created.Action != "create" {
+		t.Errorf("expected update then create, got %s and %s", latest.Action, created.Action)
+	}
+	if change := latest.Changes["type"]; change["from"] != "Soft" || change["to"] != "Hard" {
+		t.Errorf("unexpected type change: %v", latest.Changes)
+	}
+	if len(latest.Changes) != 1 {
+		t.Errorf("expected only the type to change, got %v", latest.Changes)
+	}
+
+	w = performRequest(router, "POST", fmt.Sprintf("/api/items/cheese/%s/history/%d/revert", itemID, created.ID), token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var revertResp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &revertResp)
+	if revertResp["type"] != "Soft" {
+		t.Errorf("expected type to be reverted to Soft, got %v", revertResp["type"])
+	}
+
+	w = performRequest(router, "GET", "/api/items/cheese/"+itemID+"/history", token, nil)
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if len(history.Revisions) != 3 || history.Revisions[0].Action != "revert" {
+		t.Errorf("expected a revert revision on top, got %+v", history.Revisions)
+	}
+}
+
+func TestDynamicItemUpdate_IfMatch(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"name": "Beaufort", "type": "Hard"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var createResp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResp)
+	itemID := fmt.Sprintf("%v", createResp["id"])
+
+	w = performRequest(router, "GET", "/api/items/cheese/"+itemID, token, nil)
+	etag := w.Header().Get("ETag")
+	if etag != fmt.Sprintf(`"%s-1"`, itemID) {
+		t.Fatalf("expected ETag for version 1, got %q", etag)
+	}
+
+	putWithIfMatch := func(body map[string]interface{}, ifMatch string) *httptest.ResponseRecorder {
+		bodyJSON, _ := json.Marshal(body)
+		req, _ := http.NewRequest("PUT", "/api/items/cheese/"+itemID, bytes.NewBuffer(bodyJSON))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// First writer wins and gets the new tag
+	w = putWithIfMatch(map[string]interface{}{"origin": "Savoie"}, etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") != fmt.Sprintf(`"%s-2"`, itemID) {
+		t.Errorf("expected ETag for version 2, got %q", w.Header().Get("ETag"))
+	}
+
+	// Second writer holding the old tag is rejected with the current state
+	w = putWithIfMatch(map[string]interface{}{"origin": "Jura"}, etag)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412, got %d: %s", w.Code, w.Body.String())
+	}
+	var conflict struct {
+		Error   string                 `json:"error"`
+		Current map[string]interface{} `json:"current"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	if conflict.Error != "version_conflict" || conflict.Current["origin"] != "Savoie" {
+		t.Errorf("expected current state in conflict response, got %s", w.Body.String())
+	}
+
+	// Updates without a precondition still apply
+	w = putWithIfMatch(map[string]interface{}{"origin": "Jura"}, "*")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		header   string
+		expected *uint
+	}{
+		{"", nil},
+		{"*", nil},
+		{`"12-3"`, uintPtr(3)},
+		{`W/"12-3"`, uintPtr(3)},
+		{`"12-3", "12-4"`, uintPtr(3)},
+		{`"13-3"`, uintPtr(0)},
+		{`"garbage"`, uintPtr(0)},
+	}
+
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("PUT", "/", nil)
+		if tc.header != "" {
+			c.Request.Header.Set("If-Match", tc.header)
+		}
+
+		got := ifMatchVersion(c, 12)
+		if (got == nil) != (tc.expected == nil) || (got != nil && *got != *tc.expected) {
+			t.Errorf("If-Match %q: expected %v, got %v", tc.header, tc.expected, got)
+		}
+	}
+}
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func TestDynamicItemPatch(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"name": "Morbier", "type": "Soft", "origin": "Jura"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var createResp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResp)
+	itemID := fmt.Sprintf("%v", createResp["id"])
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/api/items/cheese/"+itemID, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Merge patch: null unsets, other members are replaced
+	w = patch("application/merge-patch+json", `{"origin": null, "type": "Semi-Hard"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["type"] != "Semi-Hard" || resp["origin"] != nil || resp["name"] != "Morbier" {
+		t.Errorf("unexpected item after merge patch: %v", resp)
+	}
+
+	// JSON Patch with a guarding test
+	w = patch("application/json-patch+json", `[{"op":"test","path":"/type","value":"Semi-Hard"},{"op":"add","path":"/origin","value":"Doubs"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["origin"] != "Doubs" {
+		t.Errorf("expected origin Doubs, got %v", resp["origin"])
+	}
+
+	w = patch("application/json-patch+json", `[{"op":"test","path":"/type","value":"Soft"},{"op":"remove","path":"/origin"}]`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for failed test, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The full post-patch state is validated: removing a required field fails
+	w = patch("application/json-patch+json", `[{"op":"remove","path":"/type"}]`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid post-patch state, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = patch("text/plain", `{}`)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415, got %d", w.Code)
+	}
+}
+
+func TestDynamicItemBatch(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "create", "fields": map[string]interface{}{"name": "Reblochon", "type": "Soft"}},
+			{"op": "create", "fields": map[string]interface{}{"name": "Tomme"}},
+		},
+	})
+	w := performRequest(router, "POST", "/api/items/cheese/batch", token, bodyJSON)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a failed atomic batch, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	results := resp["results"].([]interface{})
+	if resp["committed"] != false || results[1].(map[string]interface{})["error"] != "validation_failed" {
+		t.Errorf("unexpected atomic batch response: %v", resp)
+	}
+
+	bodyJSON, _ = json.Marshal(map[string]interface{}{
+		"mode": "best_effort",
+		"operations": []map[string]interface{}{
+			{"op": "create", "fields": map[string]interface{}{"name": "Reblochon", "type": "Soft"}},
+			{"op": "create", "fields": map[string]interface{}{"name": "Tomme"}},
+			{"op": "delete", "id": 999999},
+		},
+	})
+	w = performRequest(router, "POST", "/api/items/cheese/batch", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["succeeded"] != float64(1) || resp["failed"] != float64(2) {
+		t.Errorf("unexpected best effort batch response: %v", resp)
+	}
+
+	w = performRequest(router, "GET", "/api/items/cheese?search=Reblochon", token, nil)
+	if !strings.Contains(w.Body.String(), "Reblochon") {
+		t.Errorf("expected created item to be listed, got %s", w.Body.String())
+	}
+
+	bodyJSON, _ = json.Marshal(map[string]interface{}{"mode": "eventually", "operations": []interface{}{}})
+	w = performRequest(router, "POST", "/api/items/cheese/batch", token, bodyJSON)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown mode, got %d", w.Code)
+	}
+}
+
+func TestDynamicItemTrashRestorePurge(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"name": "Cantal", "type": "Hard"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var createResp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResp)
+	itemID := fmt.Sprintf("%v", createResp["id"])
+
+	w = performRequest(router, "DELETE", "/api/items/cheese/"+itemID, token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/api/items/cheese/trash", "/api/user/me/trash"} {
+		w = performRequest(router, "GET", path, token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var trash map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &trash)
+		if trash["total"] != float64(1) {
+			t.Errorf("%s: expected one trashed item, got %v", path, trash)
+		}
+	}
+
+	w = performRequest(router, "POST", "/api/items/cheese/"+itemID+"/restore", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Error("expected ETag on restored item")
+	}
+
+	w = performRequest(router, "GET", "/api/items/cheese/"+itemID, token, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected restored item to be readable, got %d", w.Code)
+	}
+
+	w = performRequest(router, "POST", "/api/items/cheese/"+itemID+"/restore", token, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 restoring a live item, got %d", w.Code)
+	}
+
+	performRequest(router, "DELETE", "/api/items/cheese/"+itemID, token, nil)
+	w = performRequest(router, "DELETE", "/admin/items/cheese/"+itemID+"/purge", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "POST", "/api/items/cheese/"+itemID+"/restore", token, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 restoring a purged item, got %d", w.Code)
+	}
+}
+
+func TestDynamicItemMerge(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	ids := make([]float64, 0, 2)
+	for _, name := range []string{"Saint-Nectaire", "Saint Nectaire"} {
+		bodyJSON, _ := json.Marshal(map[string]interface{}{"name": name, "type": "Semi-soft"})
+		w := performRequest(router, "POST", "/api/items/cheese", token, bodyJSON)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		ids = append(ids, resp["id"].(float64))
+	}
+
+	w := performRequest(router, "GET", "/admin/items/cheese/duplicates", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var dupResp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &dupResp)
+	if dupResp["total"] != float64(1) {
+		t.Fatalf("expected one duplicate cluster, got %v", dupResp)
+	}
+
+	w = performRequest(router, "GET", "/admin/items/cheese/duplicates?threshold=2", token, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid threshold, got %d", w.Code)
+	}
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{
+		"canonical_id":  ids[0],
+		"duplicate_ids": []float64{ids[1]},
+		"fields":        map[string]interface{}{"origin": "Auvergne"},
+	})
+	w = performRequest(router, "POST", "/admin/items/cheese/merge", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var mergeResp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &mergeResp)
+	if item := mergeResp["item"].(map[string]interface{}); item["origin"] != "Auvergne" {
+		t.Errorf("expected override to apply, got %v", item)
+	}
+
+	w = performRequest(router, "GET", fmt.Sprintf("/api/items/cheese/%v?fields=name", ids[1]), token, nil)
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected 301 for a merged item, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != fmt.Sprintf("/api/items/cheese/%v?fields=name", ids[0]) {
+		t.Errorf("unexpected redirect location %q", location)
+	}
+
+	bodyJSON, _ = json.Marshal(map[string]interface{}{"canonical_id": ids[0], "duplicate_ids": []float64{ids[0]}})
+	w = performRequest(router, "POST", "/admin/items/cheese/merge", token, bodyJSON)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 merging an item into itself, got %d", w.Code)
+	}
+}
+
+func TestDynamicItemSuggestions(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"name": "Reblochon", "type": "Soft", "origin": "Savoei"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	itemID := fmt.Sprintf("%v", created["id"])
+
+	submitter := models.User{
+		GoogleID:         fmt.Sprintf("submitter-google-%d", time.Now().UnixNano()),
+		Email:            fmt.Sprintf("submitter-%d@example.com", time.Now().UnixNano()),
+		DisplayName:      fmt.Sprintf("Submitter %d", time.Now().UnixNano()),
+		ProfileCompleted: true,
+		LastLoginAt:      time.Now(),
+	}
+	if err := utils.DB.Create(&submitter).Error; err != nil {
+		t.Fatalf("failed to create submitter: %v", err)
+	}
+	submitterToken, err := utils.GenerateJWT(&submitter)
+	if err != nil {
+		t.Fatalf("failed to generate jwt: %v", err)
+	}
+
+	w = performRequest(router, "PUT", "/api/items/cheese/"+itemID, submitterToken, []byte(`{"origin": "Savoie"}`))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 updating someone else's item, got %d", w.Code)
+	}
+
+	w = performRequest(router, "POST", "/api/items/cheese/"+itemID+"/suggestions", submitterToken, []byte(`{"changes": {"type": null}}`))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "validation_failed") {
+		t.Errorf("expected validation failure, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "POST", "/api/items/cheese/"+itemID+"/suggestions", submitterToken, []byte(`{"changes": {"origin": "Savoie"}, "message": "Typo"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var suggestion map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &suggestion)
+	suggestionPath := fmt.Sprintf("/api/items/cheese/suggestions/%v", suggestion["id"])
+
+	w = performRequest(router, "GET", "/api/items/cheese/suggestions?status=pending", token, nil)
+	var queue map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &queue)
+	if w.Code != http.StatusOK || queue["total"] != float64(1) {
+		t.Fatalf("expected one pending suggestion in the queue, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "POST", suggestionPath+"/accept", submitterToken, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 when the submitter accepts, got %d", w.Code)
+	}
+
+	w = performRequest(router, "POST", suggestionPath+"/comments", token, []byte(`{"body": "Thanks!"}`))
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201 commenting, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "POST", suggestionPath+"/accept", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var item map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &item)
+	if item["origin"] != "Savoie" {
+		t.Errorf("expected suggestion to be applied, got %v", item)
+	}
+
+	w = performRequest(router, "POST", suggestionPath+"/reject", token, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 rejecting an accepted suggestion, got %d", w.Code)
+	}
+
+	// A suggestion older than the item's latest edit is refused
+	w = performRequest(router, "POST", "/api/items/cheese/"+itemID+"/suggestions", submitterToken, []byte(`{"changes": {"type": "Washed rind"}}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &suggestion)
+	w = performRequest(router, "PUT", "/api/items/cheese/"+itemID, token, []byte(`{"type": "Soft, washed"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 updating, got %d: %s", w.Code, w.Body.String())
+	}
+	w = performRequest(router, "POST", fmt.Sprintf("/api/items/cheese/suggestions/%v/accept", suggestion["id"]), token, nil)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "version_conflict") {
+		t.Errorf("expected 409 accepting a stale suggestion, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// One made before an edit to other fields is applied on top of it
+	w = performRequest(router, "POST", "/api/items/cheese/"+itemID+"/suggestions", submitterToken, []byte(`{"changes": {"origin": "Haute-Savoie"}}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &suggestion)
+	w = performRequest(router, "PATCH", "/api/items/cheese/"+itemID, token, []byte(`{"type": "Soft"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 patching, got %d: %s", w.Code, w.Body.String())
+	}
+	w = performRequest(router, "POST", fmt.Sprintf("/api/items/cheese/suggestions/%v/accept", suggestion["id"]), token, nil)
+	json.Unmarshal(w.Body.Bytes(), &item)
+	if w.Code != http.StatusOK || item["origin"] != "Haute-Savoie" || item["type"] != "Soft" {
+		t.Errorf("expected the suggestion applied on top of the later edit, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "GET", "/api/user/me/suggestions", submitterToken, nil)
+	var mine map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &mine)
+	if w.Code != http.StatusOK || mine["total"] != float64(3) {
+		t.Fatalf("expected the submitter's suggestions, got %d: %s", w.Code, w.Body.String())
+	}
+	if entry := mine["suggestions"].([]interface{})[2].(map[string]interface{}); entry["status"] != "accepted" {
+		t.Errorf("expected accepted status, got %v", entry["status"])
+	}
+}
+
+func TestDynamicItemEditors(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	users := make([]models.User, 2)
+	tokens := make([]string, 2)
+	for i := range users {
+		users[i] = models.User{
+			GoogleID:         fmt.Sprintf("editor-google-%d-%d", i, time.Now().UnixNano()),
+			Email:            fmt.Sprintf("editor-%d-%d@example.com", i, time.Now().UnixNano()),
+			DisplayName:      fmt.Sprintf("Editor %d %d", i, time.Now().UnixNano()),
+			ProfileCompleted: true,
+			LastLoginAt:      time.Now(),
+		}
+		if err := utils.DB.Create(&users[i]).Error; err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		var err error
+		if tokens[i], err = utils.GenerateJWT(&users[i]); err != nil {
+			t.Fatalf("failed to generate jwt: %v", err)
+		}
+	}
+	ownerToken, editorToken := tokens[0], tokens[1]
+
+	w := performRequest(router, "POST", "/api/items/cheese", ownerToken, []byte(`{"name": "Mimolette", "type": "Hard"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	itemPath := fmt.Sprintf("/api/items/cheese/%v", created["id"])
+
+	w = performRequest(router, "PUT", itemPath, editorToken, []byte(`{"origin": "Lille"}`))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 before the grant, got %d", w.Code)
+	}
+	w = performRequest(router, "DELETE", itemPath+"/image", editorToken, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 managing images before the grant, got %d", w.Code)
+	}
+
+	w = performRequest(router, "POST", itemPath+"/editors", editorToken, []byte(fmt.Sprintf(`{"user_id": %d}`, users[1].ID)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 when a non-owner grants, got %d", w.Code)
+	}
+	w = performRequest(router, "POST", itemPath+"/editors", ownerToken, []byte(fmt.Sprintf(`{"user_id": %d}`, users[1].ID)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "PUT", itemPath, editorToken, []byte(`{"origin": "Lille"}`))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the editor to update, got %d: %s", w.Code, w.Body.String())
+	}
+	w = performRequest(router, "DELETE", itemPath+"/image", editorToken, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected the editor to pass the image check, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Admins can fix any item
+	w = performRequest(router, "PATCH", itemPath, token, []byte(`{"origin": "Flandre"}`))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected admin override on patch, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "DELETE", fmt.Sprintf("%s/editors/%d", itemPath, users[1].ID), ownerToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 revoking, got %d", w.Code)
+	}
+	w = performRequest(router, "DELETE", itemPath, editorToken, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 deleting after revoke, got %d", w.Code)
+	}
+}
+
+func TestDynamicItemTransfer(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	users := make([]models.User, 2)
+	tokens := make([]string, 2)
+	for i := range users {
+		users[i] = models.User{
+			GoogleID:         fmt.Sprintf("transfer-google-%d-%d", i, time.Now().UnixNano()),
+			Email:            fmt.Sprintf("transfer-%d-%d@example.com", i, time.Now().UnixNano()),
+			DisplayName:      fmt.Sprintf("Transfer %d %d", i, time.Now().UnixNano()),
+			ProfileCompleted: true,
+			LastLoginAt:      time.Now(),
+		}
+		if err := utils.DB.Create(&users[i]).Error; err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		var err error
+		if tokens[i], err = utils.GenerateJWT(&users[i]); err != nil {
+			t.Fatalf("failed to generate jwt: %v", err)
+		}
+	}
+	ownerToken, recipientToken := tokens[0], tokens[1]
+
+	w := performRequest(router, "POST", "/api/items/cheese", ownerToken, []byte(`{"name": "Beaufort", "type": "Hard"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	itemPath := fmt.Sprintf("/api/items/cheese/%v", created["id"])
+
+	w = performRequest(router, "POST", itemPath+"/transfer", ownerToken, []byte(fmt.Sprintf(`{"user_id": %d}`, users[1].ID)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var transfer map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &transfer)
+	transferPath := fmt.Sprintf("/api/transfers/%v", transfer["id"])
+
+	w = performRequest(router, "GET", "/api/user/me/transfers?direction=incoming&status=pending", recipientToken, nil)
+	var incoming map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &incoming)
+	if w.Code != http.StatusOK || incoming["total"] != float64(1) {
+		t.Fatalf("expected one incoming transfer, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "POST", transferPath+"/accept", ownerToken, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 when the owner accepts, got %d", w.Code)
+	}
+	w = performRequest(router, "POST", transferPath+"/accept", recipientToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var item map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &item)
+	if item["user_id"] != float64(users[1].ID) {
+		t.Errorf("expected the recipient to own the item, got %v", item["user_id"])
+	}
+	w = performRequest(router, "POST", transferPath+"/cancel", ownerToken, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 cancelling an accepted transfer, got %d", w.Code)
+	}
+
+	w = performRequest(router, "PUT", "/admin/items/cheese/"+fmt.Sprint(created["id"])+"/owner", token, []byte(fmt.Sprintf(`{"user_id": %d}`, users[0].ID)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 reassigning, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The item outlives its owner's account
+	w = performRequest(router, "DELETE", "/api/user/me", ownerToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 deleting the account, got %d: %s", w.Code, w.Body.String())
+	}
+	w = performRequest(router, "GET", itemPath, recipientToken, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the item to remain after account deletion, got %d", w.Code)
+	}
+}
+
+func TestDynamicItemImport_MappingOverride(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "cheeses.csv")
+	part.Write([]byte("Name,Type,Origin,Pays\nComté,Hard,Jura (old),France\n"))
+	// Pays overrides the Origin column the suggestion maps to origin
+	form.WriteField("mapping", `{"Name":"name","Type":"type","Pays":"origin"}`)
+	form.WriteField("preview", "true")
+	form.Close()
+
+	req, _ := http.NewRequest("POST", "/admin/items/cheese/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var preview struct {
+		Mapping          map[string]string `json:"mapping"`
+		SuggestedMapping map[string]string `json:"suggested_mapping"`
+		Rows             []struct {
+			Fields map[string]interface{} `json:"fields"`
+		} `json:"rows"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if len(preview.Mapping) != 3 || preview.Mapping["Origin"] != "" {
+		t.Errorf("expected the explicit mapping alone, got %v", preview.Mapping)
+	}
+	if preview.SuggestedMapping["Origin"] != "origin" || preview.SuggestedMapping["Pays"] != "" {
+		t.Errorf("expected the suggested mapping to be left as suggested, got %v", preview.SuggestedMapping)
+	}
+	if len(preview.Rows) != 1 || preview.Rows[0].Fields["origin"] != "France" {
+		t.Errorf("expected origin to come from the Pays column, got %+v", preview.Rows)
+	}
+}
+
+func TestDynamicItemExport(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	for _, item := range []map[string]interface{}{
+		{"name": "Brie", "type": "Soft", "origin": "France"},
+		{"name": "Cheddar", "type": "Hard", "origin": "England"},
+		{"name": "Camembert", "type": "Soft", "origin": "France"},
+	} {
+		bodyJSON, _ := json.Marshal(item)
+		w := performRequest(router, "POST", "/api/items/cheese", token, bodyJSON)
+		if w.Code != http.StatusOK {
+			t.Fatalf("failed to create item: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// CSV export applies the list filters
+	w := performRequest(router, "GET", "/api/items/cheese/export?filter[type]=Soft", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Disposition") != `attachment; filename="cheese.csv"` {
+		t.Errorf("unexpected content disposition %q", w.Header().Get("Content-Disposition"))
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %d lines: %s", len(lines), w.Body.String())
+	}
+	if !strings.HasPrefix(lines[0], "\xef\xbb\xbfID,Name") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+
+	// NDJSON export with the user's own ratings
+	w = performRequest(router, "GET", "/api/items/cheese/export?format=ndjson&include=my_rating", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("invalid NDJSON line: %v", err)
+	}
+	if first["name"] != "Brie" {
+		t.Errorf("expected items in ID order, got %v", first["name"])
+	}
+	if _, ok := first["my_grade"]; !ok {
+		t.Error("expected my_grade column")
+	}
+
+	w = performRequest(router, "GET", "/api/items/cheese/export?format=pdf", token, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", w.Code)
+	}
+}
+
+// runSeedJob starts a seed or import job and waits for it to finish
+func runSeedJob(t *testing.T, router *gin.Engine, token string, w *httptest.ResponseRecorder) services.JobEntry {
+	t.Helper()
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var job services.JobEntry
+	for attempt := 0; attempt < 100; attempt++ {
+		json.Unmarshal(w.Body.Bytes(), &job)
+		if job.Status == models.JobStatusCompleted || job.Status == models.JobStatusFailed || job.Status == models.JobStatusCancelled {
+			return job
+		}
+		time.Sleep(100 * time.Millisecond)
+		w = performRequest(router, "GET", fmt.Sprintf("/admin/jobs/%d", job.ID), token, nil)
+	}
+	t.Fatalf("job %d did not finish: %s", job.ID, w.Body.String())
+	return job
+}
+
+func TestDynamicItemSeed_UpsertAndDryRun(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"name": "Comte", "type": "Hard", "origin": "Jura"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to create item: %d %s", w.Code, w.Body.String())
+	}
+
+	seed, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{
+			"items": []map[string]interface{}{
+				{"name": "Comte", "origin": "Doubs"},
+				{"name": "Brie", "type": "Soft"},
+				{"name": "Feta"},
+				{"name": "Brie", "type": "Soft"},
+			},
+		},
+	})
+
+	// A dry run reports the plan without writing
+	job := runSeedJob(t, router, token, performRequest(router, "POST", "/admin/items/cheese/seed?mode=upsert&dry_run=true", token, seed))
+	if job.Status != models.JobStatusCompleted || !job.DryRun || job.Mode != services.SeedModeUpsert {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if job.Added != 1 || job.Updated != 1 || job.Skipped != 1 || len(job.Plan) != 4 || job.Processed != 4 {
+		t.Fatalf("unexpected dry run %+v", job)
+	}
+	actions := []services.SeedAction{services.SeedActionUpdate, services.SeedActionCreate, services.SeedActionInvalid, services.SeedActionSkip}
+	for i, action := range actions {
+		if job.Plan[i].Action != action {
+			t.Errorf("expected item %d to %s, got %s", i+1, action, job.Plan[i].Action)
+		}
+	}
+	if change := job.Plan[0].Changes["origin"]; change.From != "Jura" || change.To != "Doubs" {
+		t.Errorf("unexpected diff %+v", job.Plan[0].Changes)
+	}
+
+	w = performRequest(router, "GET", "/api/items/cheese?filter[name]=Brie", token, nil)
+	if !strings.Contains(w.Body.String(), `"total":0`) {
+		t.Errorf("expected the dry run to write nothing, got %s", w.Body.String())
+	}
+
+	// Insert mode leaves the existing item alone
+	job = runSeedJob(t, router, token, performRequest(router, "POST", "/admin/items/cheese/seed", token, seed))
+	if job.Added != 1 || job.Updated != 0 || job.Skipped != 2 || len(job.Errors) != 1 || job.Plan != nil {
+		t.Errorf("unexpected insert result %+v", job)
+	}
+
+	job = runSeedJob(t, router, token, performRequest(router, "POST", "/admin/items/cheese/seed?mode=upsert", token, seed))
+	if job.Added != 0 || job.Updated != 1 || job.Skipped != 2 {
+		t.Errorf("unexpected upsert result %+v", job)
+	}
+	w = performRequest(router, "GET", "/api/items/cheese?filter[name]=Comte", token, nil)
+	if !strings.Contains(w.Body.String(), `"origin":"Doubs"`) || !strings.Contains(w.Body.String(), `"type":"Hard"`) {
+		t.Errorf("expected the origin to be updated and the type kept, got %s", w.Body.String())
+	}
+
+	w = performRequest(router, "POST", "/admin/items/cheese/seed?mode=replace", token, seed)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown mode, got %d", w.Code)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	w := performRequest(router, "GET", "/admin/jobs/999999", token, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing job, got %d", w.Code)
+	}
+
+	seed, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{"items": []map[string]interface{}{{"name": "Brie", "type": "Soft"}}},
+	})
+	w = performRequest(router, "POST", "/admin/items/cheese/seed", token, seed)
+	if location := w.Header().Get("Location"); !strings.HasPrefix(location, "/admin/jobs/") {
+		t.Errorf("expected a job location, got %q", location)
+	}
+	job := runSeedJob(t, router, token, w)
+	if job.Status != models.JobStatusCompleted || job.Kind != models.JobKindSeed || job.Progress != 1 || job.FinishedAt == nil {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	w = performRequest(router, "POST", fmt.Sprintf("/admin/jobs/%d/cancel", job.ID), token, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 when cancelling a finished job, got %d", w.Code)
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(map[string]interface{}{"name": "Brie", "type": "Soft"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, body)
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	itemID := uint(created["id"].(float64))
+	utils.DB.Model(&models.Item{}).Where("id = ?", itemID).UpdateColumn("field_values", `{"name":"Brie"}`)
+
+	w = performRequest(router, "GET", "/admin/consistency?schema=cheese", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var report services.ConsistencyReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if report.IssueCounts[services.IssueMismatch] != 1 || report.Issues[0].ItemID != itemID {
+		t.Errorf("expected the drifted item to be reported, got %+v", report)
+	}
+
+	w = performRequest(router, "POST", "/admin/consistency/repair?schema=cheese", token, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a source, got %d", w.Code)
+	}
+	w = performRequest(router, "POST", "/admin/consistency/repair?schema=cheese&source=eav", token, nil)
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || report.Repaired != 1 {
+		t.Errorf("expected the item to be repaired, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "GET", "/admin/consistency?schema=unknown", token, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown schema, got %d", w.Code)
+	}
+}
+
+func TestDynamicItemGenerate(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	body, _ := json.Marshal(map[string]interface{}{"count": 5, "seed": 7, "users": 3, "ratings_per_item": 2, "preview": true})
+	w := performRequest(router, "POST", "/admin/items/cheese/generate", token, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var preview struct {
+		Seed  int64                    `json:"seed"`
+		Users []services.GeneratedUser `json:"users"`
+		Items []map[string]interface{} `json:"items"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if preview.Seed != 7 || len(preview.Users) != 3 || len(preview.Items) != 5 {
+		t.Fatalf("unexpected preview %s", w.Body.String())
+	}
+	var count int64
+	utils.DB.Model(&models.User{}).Where("email = ?", preview.Users[0].Email).Count(&count)
+	if count != 0 {
+		t.Error("expected a preview not to create users")
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{"count": 5, "seed": 7, "users": 3, "ratings_per_item": 2})
+	w = performRequest(router, "POST", "/admin/items/cheese/generate", token, body)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var started struct {
+		Seed int64             `json:"seed"`
+		Job  services.JobEntry `json:"job"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &started)
+	var job services.JobEntry
+	for attempt := 0; attempt < 100 && job.Status != models.JobStatusCompleted; attempt++ {
+		time.Sleep(100 * time.Millisecond)
+		w = performRequest(router, "GET", fmt.Sprintf("/admin/jobs/%d", started.Job.ID), token, nil)
+		json.Unmarshal(w.Body.Bytes(), &job)
+	}
+	if job.Kind != models.JobKindGenerate || job.Status != models.JobStatusCompleted || job.Added != 5 {
+		t.Errorf("unexpected job %s", w.Body.String())
+	}
+	utils.DB.Model(&models.User{}).Where("email LIKE ?", "taster-7-%").Count(&count)
+	if count != 3 {
+		t.Errorf("expected 3 generated users, got %d", count)
+	}
+	utils.DB.Model(&models.User{}).Where("email LIKE ? AND discoverable = ?", "taster-7-%", true).Count(&count)
+	if count != 0 {
+		t.Errorf("expected generated users not to be discoverable, got %d", count)
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{"count": 0})
+	w = performRequest(router, "POST", "/admin/items/cheese/generate", token, body)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without items to generate, got %d", w.Code)
+	}
+}
+
+func TestRatingScale(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	utils.DB.Model(&models.ItemTypeSchema{}).Where("name = ?", "cheese").Update("rating_scale", `{"min":50,"max":100,"step":1}`)
+	if err := schemaRegistry.RefreshSchema("cheese"); err != nil {
+		t.Fatalf("failed to refresh schema: %v", err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"name": "Brie", "type": "Soft"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, body)
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	itemID := int(created["id"].(float64))
+
+	body, _ = json.Marshal(map[string]interface{}{"grade": 4.5, "item_id": itemID})
+	w = performRequest(router, "POST", "/api/rating/new", token, body)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a grade off the scale to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{"grade": 80, "item_id": itemID})
+	w = performRequest(router, "POST", "/api/rating/new", token, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var rating models.Rating
+	json.Unmarshal(w.Body.Bytes(), &rating)
+
+	body, _ = json.Marshal(map[string]interface{}{"grade": 80.5, "item_id": itemID})
+	w = performRequest(router, "PUT", fmt.Sprintf("/api/rating/%d", rating.ID), token, body)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an edit off the scale to be refused, got %d", w.Code)
+	}
+
+	w = performRequest(router, "GET", fmt.Sprintf("/api/stats/community/%d", itemID), token, nil)
+	var stats map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if stats["average_rating"] != 80.0 || stats["normalized_average"] != 0.6 {
+		t.Errorf("expected raw and normalized averages, got %v", stats)
+	}
+}
+
+func TestRatingCriteria(t *testing.T) {
+	router, token, cleanup := setupDynamicItemControllerTest(t)
+	defer cleanup()
+
+	criteria := `[{"key":"texture","label":"Texture"},{"key":"taste","label":"Taste","weight":3,"scale":{"min":0,"max":100,"step":1}}]`
+	utils.DB.Model(&models.ItemTypeSchema{}).Where("name = ?", "cheese").Update("rating_criteria", criteria)
+	if err := schemaRegistry.RefreshSchema("cheese"); err != nil {
+		t.Fatalf("failed to refresh schema: %v", err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"name": "Brie", "type": "Soft"})
+	w := performRequest(router, "POST", "/api/items/cheese", token, body)
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	itemID := int(created["id"].(float64))
+
+	body, _ = json.Marshal(map[string]interface{}{"item_id": itemID, "scores": map[string]float64{"texture": 3, "aroma": 4}})
+	w = performRequest(router, "POST", "/api/rating/new", token, body)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown_criterion") {
+		t.Errorf("expected an unknown criterion to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Without a grade, the overall is the weighted mean of the scores
+	body, _ = json.Marshal(map[string]interface{}{"item_id": itemID, "scores": map[string]float64{"texture": 2, "taste": 90}})
+	w = performRequest(router, "POST", "/api/rating/new", token, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var rating models.Rating
+	json.Unmarshal(w.Body.Bytes(), &rating)
+	if rating.Grade != 4 || len(rating.Scores) != 2 {
+		t.Errorf("expected an overall of 4 with two scores, got %+v", rating)
+	}
+
+	// New scores replace the old ones; an explicit grade is kept as given
+	body, _ = json.Marshal(map[string]interface{}{"item_id": itemID, "grade": 3, "scores": map[string]float64{"taste": 70}})
+	w = performRequest(router, "PUT", fmt.Sprintf("/api/rating/%d", rating.ID), token, body)
+	json.Unmarshal(w.Body.Bytes(), &rating)
+	if w.Code != http.StatusOK || rating.Grade != 3 || len(rating.Scores) != 1 {
+		t.Errorf("unexpected edited rating %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "GET", fmt.Sprintf("/api/stats/community/%d", itemID), token, nil)
+	var stats struct {
+		Criteria []services.CriterionStats `json:"criteria"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if len(stats.Criteria) != 2 || stats.Criteria[0].TotalScores != 0 || stats.Criteria[1].Average != 70 || stats.Criteria[1].NormalizedAverage != 0.7 {
+		t.Errorf("unexpected criteria stats %+v", stats.Criteria)
+	}
+}
@@ -59,28 +59,34 @@ func processAndSaveImage(c *gin.Context, item *models.Item, itemType string) {
 		return
 	}
 
-	// Delete old image if exists
-	oldImageURL := item.GetImageURL()
-	if oldImageURL != nil && *oldImageURL != "" {
-		oldFilename := (*oldImageURL)[strings.LastIndex(*oldImageURL, "/")+1:]
-		if err := utils.DeleteFromStorage(oldFilename); err != nil {
-			// Log but don't fail
-			slog.Error("failed to delete old image", "error", err)
-		}
-	}
-
 	// Update with new image URL
+	oldImageURL := item.GetImageURL()
 	item.SetImageURL(&imageURL)
 	if err := utils.SaveItem(item); err != nil {
 		// Cleanup uploaded image
 		utils.DeleteFromStorage(filename)
+		if err.Error() == "version conflict" {
+			respondVersionConflict(c, itemType, item.ID)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update database"})
 		return
 	}
 
+	// Delete old image if exists, now that nothing references it
+	if oldImageURL != nil && *oldImageURL != "" {
+		oldFilename := (*oldImageURL)[strings.LastIndex(*oldImageURL, "/")+1:]
+		if err := utils.DeleteFromStorage(oldFilename); err != nil {
+			// Log but don't fail
+			slog.Error("failed to delete old image", "error", err)
+		}
+	}
+
+	c.Header("ETag", itemETag(item.ID, item.Version))
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Image uploaded successfully",
 		"image_url": imageURL,
+		"version":   item.Version,
 	})
 }
 
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/davidcharbonnier/alacarte-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+// JobList lists seed and import jobs, newest first
+func JobList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	result, err := services.ListJobs(c.Query("status"), page, perPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// JobDetails returns a job's progress, counts and errors
+func JobDetails(c *gin.Context) {
+	id, ok := jobRequest(c)
+	if !ok {
+		return
+	}
+
+	job, err := services.GetJob(id)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// JobCancel stops a queued or running job
+func JobCancel(c *gin.Context) {
+	id, ok := jobRequest(c)
+	if !ok {
+		return
+	}
+
+	job, err := services.CancelJob(id)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func jobRequest(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondJobError(c *gin.Context, err error) {
+	switch msg := err.Error(); {
+	case msg == "job not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	case strings.HasPrefix(msg, "job is already"):
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+	}
+}
@@ -5,18 +5,64 @@ import (
 	"strconv"
 
 	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/services"
 	"github.com/davidcharbonnier/alacarte-api/utils"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// ratingBody is a rating as written by its author: an overall grade, scores on
+// the schema's rating criteria, or both
+type ratingBody struct {
+	Grade  *float64           `json:"grade"`
+	Note   string             `json:"note"`
+	ItemID int                `json:"item_id" binding:"required"`
+	Scores map[string]float64 `json:"scores"`
+}
+
+// resolveRatingGrade validates a rating against the schema of its item and
+// returns its overall grade: the one given, or else the weighted overall of its
+// scores. It responds with the errors when the rating is invalid.
+func resolveRatingGrade(c *gin.Context, body ratingBody) (float32, bool) {
+	cached, err := services.ItemSchema(uint(body.ItemID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return 0, false
+	}
+
+	result := validationEngine.ValidateRating(cached.Schema.Name, body.Grade, body.Scores)
+	if !result.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":        "validation_failed",
+			"errors":       result.Errors,
+			"rating_scale": cached.RatingScale(),
+		})
+		return 0, false
+	}
+
+	if body.Grade != nil {
+		return float32(*body.Grade), true
+	}
+	grade, _ := services.OverallGrade(cached, body.Scores)
+	return float32(grade), true
+}
+
+// reloadRating loads a rating with its scores for a response
+func reloadRating(c *gin.Context, id uint) {
+	var rating models.Rating
+	if err := utils.DB.Preload("Scores").First(&rating, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload rating"})
+		return
+	}
+	c.JSON(http.StatusOK, rating)
+}
+
 func RatingCreate(c *gin.Context) {
-	var body struct {
-		Grade  float32 `json:"grade" binding:"required"`
-		Note   string  `json:"note"`
-		ItemID int     `json:"item_id" binding:"required"`
+	var body ratingBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "item_id is required"})
+		return
 	}
-	c.Bind(&body)
 
 	// Get current user from auth context
 	userID := utils.GetCurrentUserID(c)
@@ -26,14 +72,24 @@ func RatingCreate(c *gin.Context) {
 		return
 	}
 
+	grade, ok := resolveRatingGrade(c, body)
+	if !ok {
+		return
+	}
+
 	rating := models.Rating{
-		Grade:  body.Grade,
+		Grade:  grade,
 		Note:   body.Note,
 		UserID: int(userID),
 		ItemID: body.ItemID,
 	}
 
-	if err := utils.DB.Create(&rating).Error; err != nil {
+	if err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rating).Error; err != nil {
+			return err
+		}
+		return services.SaveRatingScores(tx, rating.ID, body.Scores)
+	}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -41,7 +97,7 @@ func RatingCreate(c *gin.Context) {
 	// No longer add author as viewer - ownership is implicit through UserID
 	// Ratings are private by default with no viewers
 
-	c.JSON(http.StatusOK, rating)
+	reloadRating(c, rating.ID)
 }
 
 func RatingByAuthor(c *gin.Context) {
@@ -59,9 +115,15 @@ func RatingByAuthor(c *gin.Context) {
 		return
 	}
 
+	page, err := parseRatingPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// get our list of ratings for a specific id
 	var ratings []models.Rating
-	if err := utils.DB.
+	if err := page.apply(utils.DB).
 		Preload("User", func(db *gorm.DB) *gorm.DB {
 			// Select only necessary user fields for privacy
 			return db.Select("id, display_name, avatar, discoverable")
@@ -70,6 +132,7 @@ func RatingByAuthor(c *gin.Context) {
 			// Select only necessary viewer fields for privacy
 			return db.Select("id, display_name, avatar")
 		}).
+		Preload("Scores").
 		Where(models.Rating{
 			UserID: id,
 		}).
@@ -78,7 +141,7 @@ func RatingByAuthor(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, ratings)
+	page.respond(c, ratings)
 }
 
 func RatingByViewer(c *gin.Context) {
@@ -96,11 +159,17 @@ func RatingByViewer(c *gin.Context) {
 		return
 	}
 
+	page, err := parseRatingPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Get ratings where user is EITHER the author OR in viewers list
 	var ratings []models.Rating
 	viewerSubQuery := utils.DB.Table("rating_viewers").Select("rating_id").Where("user_id = ?", id)
 
-	if err := utils.DB.
+	if err := page.apply(utils.DB).
 		Preload("User", func(db *gorm.DB) *gorm.DB {
 			// Select only necessary user fields for privacy
 			return db.Select("id, display_name, avatar, discoverable")
@@ -109,13 +178,77 @@ func RatingByViewer(c *gin.Context) {
 			// Select only necessary viewer fields for privacy
 			return db.Select("id, display_name, avatar")
 		}).
+		Preload("Scores").
 		Where("user_id = ? OR id IN (?)", id, viewerSubQuery).
 		Find(&ratings).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, ratings)
+	page.respond(c, ratings)
+}
+
+// ratingPage holds optional keyset pagination over rating IDs. Requests without
+// a cursor or limit keep receiving the full list as a bare array.
+type ratingPage struct {
+	enabled bool
+	afterID uint
+	limit   int
+}
+
+func parseRatingPage(c *gin.Context) (*ratingPage, error) {
+	page := &ratingPage{}
+
+	cursor, hasCursor := c.GetQuery("cursor")
+	limitStr, hasLimit := c.GetQuery("limit")
+	if !hasCursor && !hasLimit {
+		return page, nil
+	}
+
+	page.enabled = true
+	page.limit, _ = strconv.Atoi(limitStr)
+	if page.limit < 1 {
+		page.limit = 50
+	}
+	if page.limit > 100 {
+		page.limit = 100
+	}
+
+	if cursor != "" {
+		afterID, err := services.DecodeIDCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		page.afterID = afterID
+	}
+
+	return page, nil
+}
+
+func (p *ratingPage) apply(db *gorm.DB) *gorm.DB {
+	if !p.enabled {
+		return db
+	}
+	return db.Where("ratings.id > ?", p.afterID).Order("ratings.id ASC").Limit(p.limit + 1)
+}
+
+func (p *ratingPage) respond(c *gin.Context, ratings []models.Rating) {
+	if !p.enabled {
+		c.JSON(http.StatusOK, ratings)
+		return
+	}
+
+	nextCursor := ""
+	if len(ratings) > p.limit {
+		ratings = ratings[:p.limit]
+		nextCursor = services.EncodeCursor("id", []interface{}{ratings[len(ratings)-1].ID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ratings":     ratings,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
 }
 
 func RatingShare(c *gin.Context) {
@@ -260,6 +393,7 @@ func RatingByItem(c *gin.Context) {
 			// Select only necessary viewer fields for privacy
 			return db.Select("id, display_name, avatar")
 		}).
+		Preload("Scores").
 		Where("id IN (?)", subQuery).
 		Where(models.Rating{
 			ItemID: id,
@@ -275,12 +409,11 @@ func RatingByItem(c *gin.Context) {
 
 func RatingEdit(c *gin.Context) {
 	id := c.Param("id")
-	var body struct {
-		Grade  float32 `json:"grade" binding:"required"`
-		Note   string  `json:"note"`
-		ItemID int     `json:"item_id" binding:"required"`
+	var body ratingBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "item_id is required"})
+		return
 	}
-	c.Bind(&body)
 
 	var rating models.Rating
 	if err := utils.DB.First(&rating, id).Error; err != nil {
@@ -295,16 +428,36 @@ func RatingEdit(c *gin.Context) {
 		return
 	}
 
-	if err := utils.DB.Model(&rating).Updates(models.Rating{
-		Grade:  body.Grade,
-		Note:   body.Note,
-		ItemID: body.ItemID,
-	}).Error; err != nil {
+	grade, ok := resolveRatingGrade(c, body)
+	if !ok {
+		return
+	}
+
+	// Selecting the grade writes it even when 0, which Updates skips as a zero
+	// value; an empty note still leaves the note as it is
+	columns := []string{"Grade", "ItemID", "UpdatedAt"}
+	if body.Note != "" {
+		columns = append(columns, "Note")
+	}
+	if err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&rating).Select(columns).Updates(models.Rating{
+			Grade:  grade,
+			Note:   body.Note,
+			ItemID: body.ItemID,
+		}).Error; err != nil {
+			return err
+		}
+		// Scores are kept unless new ones are sent
+		if body.Scores == nil {
+			return nil
+		}
+		return services.SaveRatingScores(tx, rating.ID, body.Scores)
+	}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, rating)
+	reloadRating(c, rating.ID)
 }
 
 func RatingRemove(c *gin.Context) {
@@ -339,6 +492,13 @@ func GetCommunityStats(c *gin.Context) {
 		return
 	}
 
+	cached, err := services.ItemSchema(uint(itemId))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	scale := cached.RatingScale()
+
 	// Get aggregate statistics for all ratings of this item (ignore privacy for anonymous stats)
 	var result struct {
 		Count   int     `json:"count"`
@@ -354,11 +514,17 @@ func GetCommunityStats(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"total_ratings":  result.Count,
-		"average_rating": result.Average,
-		"item_id":        itemId,
-	})
+	criteria, err := services.CriteriaStatsForItem(cached, uint(itemId))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get community stats"})
+		return
+	}
+
+	stats := services.CommunityStats(result.Count, result.Average, scale)
+	stats["item_id"] = itemId
+	stats["rating_scale"] = scale
+	stats["criteria"] = criteria
+	c.JSON(http.StatusOK, stats)
 }
 
 // Bulk make all user's ratings private
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -54,6 +55,15 @@ func parseFieldDisplayValue(display *string) interface{} {
 	return v
 }
 
+// ratingCriteriaValue returns criteria for a response, as an empty list when
+// there are none
+func ratingCriteriaValue(criteria []services.RatingCriterion) []services.RatingCriterion {
+	if criteria == nil {
+		return []services.RatingCriterion{}
+	}
+	return criteria
+}
+
 func parseUniqueFields(uniqueFields string) []string {
 	if uniqueFields == "" || uniqueFields == "null" {
 		return []string{}
@@ -65,6 +75,42 @@ func parseUniqueFields(uniqueFields string) []string {
 	return result
 }
 
+// parseRatingScaleBody validates a rating scale from a request body and returns
+// it as stored; JSON null resets the schema to the default scale
+func parseRatingScaleBody(raw json.RawMessage) (*string, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	var scale services.RatingScale
+	if err := json.Unmarshal(raw, &scale); err != nil {
+		return nil, fmt.Errorf("invalid rating scale: %v", err)
+	}
+	if err := scale.Validate(); err != nil {
+		return nil, err
+	}
+	scaleJSON, _ := json.Marshal(scale)
+	stored := string(scaleJSON)
+	return &stored, nil
+}
+
+// parseRatingCriteriaBody validates rating criteria from a request body and
+// returns them as stored; JSON null or an empty list removes them
+func parseRatingCriteriaBody(raw json.RawMessage) (*string, error) {
+	var criteria []services.RatingCriterion
+	if err := json.Unmarshal(raw, &criteria); err != nil {
+		return nil, fmt.Errorf("invalid rating criteria: %v", err)
+	}
+	if len(criteria) == 0 {
+		return nil, nil
+	}
+	if err := services.ValidateRatingCriteria(criteria); err != nil {
+		return nil, err
+	}
+	criteriaJSON, _ := json.Marshal(criteria)
+	stored := string(criteriaJSON)
+	return &stored, nil
+}
+
 func SchemaList(c *gin.Context) {
 	includeCounts := c.Query("include_counts") == "true"
 	includeInactive := c.Query("include_inactive") == "true"
@@ -115,15 +161,17 @@ func SchemaList(c *gin.Context) {
 		}
 
 		schemaData := map[string]interface{}{
-			"id":            cached.Schema.ID,
-			"name":          cached.Schema.Name,
-			"display_name":  cached.Schema.DisplayName,
-			"plural_name":   cached.Schema.PluralName,
-			"icon":          cached.Schema.Icon,
-			"color":         cached.Schema.Color,
-			"is_active":     cached.Schema.IsActive,
-			"unique_fields": parseUniqueFields(cached.Schema.UniqueFields),
-			"fields":        fields,
+			"id":              cached.Schema.ID,
+			"name":            cached.Schema.Name,
+			"display_name":    cached.Schema.DisplayName,
+			"plural_name":     cached.Schema.PluralName,
+			"icon":            cached.Schema.Icon,
+			"color":           cached.Schema.Color,
+			"is_active":       cached.Schema.IsActive,
+			"unique_fields":   parseUniqueFields(cached.Schema.UniqueFields),
+			"rating_scale":    cached.RatingScale(),
+			"rating_criteria": ratingCriteriaValue(cached.RatingCriteria()),
+			"fields":          fields,
 		}
 
 		if includeCounts {
@@ -249,31 +297,38 @@ func buildSchemaDetailResponse(schema *models.ItemTypeSchema, fields []models.It
 		json.Unmarshal([]byte(schema.UniqueFields), &uniqueFields)
 	}
 
+	ratingScale, _ := services.ParseRatingScale(schema.RatingScale)
+	ratingCriteria, _ := services.ParseRatingCriteria(schema.RatingCriteria)
+
 	return map[string]interface{}{
-		"name":          schema.Name,
-		"display_name":  schema.DisplayName,
-		"plural_name":   schema.PluralName,
-		"icon":          schema.Icon,
-		"color":         schema.Color,
-		"is_active":     schema.IsActive,
-		"unique_fields": uniqueFields,
-		"version":       version,
-		"version_hash":  versionHash,
-		"item_count":    itemCount,
-		"fields":        fieldsData,
-		"versions":      serializeVersions(allVersions),
+		"name":            schema.Name,
+		"display_name":    schema.DisplayName,
+		"plural_name":     schema.PluralName,
+		"icon":            schema.Icon,
+		"color":           schema.Color,
+		"is_active":       schema.IsActive,
+		"unique_fields":   uniqueFields,
+		"rating_scale":    ratingScale,
+		"rating_criteria": ratingCriteriaValue(ratingCriteria),
+		"version":         version,
+		"version_hash":    versionHash,
+		"item_count":      itemCount,
+		"fields":          fieldsData,
+		"versions":        serializeVersions(allVersions),
 	}
 }
 
 func SchemaCreate(c *gin.Context) {
 	var body struct {
-		Name         string                   `json:"name"`
-		DisplayName  string                   `json:"display_name"`
-		PluralName   string                   `json:"plural_name"`
-		Icon         string                   `json:"icon"`
-		Color        string                   `json:"color"`
-		UniqueFields []string                 `json:"unique_fields"`
-		Fields       []map[string]interface{} `json:"fields"`
+		Name           string                   `json:"name"`
+		DisplayName    string                   `json:"display_name"`
+		PluralName     string                   `json:"plural_name"`
+		Icon           string                   `json:"icon"`
+		Color          string                   `json:"color"`
+		UniqueFields   []string                 `json:"unique_fields"`
+		RatingScale    json.RawMessage          `json:"rating_scale"`
+		RatingCriteria json.RawMessage          `json:"rating_criteria"`
+		Fields         []map[string]interface{} `json:"fields"`
 	}
 
 	if err := c.Bind(&body); err != nil {
@@ -293,13 +348,34 @@ func SchemaCreate(c *gin.Context) {
 		return
 	}
 
+	var ratingScale *string
+	if len(body.RatingScale) > 0 {
+		scale, err := parseRatingScaleBody(body.RatingScale)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ratingScale = scale
+	}
+	var ratingCriteria *string
+	if len(body.RatingCriteria) > 0 {
+		criteria, err := parseRatingCriteriaBody(body.RatingCriteria)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ratingCriteria = criteria
+	}
+
 	schema := models.ItemTypeSchema{
-		Name:        body.Name,
-		DisplayName: body.DisplayName,
-		PluralName:  body.PluralName,
-		Icon:        body.Icon,
-		Color:       body.Color,
-		IsActive:    true,
+		Name:           body.Name,
+		DisplayName:    body.DisplayName,
+		PluralName:     body.PluralName,
+		Icon:           body.Icon,
+		Color:          body.Color,
+		IsActive:       true,
+		RatingScale:    ratingScale,
+		RatingCriteria: ratingCriteria,
 	}
 
 	if len(body.UniqueFields) > 0 {
@@ -430,13 +506,15 @@ func SchemaUpdate(c *gin.Context) {
 
 func processSchemaUpdate(c *gin.Context, schemaID uint, schemaName string) {
 	var body struct {
-		DisplayName  string                   `json:"display_name"`
-		PluralName   string                   `json:"plural_name"`
-		Icon         string                   `json:"icon"`
-		Color        string                   `json:"color"`
-		IsActive     *bool                    `json:"is_active"`
-		UniqueFields []string                 `json:"unique_fields"`
-		Fields       []map[string]interface{} `json:"fields"`
+		DisplayName    string                   `json:"display_name"`
+		PluralName     string                   `json:"plural_name"`
+		Icon           string                   `json:"icon"`
+		Color          string                   `json:"color"`
+		IsActive       *bool                    `json:"is_active"`
+		UniqueFields   []string                 `json:"unique_fields"`
+		RatingScale    json.RawMessage          `json:"rating_scale"`
+		RatingCriteria json.RawMessage          `json:"rating_criteria"`
+		Fields         []map[string]interface{} `json:"fields"`
 	}
 
 	if err := c.Bind(&body); err != nil {
@@ -444,6 +522,27 @@ func processSchemaUpdate(c *gin.Context, schemaID uint, schemaName string) {
 		return
 	}
 
+	// Existing grades and criterion scores are converted to a new scale along with
+	// the update
+	var ratingScale *string
+	if len(body.RatingScale) > 0 {
+		scale, err := parseRatingScaleBody(body.RatingScale)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ratingScale = scale
+	}
+	var ratingCriteria *string
+	if len(body.RatingCriteria) > 0 {
+		criteria, err := parseRatingCriteriaBody(body.RatingCriteria)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ratingCriteria = criteria
+	}
+
 	tx := utils.DB.Begin()
 
 	updates := map[string]interface{}{}
@@ -471,6 +570,36 @@ func processSchemaUpdate(c *gin.Context, schemaID uint, schemaName string) {
 		}
 		updates["unique_fields"] = string(uniqueFieldsJSON)
 	}
+	if len(body.RatingScale) > 0 || len(body.RatingCriteria) > 0 {
+		var current models.ItemTypeSchema
+		if err := tx.Select("id, rating_scale, rating_criteria").First(&current, schemaID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load schema"})
+			return
+		}
+		fromScale, _ := services.ParseRatingScale(current.RatingScale)
+		fromCriteria, _ := services.ParseRatingCriteria(current.RatingCriteria)
+		toScale, toCriteria := fromScale, fromCriteria
+		if len(body.RatingScale) > 0 {
+			toScale, _ = services.ParseRatingScale(ratingScale)
+			updates["rating_scale"] = ratingScale
+		}
+		if len(body.RatingCriteria) > 0 {
+			toCriteria, _ = services.ParseRatingCriteria(ratingCriteria)
+			updates["rating_criteria"] = ratingCriteria
+		}
+
+		if _, err := services.RescaleRatings(tx, schemaID, fromScale, toScale); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := services.RescaleRatingScores(tx, schemaID, fromScale, toScale, fromCriteria, toCriteria); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	if len(updates) > 0 {
 		if err := tx.Model(&models.ItemTypeSchema{}).Where("id = ?", schemaID).Updates(updates).Error; err != nil {
 			tx.Rollback()
@@ -693,10 +822,10 @@ func SchemaVersionHistory(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"version":     schemaVersion.Version,
-		"fields":      fields,
-		"is_active":   schemaVersion.IsActive,
-		"created_at":  schemaVersion.CreatedAt,
+		"version":    schemaVersion.Version,
+		"fields":     fields,
+		"is_active":  schemaVersion.IsActive,
+		"created_at": schemaVersion.CreatedAt,
 	})
 }
 
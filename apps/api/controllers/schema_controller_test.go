@@ -254,6 +254,125 @@ func TestSchemaUpdate(t *testing.T) {
 	}
 }
 
+func TestSchemaUpdate_RatingScale(t *testing.T) {
+	router, token, cleanup := setupControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"rating_scale": map[string]interface{}{"min": 0, "max": 10, "step": 3}})
+	w := performRequest(router, "PUT", "/admin/schemas/cheese", token, bodyJSON)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an uneven scale to be refused, got %d", w.Code)
+	}
+
+	bodyJSON, _ = json.Marshal(map[string]interface{}{
+		"rating_scale": map[string]interface{}{"min": 0, "max": 10, "step": 0.5, "labels": map[string]string{"10": "Exceptional"}},
+	})
+	w = performRequest(router, "PUT", "/admin/schemas/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = performRequest(router, "GET", "/api/schemas/cheese", token, nil)
+	var details struct {
+		RatingScale services.RatingScale `json:"rating_scale"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &details)
+	if details.RatingScale.Max != 10 || details.RatingScale.Labels["10"] != "Exceptional" {
+		t.Errorf("expected the new scale in the schema, got %+v", details.RatingScale)
+	}
+
+	// null goes back to the default scale
+	w = performRequest(router, "PUT", "/admin/schemas/cheese", token, []byte(`{"rating_scale":null}`))
+	var schema models.ItemTypeSchema
+	utils.DB.Where("name = ?", "cheese").First(&schema)
+	if w.Code != http.StatusOK || schema.RatingScale != nil {
+		t.Errorf("expected the scale to be reset, got %d and %v", w.Code, schema.RatingScale)
+	}
+}
+
+func TestSchemaUpdate_RatingScaleRescalesGrades(t *testing.T) {
+	router, token, cleanup := setupControllerTest(t)
+	defer cleanup()
+
+	var cheeseSchema models.ItemTypeSchema
+	utils.DB.Where("name = ?", "cheese").First(&cheeseSchema)
+
+	item := models.Item{Name: "Rescaled Cheese", SchemaID: cheeseSchema.ID, UserID: 1, FieldValues: "{}"}
+	utils.DB.Create(&item)
+	rating := models.Rating{Grade: 4.5, UserID: 1, ItemID: int(item.ID)}
+	if err := utils.DB.Create(&rating).Error; err != nil {
+		t.Fatalf("failed to create rating: %v", err)
+	}
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"rating_scale": map[string]interface{}{"min": 0, "max": 100, "step": 1}})
+	w := performRequest(router, "PUT", "/admin/schemas/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	utils.DB.First(&rating, rating.ID)
+	if rating.Grade != 90 {
+		t.Errorf("expected 4.5 out of 5 to become 90 out of 100, got %v", rating.Grade)
+	}
+}
+
+func TestSchemaUpdate_RatingCriteriaRescalesScores(t *testing.T) {
+	router, token, cleanup := setupControllerTest(t)
+	defer cleanup()
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{"rating_criteria": []map[string]interface{}{
+		{"key": "taste", "label": "Taste"},
+		{"key": "texture", "label": "Texture", "scale": map[string]interface{}{"min": 0, "max": 10, "step": 1}},
+	}})
+	w := performRequest(router, "PUT", "/admin/schemas/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var cheeseSchema models.ItemTypeSchema
+	utils.DB.Where("name = ?", "cheese").First(&cheeseSchema)
+	item := models.Item{Name: "Scored Cheese", SchemaID: cheeseSchema.ID, UserID: 1, FieldValues: "{}"}
+	utils.DB.Create(&item)
+	rating := models.Rating{Grade: 4, UserID: 1, ItemID: int(item.ID)}
+	utils.DB.Create(&rating)
+	if err := services.SaveRatingScores(utils.DB, rating.ID, map[string]float64{"taste": 4, "texture": 5}); err != nil {
+		t.Fatalf("failed to save scores: %v", err)
+	}
+
+	// Taste follows the schema scale; texture keeps its own
+	bodyJSON, _ = json.Marshal(map[string]interface{}{"rating_scale": map[string]interface{}{"min": 0, "max": 100, "step": 1}})
+	w = performRequest(router, "PUT", "/admin/schemas/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	scores := func() map[string]float32 {
+		var rows []models.RatingScore
+		utils.DB.Where("rating_id = ?", rating.ID).Find(&rows)
+		byKey := map[string]float32{}
+		for _, row := range rows {
+			byKey[row.CriterionKey] = row.Score
+		}
+		return byKey
+	}
+	if got := scores(); got["taste"] != 80 || got["texture"] != 5 {
+		t.Errorf("expected taste 80 and texture 5, got %v", got)
+	}
+
+	// Giving texture a scale of its own converts its scores
+	bodyJSON, _ = json.Marshal(map[string]interface{}{"rating_criteria": []map[string]interface{}{
+		{"key": "taste", "label": "Taste"},
+		{"key": "texture", "label": "Texture", "scale": map[string]interface{}{"min": 0, "max": 5, "step": 0.5}},
+	}})
+	w = performRequest(router, "PUT", "/admin/schemas/cheese", token, bodyJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := scores(); got["taste"] != 80 || got["texture"] != 2.5 {
+		t.Errorf("expected taste 80 and texture 2.5, got %v", got)
+	}
+}
+
 func TestSchemaDelete_Empty(t *testing.T) {
 	router, token, cleanup := setupControllerTest(t)
 	defer cleanup()
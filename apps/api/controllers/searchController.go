@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/davidcharbonnier/alacarte-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GlobalSearch searches every active schema at once and returns the hits grouped by type
+func GlobalSearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "5"))
+
+	result, err := queryBuilder.SearchAll(services.SearchParams{
+		Query:   query,
+		Types:   parseCSVParam(c.Query("types")),
+		Page:    page,
+		PerPage: perPage,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups := make([]gin.H, 0, len(result.Groups))
+	counts := make(map[string]int64, len(result.Groups))
+	for _, group := range result.Groups {
+		counts[group.Schema.Schema.Name] = group.Total
+		groups = append(groups, gin.H{
+			"schema_type":  group.Schema.Schema.Name,
+			"display_name": group.Schema.Schema.DisplayName,
+			"plural_name":  group.Schema.Schema.PluralName,
+			"icon":         group.Schema.Schema.Icon,
+			"color":        group.Schema.Schema.Color,
+			"items":        group.Items,
+			"total":        group.Total,
+			"page":         group.Page,
+			"per_page":     group.PerPage,
+			"total_pages":  group.TotalPages,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":  result.Query,
+		"total":  result.Total,
+		"counts": counts,
+		"groups": groups,
+	})
+}
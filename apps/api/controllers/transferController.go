@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// TransferAccept makes the current user the owner of the item offered to them
+func TransferAccept(c *gin.Context) {
+	id, userID, ok := transferRequest(c)
+	if !ok {
+		return
+	}
+
+	item, err := queryBuilder.AcceptTransfer(id, userID)
+	if err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	var acceptedItem *map[string]interface{}
+	if cached, ok := schemaRegistry.GetSchemaByID(item.SchemaID); ok {
+		if acceptedItem, err = queryBuilder.GetItem(cached.Schema.Name, item.ID); err != nil {
+			log.Printf("WARNING: failed to fetch item %d after transfer: %v", item.ID, err)
+		}
+	}
+	if acceptedItem != nil {
+		setItemETag(c, *acceptedItem)
+		c.JSON(http.StatusOK, acceptedItem)
+	} else {
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// TransferDecline turns down an item offered to the current user
+func TransferDecline(c *gin.Context) {
+	id, userID, ok := transferRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := queryBuilder.DeclineTransfer(id, userID); err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer declined"})
+}
+
+// TransferCancel withdraws a transfer the current user offered
+func TransferCancel(c *gin.Context) {
+	id, userID, ok := transferRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := queryBuilder.CancelTransfer(id, userID); err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer cancelled"})
+}
+
+func transferRequest(c *gin.Context) (uint, uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return 0, 0, false
+	}
+
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return 0, 0, false
+	}
+
+	return uint(id), userID, true
+}
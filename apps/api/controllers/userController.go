@@ -2,10 +2,13 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/services"
 	"github.com/davidcharbonnier/alacarte-api/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Get users available for sharing (discoverable + previous connections)
@@ -116,7 +119,74 @@ func GetCurrentUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-// Delete current user account (CASCADE deletion)
+// GetCurrentUserTrash lists the current user's trashed items across all schemas
+func GetCurrentUserTrash(c *gin.Context) {
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	params := services.TrashParams{OwnerID: userID}
+	params.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	params.PerPage, _ = strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	respondTrash(c, params)
+}
+
+// GetCurrentUserSuggestions lists the edits the current user suggested, with
+// their review status, across all schemas
+func GetCurrentUserSuggestions(c *gin.Context) {
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	params := services.SuggestionParams{
+		SubmitterID: userID,
+		Status:      models.SuggestionStatus(c.Query("status")),
+	}
+	params.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	params.PerPage, _ = strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	respondSuggestions(c, params)
+}
+
+// GetCurrentUserTransfers lists item transfers offered to or by the current user.
+// Filter with ?direction=incoming|outgoing and ?status=pending.
+func GetCurrentUserTransfers(c *gin.Context) {
+	userID := utils.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	params := services.TransferParams{
+		UserID:    userID,
+		Direction: c.Query("direction"),
+		Status:    models.TransferStatus(c.Query("status")),
+	}
+	params.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	params.PerPage, _ = strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	result, err := queryBuilder.ListTransfers(params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transfers":   result.Transfers,
+		"total":       result.Total,
+		"page":        result.Page,
+		"per_page":    result.PerPage,
+		"total_pages": result.TotalPages,
+	})
+}
+
+// Delete current user account. Catalog items the user created are handed to the
+// system owner so they stay available to everyone who rated them.
 func DeleteCurrentUser(c *gin.Context) {
 	userID := utils.GetCurrentUserID(c)
 
@@ -127,18 +197,31 @@ func DeleteCurrentUser(c *gin.Context) {
 		return
 	}
 
-	// Database CASCADE will automatically handle:
-	// - Delete all user's ratings (ratings.user_id → CASCADE)
-	// - Remove user from rating_viewers many-to-many relationships
-	// - Delete user account
-	if err := utils.DB.Delete(&models.User{}, userID).Error; err != nil {
+	reassigned := 0
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		owner, err := services.SystemOwner(tx)
+		if err != nil {
+			return err
+		}
+		if reassigned, err = services.ReassignUserItems(tx, userID, owner.ID, userID); err != nil {
+			return err
+		}
+
+		// Database CASCADE will automatically handle:
+		// - Delete all user's ratings (ratings.user_id → CASCADE)
+		// - Remove user from rating_viewers many-to-many relationships
+		// - Delete user account
+		return tx.Delete(&models.User{}, userID).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":      "Account deleted successfully",
-		"deleted_user": user.DisplayName,
+		"message":          "Account deleted successfully",
+		"deleted_user":     user.DisplayName,
+		"items_reassigned": reassigned,
 	})
 }
 
@@ -216,13 +299,19 @@ func GetUserDeleteImpact(c *gin.Context) {
 		sharingsCount += count
 	}
 
+	// Catalog items are kept and reassigned, trashed ones included
+	var itemsCount int64
+	utils.DB.Unscoped().Model(&models.Item{}).Where("user_id = ?", userID).Count(&itemsCount)
+
 	c.JSON(http.StatusOK, gin.H{
 		"can_delete": true,
 		"warnings": []string{
 			"This will delete all of the user's ratings",
 			"Other users will lose shared ratings from this user",
+			"The user's catalog items will be reassigned, to the system owner unless another user is given",
 		},
 		"impact": gin.H{
+			"items_count":    itemsCount,
 			"ratings_count":  len(ratings),
 			"users_affected": len(affectedUserMap),
 			"sharings_count": sharingsCount,
@@ -242,9 +331,32 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if user.GoogleID == services.SystemOwnerGoogleID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The system owner cannot be deleted"})
+		return
+	}
+
 	// Start transaction
 	tx := utils.DB.Begin()
 
+	// Items go to ?reassign_to when given, to the system owner otherwise
+	var newOwner models.User
+	if reassignTo := c.Query("reassign_to"); reassignTo != "" {
+		if err := tx.First(&newOwner, reassignTo).Error; err != nil || newOwner.ID == user.ID {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reassign_to user"})
+			return
+		}
+	} else {
+		owner, err := services.SystemOwner(tx)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign items"})
+			return
+		}
+		newOwner = *owner
+	}
+
 	// Get all ratings by this user
 	var ratings []models.Rating
 	tx.Where("user_id = ?", userID).Find(&ratings)
@@ -263,6 +375,13 @@ func DeleteUser(c *gin.Context) {
 	// Delete sharing relationships
 	tx.Exec("DELETE FROM sharing_relationships WHERE user_a_id = ? OR user_b_id = ?", userID, userID)
 
+	// Hand the user's catalog items over instead of losing them
+	if _, err := services.ReassignUserItems(tx, user.ID, newOwner.ID, utils.GetCurrentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign items"})
+		return
+	}
+
 	// Delete the user
 	if err := tx.Delete(&user).Error; err != nil {
 		tx.Rollback()
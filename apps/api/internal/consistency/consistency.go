@@ -0,0 +1,81 @@
+package consistency
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/davidcharbonnier/alacarte-api/services"
+)
+
+// RunConsistencyCheck checks the field values of every item, or of the schema
+// named by CONSISTENCY_SCHEMA, and repairs them from the copy named by
+// CONSISTENCY_REPAIR (eav or json) when it is set
+func RunConsistencyCheck() error {
+	fmt.Println("=============================================")
+	fmt.Println("  A LA CARTE - CONSISTENCY CHECK")
+	fmt.Println("=============================================")
+	fmt.Println()
+
+	registry := services.GetSchemaRegistry()
+	if err := registry.LoadSchemas(); err != nil {
+		fmt.Println("❌ Failed to load schemas:", err)
+		return err
+	}
+
+	opts := services.ConsistencyOptions{Repair: os.Getenv("CONSISTENCY_REPAIR")}
+	if opts.Repair != "" {
+		fmt.Printf("Repairing from %s...\n", opts.Repair)
+	}
+
+	report, err := services.NewEAVQueryBuilder(registry).CheckConsistency(os.Getenv("CONSISTENCY_SCHEMA"), opts)
+	if report != nil {
+		printReport(report)
+	}
+	if err != nil {
+		fmt.Println("❌ Check failed:", err)
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("=============================================")
+	if report.ItemsWithIssues == 0 {
+		fmt.Println("  NO ISSUES FOUND")
+	} else if opts.Repair != "" && len(report.RepairErrors) == 0 {
+		fmt.Println("  REPAIR SUCCESSFUL")
+	} else {
+		fmt.Println("  ISSUES FOUND")
+	}
+	fmt.Println("=============================================")
+	return nil
+}
+
+func printReport(report *services.ConsistencyReport) {
+	fmt.Printf("  ✓ Checked %d items in %d schemas\n", report.ItemsChecked, len(report.Schemas))
+	if report.ItemsWithIssues == 0 {
+		return
+	}
+
+	fmt.Printf("  ⚠️  %d items with issues\n", report.ItemsWithIssues)
+	kinds := make([]string, 0, len(report.IssueCounts))
+	for kind := range report.IssueCounts {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("     %s: %d\n", kind, report.IssueCounts[services.ConsistencyIssueKind(kind)])
+	}
+	for _, issue := range report.Issues {
+		fmt.Printf("     %s #%d [%s] %s\n", issue.Schema, issue.ItemID, issue.Kind, issue.Message)
+	}
+	if report.Truncated {
+		fmt.Printf("     ... only the first %d issues are listed\n", len(report.Issues))
+	}
+
+	if report.Repair != "" {
+		fmt.Printf("  ✓ Repaired %d items\n", report.Repaired)
+		for _, message := range report.RepairErrors {
+			fmt.Printf("  ⚠️  %s\n", message)
+		}
+	}
+}
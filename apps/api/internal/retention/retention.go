@@ -0,0 +1,70 @@
+package retention
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/services"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+)
+
+// DefaultTrashRetentionDays is how long trashed items are kept when
+// TRASH_RETENTION_DAYS is not set
+const DefaultTrashRetentionDays = 30
+
+// RunTrashPurge permanently deletes items that have been in the trash for longer
+// than TRASH_RETENTION_DAYS, along with their images
+func RunTrashPurge() error {
+	fmt.Println("=============================================")
+	fmt.Println("  A LA CARTE - TRASH PURGE")
+	fmt.Println("=============================================")
+	fmt.Println()
+
+	days, err := retentionDays()
+	if err != nil {
+		fmt.Println("❌ Invalid configuration:", err)
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	fmt.Printf("Purging items trashed before %s (%d days)...\n", cutoff.Format(time.RFC3339), days)
+
+	result, err := services.PurgeTrashedItems(cutoff)
+	if result != nil {
+		fmt.Printf("  ✓ Purged %d items\n", result.Purged)
+		deleteImages(result.ImageURLs)
+	}
+	if err != nil {
+		fmt.Println("❌ Purge failed:", err)
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("=============================================")
+	fmt.Println("  PURGE SUCCESSFUL")
+	fmt.Println("=============================================")
+	return nil
+}
+
+func retentionDays() (int, error) {
+	value := utils.GetEnv("TRASH_RETENTION_DAYS", strconv.Itoa(DefaultTrashRetentionDays))
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		return 0, fmt.Errorf("TRASH_RETENTION_DAYS must be a positive number of days, got %q", value)
+	}
+	return days, nil
+}
+
+func deleteImages(imageURLs []string) {
+	failed := 0
+	for _, imageURL := range imageURLs {
+		if err := utils.DeleteImageURLFromStorage(imageURL); err != nil {
+			fmt.Printf("  ⚠️  %v\n", err)
+			failed++
+		}
+	}
+	if len(imageURLs) > 0 {
+		fmt.Printf("  ✓ Deleted %d of %d images\n", len(imageURLs)-failed, len(imageURLs))
+	}
+}
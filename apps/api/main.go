@@ -8,6 +8,8 @@ import (
 
 	"github.com/davidcharbonnier/alacarte-api/controllers"
 	"github.com/davidcharbonnier/alacarte-api/internal/cleanup"
+	"github.com/davidcharbonnier/alacarte-api/internal/consistency"
+	"github.com/davidcharbonnier/alacarte-api/internal/retention"
 	"github.com/davidcharbonnier/alacarte-api/services"
 	"github.com/davidcharbonnier/alacarte-api/utils"
 	"github.com/gin-contrib/cors"
@@ -38,6 +40,26 @@ func main() {
 
 	utils.InitStorageClient()
 
+	// Check for trash purge mode (scheduled Cloud Run Job mode)
+	if os.Getenv("RUN_TRASH_PURGE") == "true" {
+		fmt.Println("🚀 Running in trash purge mode")
+		if err := retention.RunTrashPurge(); err != nil {
+			fmt.Println("❌ Trash purge failed:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Check for consistency check mode (Cloud Run Job mode)
+	if os.Getenv("RUN_CONSISTENCY_CHECK") == "true" {
+		fmt.Println("🚀 Running in consistency check mode")
+		if err := consistency.RunConsistencyCheck(); err != nil {
+			fmt.Println("❌ Consistency check failed:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Load schemas into registry
 	schemaRegistry := services.GetSchemaRegistry()
 	if err := schemaRegistry.LoadSchemas(); err != nil {
@@ -46,6 +68,15 @@ func main() {
 		fmt.Printf("Loaded %d schemas into registry\n", len(schemaRegistry.GetAllSchemas()))
 	}
 
+	// Create the account that keeps the items of deleted users now, so its
+	// display name is taken before anyone can pick it
+	if _, err := services.SystemOwner(utils.DB); err != nil {
+		fmt.Printf("Warning: Failed to set up the system owner: %v\n", err)
+	}
+
+	// Run seed and import jobs, resuming any left unfinished by a restart
+	services.GetJobRunner().Start()
+
 	// Set gin mode from env
 	if ginMode, defined := os.LookupEnv("GIN_MODE"); defined {
 		gin.SetMode(ginMode)
@@ -106,6 +137,17 @@ func main() {
 			user.GET("/me", controllers.GetCurrentUser)
 			user.PATCH("/me", controllers.UpdateCurrentUser)
 			user.DELETE("/me", controllers.DeleteCurrentUser)
+			user.GET("/me/trash", controllers.GetCurrentUserTrash)
+			user.GET("/me/suggestions", controllers.GetCurrentUserSuggestions)
+			user.GET("/me/transfers", controllers.GetCurrentUserTransfers)
+		}
+
+		// Item ownership transfers
+		transfers := api.Group("/transfers")
+		{
+			transfers.POST("/:id/accept", controllers.TransferAccept)
+			transfers.POST("/:id/decline", controllers.TransferDecline)
+			transfers.POST("/:id/cancel", controllers.TransferCancel)
 		}
 
 		// User discovery
@@ -138,14 +180,36 @@ func main() {
 			stats.GET("/type/:type", controllers.GetTypeStats)
 		}
 
+		// Cross-schema search
+		api.GET("/search", controllers.GlobalSearch)
+
 		// Dynamic items
 		items := api.Group("/items")
 		{
 			items.GET("/:type", controllers.DynamicItemList)
+			items.GET("/:type/export", controllers.DynamicItemExport)
+			items.GET("/:type/trash", controllers.DynamicItemTrash)
+			items.GET("/:type/suggestions", controllers.DynamicItemSuggestions)
+			items.GET("/:type/suggestions/:suggestion", controllers.DynamicItemSuggestion)
 			items.GET("/:type/:id", controllers.DynamicItemDetails)
+			items.GET("/:type/fields/:key/suggest", controllers.DynamicItemFieldSuggest)
 			items.POST("/:type", controllers.DynamicItemCreate)
+			items.POST("/:type/batch", controllers.DynamicItemBatch)
 			items.PUT("/:type/:id", controllers.DynamicItemUpdate)
+			items.PATCH("/:type/:id", controllers.DynamicItemPatch)
 			items.DELETE("/:type/:id", controllers.DynamicItemDelete)
+			items.GET("/:type/:id/history", controllers.DynamicItemHistory)
+			items.POST("/:type/:id/history/:revision/revert", controllers.DynamicItemRevert)
+			items.POST("/:type/:id/restore", controllers.DynamicItemRestore)
+			items.GET("/:type/:id/editors", controllers.DynamicItemEditors)
+			items.POST("/:type/:id/editors", controllers.DynamicItemGrantEditor)
+			items.DELETE("/:type/:id/editors/:userId", controllers.DynamicItemRevokeEditor)
+			items.POST("/:type/:id/transfer", controllers.DynamicItemTransfer)
+			items.GET("/:type/:id/suggestions", controllers.DynamicItemSuggestions)
+			items.POST("/:type/:id/suggestions", controllers.DynamicItemSuggest)
+			items.POST("/:type/suggestions/:suggestion/accept", controllers.DynamicItemAcceptSuggestion)
+			items.POST("/:type/suggestions/:suggestion/reject", controllers.DynamicItemRejectSuggestion)
+			items.POST("/:type/suggestions/:suggestion/comments", controllers.DynamicItemCommentSuggestion)
 			items.POST("/:type/:id/image", controllers.DynamicItemUploadImage)
 			items.DELETE("/:type/:id/image", controllers.DynamicItemDeleteImage)
 		}
@@ -191,8 +255,29 @@ func main() {
 		itemAdmin := admin.Group("/items")
 		{
 			itemAdmin.GET("/:type/:id/delete-impact", controllers.DynamicItemDeleteImpact)
+			itemAdmin.DELETE("/:type/:id/purge", controllers.DynamicItemPurge)
+			itemAdmin.GET("/:type/duplicates", controllers.DynamicItemDuplicates)
+			itemAdmin.POST("/:type/merge", controllers.DynamicItemMerge)
+			itemAdmin.PUT("/:type/:id/owner", controllers.DynamicItemReassign)
 			itemAdmin.POST("/:type/seed", controllers.DynamicItemSeed)
 			itemAdmin.POST("/:type/validate", controllers.DynamicItemValidate)
+			itemAdmin.POST("/:type/import", controllers.DynamicItemImport)
+			itemAdmin.POST("/:type/generate", controllers.DynamicItemGenerate)
+		}
+
+		// Background seed and import jobs
+		jobs := admin.Group("/jobs")
+		{
+			jobs.GET("", controllers.JobList)
+			jobs.GET("/:id", controllers.JobDetails)
+			jobs.POST("/:id/cancel", controllers.JobCancel)
+		}
+
+		// Field value storage consistency
+		consistencyAdmin := admin.Group("/consistency")
+		{
+			consistencyAdmin.GET("", controllers.ConsistencyCheck)
+			consistencyAdmin.POST("/repair", controllers.ConsistencyRepair)
 		}
 	}
 
@@ -215,7 +300,8 @@ func setupCORS() gin.HandlerFunc {
 		}
 	}
 
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "If-Match"}
+	config.ExposeHeaders = []string{"ETag", "Location"}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 	config.AllowCredentials = true
 
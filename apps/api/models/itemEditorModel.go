@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// ItemEditor grants a user the right to edit an item they do not own. Grants are
+// hard deleted on revoke, so a user can be granted again later.
+type ItemEditor struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ItemID    uint      `gorm:"not null;uniqueIndex:uk_item_editor" json:"item_id"`
+	UserID    int       `gorm:"not null;uniqueIndex:uk_item_editor;index" json:"user_id"`
+	GrantedBy int       `gorm:"not null" json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Item      Item      `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE" json:"-"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (ItemEditor) TableName() string {
+	return "item_editors"
+}
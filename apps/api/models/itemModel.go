@@ -13,8 +13,9 @@ type Item struct {
 	FieldValues     string           `gorm:"type:json" json:"field_values,omitempty"`
 	UserID          int              `gorm:"not null;index" json:"user_id"`
 	SchemaVersionID *uint            `gorm:"index" json:"schema_version_id,omitempty"`
+	Version         uint             `gorm:"not null;default:1" json:"version"`
 	Schema          ItemTypeSchema   `gorm:"foreignKey:SchemaID;constraint:OnDelete:CASCADE" json:"-"`
-	User            User             `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	User            User             `gorm:"foreignKey:UserID;constraint:OnDelete:RESTRICT" json:"-"`
 	FieldValuesRows []ItemFieldValue `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE" json:"-"`
 	Ratings         []Rating         `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE" json:"ratings,omitempty"`
 }
@@ -35,8 +36,8 @@ type ItemFieldValue struct {
 	gorm.Model
 	ID      uint          `gorm:"primaryKey" json:"id"`
 	ItemID  uint          `gorm:"not null;uniqueIndex:uk_item_field" json:"item_id"`
-	FieldID uint          `gorm:"not null;uniqueIndex:uk_item_field;index:idx_field_value" json:"field_id"`
-	Value   *string       `gorm:"type:text" json:"value,omitempty"`
+	FieldID uint          `gorm:"not null;uniqueIndex:uk_item_field;index:idx_field_value;index:idx_field_value_prefix,priority:1" json:"field_id"`
+	Value   *string       `gorm:"type:text;index:idx_field_value_prefix,priority:2,length:64" json:"value,omitempty"`
 	Item    Item          `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE" json:"-"`
 	Field   ItemTypeField `gorm:"foreignKey:FieldID;constraint:OnDelete:CASCADE" json:"-"`
 }
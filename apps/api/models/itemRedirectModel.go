@@ -0,0 +1,21 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// ItemRedirect remembers that an item was merged into another, so links to the
+// old ID keep working. Redirects are kept pointing at the final item when the
+// target is itself merged later.
+type ItemRedirect struct {
+	gorm.Model
+	ID         uint `gorm:"primaryKey" json:"id"`
+	SchemaID   uint `gorm:"not null" json:"schema_id"`
+	FromItemID uint `gorm:"not null;uniqueIndex:uk_item_redirect_from" json:"from_item_id"`
+	ToItemID   uint `gorm:"not null;index:idx_item_redirect_to" json:"to_item_id"`
+	UserID     int  `gorm:"not null" json:"user_id"`
+}
+
+func (ItemRedirect) TableName() string {
+	return "item_redirects"
+}
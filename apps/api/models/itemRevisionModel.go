@@ -0,0 +1,37 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type RevisionAction string
+
+const (
+	RevisionActionCreate  RevisionAction = "create"
+	RevisionActionUpdate  RevisionAction = "update"
+	RevisionActionDelete  RevisionAction = "delete"
+	RevisionActionRevert  RevisionAction = "revert"
+	RevisionActionRestore RevisionAction = "restore"
+	RevisionActionMerge   RevisionAction = "merge"
+	RevisionActionRepair  RevisionAction = "repair"
+)
+
+// ItemRevision records one change to an item's field values. Changes holds the
+// per-field diff of that change, Snapshot the full field values after it (or,
+// for a delete, at the time of deletion).
+type ItemRevision struct {
+	gorm.Model
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	ItemID          uint           `gorm:"not null;index:idx_item_revisions_item" json:"item_id"`
+	SchemaID        uint           `gorm:"not null" json:"schema_id"`
+	SchemaVersionID *uint          `json:"schema_version_id,omitempty"`
+	UserID          int            `gorm:"not null;index" json:"user_id"`
+	Action          RevisionAction `gorm:"type:varchar(20);not null" json:"action"`
+	Changes         string         `gorm:"type:json" json:"changes"`
+	Snapshot        string         `gorm:"type:json" json:"snapshot"`
+	Item            Item           `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (ItemRevision) TableName() string {
+	return "item_revisions"
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SuggestionStatus string
+
+const (
+	SuggestionStatusPending  SuggestionStatus = "pending"
+	SuggestionStatusAccepted SuggestionStatus = "accepted"
+	SuggestionStatusRejected SuggestionStatus = "rejected"
+)
+
+// ItemSuggestion is an edit proposed by someone who cannot change the item
+// directly. Changes holds the proposed values by field key, null clearing a
+// field, BaseVersion the item version they were proposed against, and
+// BaseValues the values of the same fields at that version.
+type ItemSuggestion struct {
+	gorm.Model
+	ID          uint                    `gorm:"primaryKey" json:"id"`
+	ItemID      uint                    `gorm:"not null;index:idx_item_suggestions_item" json:"item_id"`
+	SchemaID    uint                    `gorm:"not null;index" json:"schema_id"`
+	UserID      int                     `gorm:"not null;index" json:"user_id"`
+	Changes     string                  `gorm:"type:json" json:"changes"`
+	Message     string                  `gorm:"type:text" json:"message"`
+	BaseVersion uint                    `gorm:"not null" json:"base_version"`
+	BaseValues  string                  `gorm:"type:json" json:"base_values"`
+	Status      SuggestionStatus        `gorm:"type:varchar(20);not null;default:pending;index" json:"status"`
+	ReviewerID  *int                    `json:"reviewer_id,omitempty"`
+	ReviewedAt  *time.Time              `json:"reviewed_at,omitempty"`
+	Item        Item                    `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE" json:"-"`
+	User        User                    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Comments    []ItemSuggestionComment `gorm:"foreignKey:SuggestionID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (ItemSuggestion) TableName() string {
+	return "item_suggestions"
+}
+
+type ItemSuggestionComment struct {
+	gorm.Model
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	SuggestionID uint   `gorm:"not null;index" json:"suggestion_id"`
+	UserID       int    `gorm:"not null" json:"user_id"`
+	Body         string `gorm:"type:text;not null" json:"body"`
+	User         User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (ItemSuggestionComment) TableName() string {
+	return "item_suggestion_comments"
+}
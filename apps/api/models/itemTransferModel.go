@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TransferStatus string
+
+const (
+	TransferStatusPending   TransferStatus = "pending"
+	TransferStatusAccepted  TransferStatus = "accepted"
+	TransferStatusDeclined  TransferStatus = "declined"
+	TransferStatusCancelled TransferStatus = "cancelled"
+	// TransferStatusReassigned records an ownership change made without the
+	// recipient's consent: by an admin, or when the owner deleted their account
+	TransferStatusReassigned TransferStatus = "reassigned"
+)
+
+// ItemTransfer is a request to hand an item over to another user, who has to
+// accept it. Reassignments are recorded alongside so the ownership history of an
+// item is in one place. ActorID is who made the change.
+type ItemTransfer struct {
+	gorm.Model
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	ItemID      uint           `gorm:"not null;index:idx_item_transfers_item" json:"item_id"`
+	SchemaID    uint           `gorm:"not null" json:"schema_id"`
+	FromUserID  int            `gorm:"not null;index" json:"from_user_id"`
+	ToUserID    int            `gorm:"not null;index" json:"to_user_id"`
+	ActorID     int            `gorm:"not null" json:"actor_id"`
+	Status      TransferStatus `gorm:"type:varchar(20);not null;default:pending;index" json:"status"`
+	Message     string         `gorm:"type:text" json:"message,omitempty"`
+	RespondedAt *time.Time     `json:"responded_at,omitempty"`
+	Item        Item           `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (ItemTransfer) TableName() string {
+	return "item_transfers"
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type JobKind string
+
+const (
+	JobKindSeed     JobKind = "seed"
+	JobKindImport   JobKind = "import"
+	JobKindGenerate JobKind = "generate"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// Job is a seed or import run in the background. Payload holds the items and
+// options to apply; Processed counts the items already done, so an interrupted
+// job resumes where it stopped. HeartbeatAt is refreshed while a job runs, which
+// tells a job whose instance went away from one still in progress.
+type Job struct {
+	gorm.Model
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	Kind            JobKind    `gorm:"type:varchar(20);not null" json:"kind"`
+	SchemaName      string     `gorm:"type:varchar(100);not null" json:"schema"`
+	UserID          int        `gorm:"not null;index" json:"user_id"`
+	Status          JobStatus  `gorm:"type:varchar(20);not null;default:queued;index" json:"status"`
+	Payload         string     `gorm:"type:longtext" json:"-"`
+	Total           int        `gorm:"not null;default:0" json:"total"`
+	Processed       int        `gorm:"not null;default:0" json:"processed"`
+	Added           int        `gorm:"not null;default:0" json:"added"`
+	Updated         int        `gorm:"not null;default:0" json:"updated"`
+	Skipped         int        `gorm:"not null;default:0" json:"skipped"`
+	Errors          string     `gorm:"type:longtext" json:"-"`
+	Plan            string     `gorm:"type:longtext" json:"-"`
+	Error           string     `gorm:"type:text" json:"error,omitempty"`
+	CancelRequested bool       `gorm:"not null;default:false" json:"cancel_requested"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	HeartbeatAt     *time.Time `json:"-"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	User            User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// IsFinished reports whether the job has reached a final status
+func (j *Job) IsFinished() bool {
+	return j.Status == JobStatusCompleted || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
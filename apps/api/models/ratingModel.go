@@ -18,6 +18,10 @@ type Rating struct {
 
 	// Privacy - users who can see this rating
 	Viewers []User `gorm:"many2many:rating_viewers;" json:"viewers,omitempty"`
+
+	// Scores on the schema's rating criteria; Grade is then their weighted overall
+	// unless the user set it
+	Scores []RatingScore `gorm:"foreignKey:RatingID" json:"scores,omitempty"`
 }
 
 // Check if rating is visible to a specific user
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RatingScore is a rating's score on one of the rating criteria of its item's
+// schema, such as the nose of a wine
+type RatingScore struct {
+	gorm.Model
+	ID           uint    `gorm:"primaryKey" json:"id"`
+	RatingID     uint    `gorm:"not null;uniqueIndex:uk_rating_criterion" json:"rating_id"`
+	CriterionKey string  `gorm:"type:varchar(50);not null;uniqueIndex:uk_rating_criterion;index:idx_rating_score_criterion" json:"criterion"`
+	Score        float32 `gorm:"not null" json:"score"`
+	Rating       Rating  `gorm:"foreignKey:RatingID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (RatingScore) TableName() string {
+	return "rating_scores"
+}
@@ -17,17 +17,19 @@ const (
 
 type ItemTypeSchema struct {
 	gorm.Model
-	ID           uint            `gorm:"primaryKey" json:"id"`
-	Name         string          `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
-	DisplayName  string          `gorm:"type:varchar(100);not null" json:"display_name"`
-	PluralName   string          `gorm:"type:varchar(100);not null" json:"plural_name"`
-	Icon         string          `gorm:"type:varchar(50);not null" json:"icon"`
-	Color        string          `gorm:"type:varchar(7);not null" json:"color"`
-	IsActive     bool            `gorm:"default:true" json:"is_active"`
-	UniqueFields string          `gorm:"type:json" json:"unique_fields"`
-	Fields       []ItemTypeField `gorm:"foreignKey:SchemaID" json:"fields,omitempty"`
-	Versions     []SchemaVersion `gorm:"foreignKey:SchemaID" json:"versions,omitempty"`
-	Items        []Item          `gorm:"foreignKey:SchemaID" json:"items,omitempty"`
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	Name           string          `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	DisplayName    string          `gorm:"type:varchar(100);not null" json:"display_name"`
+	PluralName     string          `gorm:"type:varchar(100);not null" json:"plural_name"`
+	Icon           string          `gorm:"type:varchar(50);not null" json:"icon"`
+	Color          string          `gorm:"type:varchar(7);not null" json:"color"`
+	IsActive       bool            `gorm:"default:true" json:"is_active"`
+	UniqueFields   string          `gorm:"type:json" json:"unique_fields"`
+	RatingScale    *string         `gorm:"type:json" json:"rating_scale,omitempty"`
+	RatingCriteria *string         `gorm:"type:json" json:"rating_criteria,omitempty"`
+	Fields         []ItemTypeField `gorm:"foreignKey:SchemaID" json:"fields,omitempty"`
+	Versions       []SchemaVersion `gorm:"foreignKey:SchemaID" json:"versions,omitempty"`
+	Items          []Item          `gorm:"foreignKey:SchemaID" json:"items,omitempty"`
 }
 
 func (ItemTypeSchema) TableName() string {
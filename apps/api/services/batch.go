@@ -0,0 +1,243 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+)
+
+const (
+	// BatchModeAtomic applies every operation or none of them
+	BatchModeAtomic = "atomic"
+	// BatchModeBestEffort applies the operations that succeed and reports the others
+	BatchModeBestEffort = "best_effort"
+)
+
+const (
+	BatchStatusSucceeded  = "succeeded"
+	BatchStatusFailed     = "failed"
+	BatchStatusRolledBack = "rolled_back"
+	BatchStatusSkipped    = "skipped"
+)
+
+// MaxBatchOperations bounds the number of operations in a single batch
+const MaxBatchOperations = 500
+
+// BatchOperation is one create, update or delete of a batch. ID is required for
+// updates and deletes; Version, when set, makes the operation fail if the item
+// changed since that version.
+type BatchOperation struct {
+	Op      string                 `json:"op"`
+	ID      uint                   `json:"id,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Version *uint                  `json:"version,omitempty"`
+}
+
+type BatchOperationResult struct {
+	Index   int               `json:"index"`
+	Op      string            `json:"op"`
+	Status  string            `json:"status"`
+	ID      uint              `json:"id,omitempty"`
+	Version uint              `json:"version,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Errors  []ValidationError `json:"errors,omitempty"`
+}
+
+type BatchResult struct {
+	Mode      string                 `json:"mode"`
+	Committed bool                   `json:"committed"`
+	Succeeded int                    `json:"succeeded"`
+	Failed    int                    `json:"failed"`
+	Results   []BatchOperationResult `json:"results"`
+}
+
+// ExecuteBatch validates then applies a list of operations on items of one schema
+// in a single transaction. In atomic mode the first failure, whether validation
+// or write, rolls back the whole batch. In best effort mode each operation runs
+// under its own savepoint, so a failure only undoes that operation. Uniqueness is
+// checked against earlier operations of the same batch.
+func (qb *EAVQueryBuilder) ExecuteBatch(validator *ValidationEngine, schemaName string, userID uint, isAdmin bool, ops []BatchOperation, mode string) (*BatchResult, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Mode: mode, Results: make([]BatchOperationResult, len(ops))}
+	for i, op := range ops {
+		result.Results[i] = validateBatchOperation(validator, schemaName, i, op)
+	}
+
+	if mode == BatchModeAtomic && result.countStatus(BatchStatusFailed) > 0 {
+		result.markPending(BatchStatusSkipped)
+		result.tally()
+		return result, nil
+	}
+
+	tx := utils.DB.Begin()
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+
+	for i, op := range ops {
+		entry := &result.Results[i]
+		if entry.Status == BatchStatusFailed {
+			continue
+		}
+
+		savepoint := fmt.Sprintf("batch_op_%d", i)
+		if mode == BatchModeBestEffort {
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to create savepoint: %w", err)
+			}
+		}
+
+		if err := qb.applyBatchOperation(tx, cached, userID, isAdmin, op, entry); err != nil {
+			entry.Status = BatchStatusFailed
+			entry.Error = err.Error()
+
+			if mode == BatchModeAtomic {
+				tx.Rollback()
+				for j := range result.Results {
+					if result.Results[j].Status == BatchStatusSucceeded {
+						result.Results[j].Status = BatchStatusRolledBack
+					}
+				}
+				result.markPending(BatchStatusSkipped)
+				result.tally()
+				return result, nil
+			}
+
+			if err := tx.RollbackTo(savepoint).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to roll back to savepoint: %w", err)
+			}
+			continue
+		}
+
+		entry.Status = BatchStatusSucceeded
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	result.Committed = true
+	result.tally()
+	return result, nil
+}
+
+// validateBatchOperation checks an operation's shape and fields without touching
+// the database. A valid operation is returned with an empty status.
+func validateBatchOperation(validator *ValidationEngine, schemaName string, index int, op BatchOperation) BatchOperationResult {
+	entry := BatchOperationResult{Index: index, Op: op.Op, ID: op.ID}
+
+	switch op.Op {
+	case BatchOpCreate:
+		if op.ID != 0 {
+			entry.Status = BatchStatusFailed
+			entry.Error = "id must not be set for create"
+			return entry
+		}
+	case BatchOpUpdate, BatchOpDelete:
+		if op.ID == 0 {
+			entry.Status = BatchStatusFailed
+			entry.Error = "id is required"
+			return entry
+		}
+	default:
+		entry.Status = BatchStatusFailed
+		entry.Error = fmt.Sprintf("unknown op '%s'", op.Op)
+		return entry
+	}
+
+	var validation *ValidationResult
+	switch op.Op {
+	case BatchOpCreate:
+		validation = validator.ValidateCreate(schemaName, op.fieldsOrEmpty())
+	case BatchOpUpdate:
+		validation = validator.ValidateUpdate(schemaName, op.fieldsOrEmpty())
+	}
+	if validation != nil && !validation.Valid {
+		entry.Status = BatchStatusFailed
+		entry.Error = "validation_failed"
+		entry.Errors = validation.Errors
+	}
+
+	return entry
+}
+
+func (qb *EAVQueryBuilder) applyBatchOperation(tx *gorm.DB, cached *CachedSchema, userID uint, isAdmin bool, op BatchOperation, entry *BatchOperationResult) error {
+	var item *models.Item
+	var err error
+
+	switch op.Op {
+	case BatchOpCreate:
+		item, err = qb.createItem(tx, cached, userID, op.fieldsOrEmpty())
+	case BatchOpUpdate:
+		item, err = qb.updateItem(tx, cached, op.ID, userID, op.fieldsOrEmpty(), UpdateOptions{IsAdmin: isAdmin, ExpectedVersion: op.Version})
+	case BatchOpDelete:
+		err = qb.deleteBatchItem(tx, cached, userID, isAdmin, op)
+	}
+	if err != nil {
+		return err
+	}
+
+	if item != nil {
+		entry.ID = item.ID
+		entry.Version = item.Version
+	}
+	return nil
+}
+
+// deleteBatchItem deletes an item, first honouring the operation's version if any
+func (qb *EAVQueryBuilder) deleteBatchItem(tx *gorm.DB, cached *CachedSchema, userID uint, isAdmin bool, op BatchOperation) error {
+	if op.Version != nil {
+		var item models.Item
+		err := tx.Select("id, version").Where("id = ? AND schema_id = ?", op.ID, cached.Schema.ID).First(&item).Error
+		if err == nil && item.Version != *op.Version {
+			return fmt.Errorf("version conflict")
+		}
+	}
+	return qb.deleteItem(tx, cached, op.ID, userID, isAdmin)
+}
+
+func (op BatchOperation) fieldsOrEmpty() map[string]interface{} {
+	if op.Fields == nil {
+		return map[string]interface{}{}
+	}
+	return op.Fields
+}
+
+// markPending gives every operation that has not run yet the given status
+func (r *BatchResult) markPending(status string) {
+	for i := range r.Results {
+		if r.Results[i].Status == "" {
+			r.Results[i].Status = status
+		}
+	}
+}
+
+func (r *BatchResult) countStatus(status string) int {
+	count := 0
+	for _, entry := range r.Results {
+		if entry.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *BatchResult) tally() {
+	r.Succeeded = r.countStatus(BatchStatusSucceeded)
+	r.Failed = r.countStatus(BatchStatusFailed)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestValidateBatchOperation(t *testing.T) {
+	registry := createTestRegistry()
+	validator := NewValidationEngine(registry)
+
+	tests := []struct {
+		name   string
+		op     BatchOperation
+		status string
+		error  string
+	}{
+		{"valid create", BatchOperation{Op: BatchOpCreate, Fields: map[string]interface{}{"name": "Brie", "type": "Soft"}}, "", ""},
+		{"create with id", BatchOperation{Op: BatchOpCreate, ID: 3, Fields: map[string]interface{}{"name": "Brie", "type": "Soft"}}, BatchStatusFailed, "id must not be set for create"},
+		{"create missing required", BatchOperation{Op: BatchOpCreate, Fields: map[string]interface{}{"name": "Brie"}}, BatchStatusFailed, "validation_failed"},
+		{"create without fields", BatchOperation{Op: BatchOpCreate}, BatchStatusFailed, "validation_failed"},
+		{"valid update", BatchOperation{Op: BatchOpUpdate, ID: 3, Fields: map[string]interface{}{"origin": "France"}}, "", ""},
+		{"update without id", BatchOperation{Op: BatchOpUpdate, Fields: map[string]interface{}{"origin": "France"}}, BatchStatusFailed, "id is required"},
+		{"valid delete", BatchOperation{Op: BatchOpDelete, ID: 3}, "", ""},
+		{"delete without id", BatchOperation{Op: BatchOpDelete}, BatchStatusFailed, "id is required"},
+		{"unknown op", BatchOperation{Op: "upsert", ID: 3}, BatchStatusFailed, "unknown op 'upsert'"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := validateBatchOperation(validator, "cheese", i, tt.op)
+			if entry.Index != i {
+				t.Errorf("expected index %d, got %d", i, entry.Index)
+			}
+			if entry.Status != tt.status || entry.Error != tt.error {
+				t.Errorf("expected status %q error %q, got %q %q", tt.status, tt.error, entry.Status, entry.Error)
+			}
+			if tt.error == "validation_failed" && len(entry.Errors) == 0 {
+				t.Error("expected field errors")
+			}
+		})
+	}
+}
+
+func TestExecuteBatch_AtomicValidationFailure(t *testing.T) {
+	registry := createTestRegistry()
+	qb := NewEAVQueryBuilder(registry)
+
+	ops := []BatchOperation{
+		{Op: BatchOpCreate, Fields: map[string]interface{}{"name": "Brie", "type": "Soft"}},
+		{Op: BatchOpCreate, Fields: map[string]interface{}{"name": "Comté"}},
+		{Op: BatchOpDelete},
+	}
+
+	// Validation failures stop an atomic batch before it reaches the database
+	result, err := qb.ExecuteBatch(NewValidationEngine(registry), "cheese", 1, false, ops, BatchModeAtomic)
+	if err != nil {
+		t.Fatalf("ExecuteBatch failed: %v", err)
+	}
+	if result.Committed {
+		t.Error("expected the batch not to be committed")
+	}
+	if result.Succeeded != 0 || result.Failed != 2 {
+		t.Errorf("expected 0 succeeded and 2 failed, got %d and %d", result.Succeeded, result.Failed)
+	}
+
+	expected := []string{BatchStatusSkipped, BatchStatusFailed, BatchStatusFailed}
+	for i, status := range expected {
+		if result.Results[i].Status != status {
+			t.Errorf("operation %d: expected %s, got %s", i, status, result.Results[i].Status)
+		}
+	}
+	if len(result.Results[1].Errors) == 0 || result.Results[1].Errors[0].Field != "type" {
+		t.Errorf("expected a type error for operation 1, got %v", result.Results[1].Errors)
+	}
+}
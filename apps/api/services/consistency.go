@@ -0,0 +1,315 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// RepairSourceEAV rebuilds the field_values JSON from the EAV rows
+	RepairSourceEAV = "eav"
+	// RepairSourceJSON rebuilds the EAV rows from the field_values JSON
+	RepairSourceJSON = "json"
+
+	consistencyBatchSize = 200
+	// maxConsistencyIssues bounds the issues listed in a report; counts cover all
+	maxConsistencyIssues = 1000
+)
+
+// ConsistencyIssueKind is a kind of disagreement between an item's two copies of
+// its field values, or between them and its schema
+type ConsistencyIssueKind string
+
+const (
+	// IssueInvalidJSON is a field_values column that cannot be read
+	IssueInvalidJSON ConsistencyIssueKind = "invalid_json"
+	// IssueMismatch is a schema field whose JSON and EAV values differ
+	IssueMismatch ConsistencyIssueKind = "mismatch"
+	// IssueUnknownKey is a JSON key that is not a field of the schema
+	IssueUnknownKey ConsistencyIssueKind = "unknown_key"
+	// IssueOrphanedValue is an EAV row for a field the schema no longer has
+	IssueOrphanedValue ConsistencyIssueKind = "orphaned_value"
+	// IssueInvalidValue is a value the current schema rules refuse
+	IssueInvalidValue ConsistencyIssueKind = "invalid_value"
+)
+
+// ConsistencyIssue is one problem found on an item
+type ConsistencyIssue struct {
+	ItemID    uint                 `json:"item_id"`
+	Schema    string               `json:"schema"`
+	Kind      ConsistencyIssueKind `json:"kind"`
+	Field     string               `json:"field,omitempty"`
+	FieldID   uint                 `json:"field_id,omitempty"`
+	JSONValue interface{}          `json:"json_value,omitempty"`
+	EAVValue  interface{}          `json:"eav_value,omitempty"`
+	Message   string               `json:"message"`
+}
+
+// ConsistencyOptions tells CheckConsistency whether to repair what it finds, and
+// who repairs from JSON are recorded as; the item owner when UserID is 0
+type ConsistencyOptions struct {
+	Repair string
+	UserID uint
+}
+
+// ConsistencyReport is the result of a consistency check
+type ConsistencyReport struct {
+	Schemas         []string                     `json:"schemas"`
+	ItemsChecked    int                          `json:"items_checked"`
+	ItemsWithIssues int                          `json:"items_with_issues"`
+	IssueCounts     map[ConsistencyIssueKind]int `json:"issue_counts"`
+	Issues          []ConsistencyIssue           `json:"issues"`
+	Truncated       bool                         `json:"truncated"`
+	Repair          string                       `json:"repair,omitempty"`
+	Repaired        int                          `json:"repaired"`
+	RepairErrors    []string                     `json:"repair_errors"`
+}
+
+func (r *ConsistencyReport) add(issues []ConsistencyIssue) {
+	if len(issues) == 0 {
+		return
+	}
+	r.ItemsWithIssues++
+	for _, issue := range issues {
+		r.IssueCounts[issue.Kind]++
+		if len(r.Issues) < maxConsistencyIssues {
+			r.Issues = append(r.Issues, issue)
+		} else {
+			r.Truncated = true
+		}
+	}
+}
+
+// CheckConsistency compares the field_values JSON of every live item of a schema,
+// or of all schemas when schemaName is empty, with its EAV rows and its schema.
+// With a repair source, mismatches, unknown keys and orphaned rows are fixed by
+// rebuilding one copy from the other; values the schema refuses are only
+// reported.
+func (qb *EAVQueryBuilder) CheckConsistency(schemaName string, opts ConsistencyOptions) (*ConsistencyReport, error) {
+	switch opts.Repair {
+	case "", RepairSourceEAV, RepairSourceJSON:
+	default:
+		return nil, fmt.Errorf("invalid repair source '%s'; use eav or json", opts.Repair)
+	}
+
+	var schemas []*CachedSchema
+	if schemaName != "" {
+		cached, err := qb.getCachedSchema(schemaName)
+		if err != nil {
+			return nil, err
+		}
+		schemas = []*CachedSchema{cached}
+	} else {
+		schemas = qb.registry.GetAllSchemas()
+	}
+
+	report := &ConsistencyReport{
+		Schemas:      []string{},
+		IssueCounts:  make(map[ConsistencyIssueKind]int),
+		Issues:       []ConsistencyIssue{},
+		Repair:       opts.Repair,
+		RepairErrors: []string{},
+	}
+	validation := NewValidationEngine(qb.registry)
+
+	for _, cached := range schemas {
+		report.Schemas = append(report.Schemas, cached.Schema.Name)
+
+		var lastID uint
+		for {
+			var items []models.Item
+			if err := utils.DB.
+				Where("schema_id = ? AND id > ?", cached.Schema.ID, lastID).
+				Order("id ASC").
+				Limit(consistencyBatchSize).
+				Preload("FieldValuesRows").
+				Find(&items).Error; err != nil {
+				return report, fmt.Errorf("failed to query items: %w", err)
+			}
+
+			for i := range items {
+				issues := checkItemConsistency(&items[i], cached, validation)
+				report.ItemsChecked++
+				report.add(issues)
+
+				if opts.Repair == "" || !repairable(issues) {
+					continue
+				}
+				if err := qb.repairItem(&items[i], cached, opts); err != nil {
+					report.RepairErrors = append(report.RepairErrors, fmt.Sprintf("Item %d: %v", items[i].ID, err))
+					continue
+				}
+				report.Repaired++
+			}
+
+			if len(items) < consistencyBatchSize {
+				break
+			}
+			lastID = items[len(items)-1].ID
+		}
+	}
+
+	return report, nil
+}
+
+// checkItemConsistency lists the issues of an item with preloaded EAV rows
+func checkItemConsistency(item *models.Item, cached *CachedSchema, validation *ValidationEngine) []ConsistencyIssue {
+	var issues []ConsistencyIssue
+	issue := func(kind ConsistencyIssueKind, message string) ConsistencyIssue {
+		return ConsistencyIssue{ItemID: item.ID, Schema: cached.Schema.Name, Kind: kind, Message: message}
+	}
+
+	fieldsByID := make(map[uint]*models.ItemTypeField, len(cached.Fields))
+	fieldKeys := make(map[string]bool, len(cached.Fields))
+	for _, field := range cached.Fields {
+		fieldsByID[field.ID] = field
+		fieldKeys[field.Key] = true
+	}
+	for _, row := range item.FieldValuesRows {
+		if _, ok := fieldsByID[row.FieldID]; !ok {
+			orphan := issue(IssueOrphanedValue, fmt.Sprintf("value for field %d, which is not in the schema", row.FieldID))
+			orphan.FieldID = row.FieldID
+			if row.Value != nil {
+				orphan.EAVValue = *row.Value
+			}
+			issues = append(issues, orphan)
+		}
+	}
+
+	eav := buildFieldValuesMap(item.FieldValuesRows, cached.Fields)
+
+	stored, err := parseFieldValuesJSON(item.FieldValues)
+	if err != nil {
+		issues = append(issues, issue(IssueInvalidJSON, fmt.Sprintf("field_values cannot be read: %v", err)))
+	} else {
+		for _, field := range cached.Fields {
+			jsonValue, eavValue := stored[field.Key], eav[field.Key]
+			if jsonValue == nil && eavValue == nil || reflect.DeepEqual(jsonValue, eavValue) {
+				continue
+			}
+			mismatch := issue(IssueMismatch, fmt.Sprintf("%s differs between field_values and EAV rows", field.Label))
+			mismatch.Field = field.Key
+			mismatch.JSONValue = jsonValue
+			mismatch.EAVValue = eavValue
+			issues = append(issues, mismatch)
+		}
+
+		keys := make([]string, 0, len(stored))
+		for key := range stored {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !fieldKeys[key] {
+				unknown := issue(IssueUnknownKey, fmt.Sprintf("field_values has '%s', which is not a schema field", key))
+				unknown.Field = key
+				unknown.JSONValue = stored[key]
+				issues = append(issues, unknown)
+			}
+		}
+	}
+
+	if result := validation.ValidateCreate(cached.Schema.Name, eav); !result.Valid {
+		for _, validationErr := range result.Errors {
+			invalid := issue(IssueInvalidValue, validationErr.Message)
+			invalid.Field = validationErr.Field
+			invalid.EAVValue = eav[validationErr.Field]
+			issues = append(issues, invalid)
+		}
+	}
+
+	return issues
+}
+
+// repairable tells whether issues include any a repair can fix
+func repairable(issues []ConsistencyIssue) bool {
+	for _, issue := range issues {
+		if issue.Kind != IssueInvalidValue {
+			return true
+		}
+	}
+	return false
+}
+
+func parseFieldValuesJSON(raw string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if raw == "" {
+		return values, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	return values, nil
+}
+
+// repairItem rebuilds one copy of an item's field values from the other, and
+// removes its EAV rows for fields the schema no longer has
+func (qb *EAVQueryBuilder) repairItem(item *models.Item, cached *CachedSchema, opts ConsistencyOptions) error {
+	return utils.DB.Transaction(func(tx *gorm.DB) error {
+		fieldIDs := make([]uint, len(cached.Fields))
+		for i, field := range cached.Fields {
+			fieldIDs[i] = field.ID
+		}
+		orphans := tx.Unscoped().Where("item_id = ?", item.ID)
+		if len(fieldIDs) > 0 {
+			orphans = orphans.Where("field_id NOT IN ?", fieldIDs)
+		}
+		if err := orphans.Delete(&models.ItemFieldValue{}).Error; err != nil {
+			return fmt.Errorf("failed to delete orphaned values: %w", err)
+		}
+
+		eav := buildFieldValuesMap(item.FieldValuesRows, cached.Fields)
+		if opts.Repair == RepairSourceJSON {
+			stored, err := parseFieldValuesJSON(item.FieldValues)
+			if err != nil {
+				return fmt.Errorf("field_values cannot be read: %v", err)
+			}
+			target := buildFieldValuesMap(fieldValueRows(cached.Fields, stored), cached.Fields)
+			if !reflect.DeepEqual(target, eav) {
+				userID := opts.UserID
+				if userID == 0 {
+					userID = uint(item.UserID)
+				}
+				// The update rewrites the JSON from the rows it leaves
+				_, err := qb.updateItem(tx, cached, item.ID, userID, ReplacementUpdates(eav, target), UpdateOptions{
+					Action:  models.RevisionActionRepair,
+					IsAdmin: true,
+				})
+				return err
+			}
+		}
+
+		fieldValuesJSON, err := json.Marshal(eav)
+		if err != nil {
+			return fmt.Errorf("failed to build field values JSON: %w", err)
+		}
+		// The field values themselves do not change, so neither does the version
+		return tx.Model(&models.Item{}).Where("id = ?", item.ID).UpdateColumn("field_values", string(fieldValuesJSON)).Error
+	})
+}
+
+// fieldValueRows turns field values into the EAV rows that store them, without
+// item IDs. Keys that are not schema fields are left out.
+func fieldValueRows(fields []*models.ItemTypeField, values map[string]interface{}) []models.ItemFieldValue {
+	var rows []models.ItemFieldValue
+	for _, field := range fields {
+		if value, exists := values[field.Key]; exists {
+			var valueStr *string
+			if value != nil {
+				str := fmt.Sprintf("%v", value)
+				valueStr = &str
+			}
+			rows = append(rows, models.ItemFieldValue{FieldID: field.ID, Value: valueStr})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+)
+
+func TestCheckItemConsistency(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetActiveSchema("cheese")
+	for i, field := range cached.Fields {
+		field.ID = uint(i + 1)
+	}
+	validation := NewValidationEngine(registry)
+
+	value := func(s string) *string { return &s }
+	item := &models.Item{
+		ID:          7,
+		FieldValues: `{"name":"Comté","type":"Hard","age":"18","origin":"Jura","image_url":"https://example.com/comte.jpg"}`,
+		FieldValuesRows: []models.ItemFieldValue{
+			{FieldID: 1, Value: value("Comté")},
+			{FieldID: 2, Value: value("Hard")},
+			{FieldID: 5, Value: value("18")},
+			{FieldID: 6, Value: value("Crumbly")},
+			{FieldID: 42, Value: value("Fruitière")},
+		},
+	}
+
+	issues := checkItemConsistency(item, cached, validation)
+	var kinds []ConsistencyIssueKind
+	var fields []string
+	for _, issue := range issues {
+		kinds = append(kinds, issue.Kind)
+		fields = append(fields, issue.Field)
+	}
+	expectedKinds := []ConsistencyIssueKind{IssueOrphanedValue, IssueMismatch, IssueMismatch, IssueMismatch, IssueUnknownKey, IssueInvalidValue}
+	expectedFields := []string{"", "origin", "age", "style", "image_url", "style"}
+	if !reflect.DeepEqual(kinds, expectedKinds) || !reflect.DeepEqual(fields, expectedFields) {
+		t.Fatalf("expected %v on %v, got %v on %v", expectedKinds, expectedFields, kinds, fields)
+	}
+	if issues[0].FieldID != 42 || issues[0].EAVValue != "Fruitière" {
+		t.Errorf("unexpected orphan %+v", issues[0])
+	}
+	// A number kept as a string in the JSON differs from its typed EAV value
+	if issues[2].JSONValue != "18" || issues[2].EAVValue != 18.0 {
+		t.Errorf("unexpected mismatch %+v", issues[2])
+	}
+	if !repairable(issues) || repairable(issues[5:]) {
+		t.Error("expected only invalid values to be left unrepaired")
+	}
+
+	// The JSON copy written by CreateItem and updates agrees with its rows
+	consistent := &models.Item{ID: 8, FieldValuesRows: item.FieldValuesRows[:3]}
+	consistent.FieldValues, _ = BuildFieldValuesJSON(consistent.FieldValuesRows, cached.Fields)
+	if issues := checkItemConsistency(consistent, cached, validation); len(issues) != 0 {
+		t.Errorf("expected no issues, got %+v", issues)
+	}
+
+	item.FieldValues = `{"name":`
+	issues = checkItemConsistency(item, cached, validation)
+	if len(issues) < 2 || issues[1].Kind != IssueInvalidJSON {
+		t.Errorf("expected unreadable JSON to be reported, got %+v", issues)
+	}
+}
+
+func TestFieldValueRows(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetActiveSchema("cheese")
+	for i, field := range cached.Fields {
+		field.ID = uint(i + 1)
+	}
+
+	rows := fieldValueRows(cached.Fields, map[string]interface{}{"name": "Brie", "age": 4, "organic": true, "origin": nil, "unknown": "x"})
+	values := buildFieldValuesMap(rows, cached.Fields)
+	expected := map[string]interface{}{"name": "Brie", "age": 4.0, "organic": true}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+	if len(rows) != 4 {
+		t.Errorf("expected a row for each schema field given, including nil, got %d", len(rows))
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// listCursor is the payload behind an opaque pagination token. It records the sort
+// spec it was issued for and the sort values of the last row returned, the row ID
+// always being the final value.
+type listCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// EncodeCursor builds an opaque, URL-safe cursor token
+func EncodeCursor(sort string, values []interface{}) string {
+	data, _ := json.Marshal(listCursor{Sort: sort, Values: values})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token produced by EncodeCursor and checks that it was issued
+// for the same sort spec. Numbers are returned as json.Number.
+func DecodeCursor(token string, sort string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var cursor listCursor
+	if err := decoder.Decode(&cursor); err != nil || len(cursor.Values) == 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("cursor does not match sort '%s'", sort)
+	}
+
+	return cursor.Values, nil
+}
+
+// DecodeIDCursor parses a cursor over a plain ID ordering
+func DecodeIDCursor(token string) (uint, error) {
+	values, err := DecodeCursor(token, "id")
+	if err != nil {
+		return 0, err
+	}
+	id, err := cursorID(values[len(values)-1])
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func cursorID(value interface{}) (uint, error) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	id, err := number.Int64()
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	token := EncodeCursor("-name", []interface{}{"Brie", 42})
+
+	values, err := DecodeCursor(token, "-name")
+	if err != nil {
+		t.Fatalf("failed to decode cursor: %v", err)
+	}
+	if len(values) != 2 || values[0] != "Brie" {
+		t.Fatalf("unexpected cursor values: %v", values)
+	}
+	id, err := cursorID(values[1])
+	if err != nil || id != 42 {
+		t.Errorf("expected id 42, got %d (%v)", id, err)
+	}
+}
+
+func TestCursor_Invalid(t *testing.T) {
+	if _, err := DecodeCursor("not a cursor!", "name"); err == nil {
+		t.Error("expected garbage token to be rejected")
+	}
+	if _, err := DecodeCursor(EncodeCursor("name", []interface{}{"Brie", 1}), "-name"); err == nil {
+		t.Error("expected sort mismatch to be rejected")
+	}
+	if _, err := DecodeCursor(EncodeCursor("name", nil), "name"); err == nil {
+		t.Error("expected empty cursor to be rejected")
+	}
+	if _, err := DecodeIDCursor(EncodeCursor("id", []interface{}{"seven"})); err == nil {
+		t.Error("expected non-numeric id to be rejected")
+	}
+}
+
+func TestCursor_IDCursor(t *testing.T) {
+	id, err := DecodeIDCursor(EncodeCursor("id", []interface{}{uint(17)}))
+	if err != nil {
+		t.Fatalf("failed to decode id cursor: %v", err)
+	}
+	if id != 17 {
+		t.Errorf("expected id 17, got %d", id)
+	}
+}
+
+func TestSortPlan_KeysetCondition(t *testing.T) {
+	plan := &sortPlan{Terms: []sortTerm{
+		{Expr: "sort_0.value", Nullable: true},
+		{Expr: "items.id", Kind: sortKindID},
+	}}
+
+	values, err := DecodeCursor(EncodeCursor("origin", []interface{}{"France", 3}), "origin")
+	if err != nil {
+		t.Fatalf("failed to decode cursor: %v", err)
+	}
+	sql, args, err := plan.keysetCondition(values)
+	if err != nil {
+		t.Fatalf("failed to build condition: %v", err)
+	}
+	expected := "((sort_0.value > ?) OR (sort_0.value = ? AND items.id > ?))"
+	if sql != expected {
+		t.Errorf("expected %q, got %q", expected, sql)
+	}
+	if len(args) != 3 || args[2] != uint(3) {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	// A NULL value sorts first ascending, so every non-NULL value comes after it
+	values, _ = DecodeCursor(EncodeCursor("origin", []interface{}{nil, 3}), "origin")
+	sql, _, err = plan.keysetCondition(values)
+	if err != nil {
+		t.Fatalf("failed to build condition: %v", err)
+	}
+	if !strings.Contains(sql, "sort_0.value IS NOT NULL") || !strings.Contains(sql, "sort_0.value IS NULL AND items.id > ?") {
+		t.Errorf("unexpected NULL handling: %q", sql)
+	}
+
+	// Descending, NULLs sort last and must stay reachable
+	for i := range plan.Terms {
+		plan.Terms[i].Desc = true
+	}
+	values, _ = DecodeCursor(EncodeCursor("-origin", []interface{}{"France", 3}), "-origin")
+	sql, _, _ = plan.keysetCondition(values)
+	if !strings.Contains(sql, "(sort_0.value < ? OR sort_0.value IS NULL)") {
+		t.Errorf("expected descending condition to include NULLs, got %q", sql)
+	}
+
+	if _, _, err := plan.keysetCondition([]interface{}{"France"}); err == nil {
+		t.Error("expected cursor with wrong arity to be rejected")
+	}
+}
+
+func TestSortPlan_CursorValueTypes(t *testing.T) {
+	timeTerm := sortTerm{Expr: "items.created_at", Kind: sortKindTime}
+	now := time.Date(2024, 5, 1, 12, 30, 0, 123000000, time.UTC)
+
+	values, _ := DecodeCursor(EncodeCursor("created_at", []interface{}{timeTerm.encodeCursorValue(now)}), "created_at")
+	decoded, err := timeTerm.decodeCursorValue(values[0])
+	if err != nil {
+		t.Fatalf("failed to decode time: %v", err)
+	}
+	if !decoded.(time.Time).Equal(now) {
+		t.Errorf("expected %v, got %v", now, decoded)
+	}
+
+	numberTerm := sortTerm{Expr: "CAST(sort_0.value AS DECIMAL(20,6))", Kind: sortKindNumber, Nullable: true}
+	encoded := numberTerm.encodeCursorValue([]byte("12.500000"))
+	values, _ = DecodeCursor(EncodeCursor("alcohol", []interface{}{encoded}), "alcohol")
+	decoded, err = numberTerm.decodeCursorValue(values[0])
+	if err != nil || decoded != 12.5 {
+		t.Errorf("expected 12.5, got %v (%v)", decoded, err)
+	}
+
+	if _, err := timeTerm.decodeCursorValue(nil); err == nil {
+		t.Error("expected NULL to be rejected for a non-nullable term")
+	}
+}
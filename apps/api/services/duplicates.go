@@ -0,0 +1,392 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultDuplicateThreshold is the similarity above which two items are reported
+// as likely duplicates
+const DefaultDuplicateThreshold = 0.85
+
+const (
+	// Names carry most of the signal; matching fields confirm it
+	duplicateNameWeight  = 0.8
+	duplicateFieldWeight = 0.2
+)
+
+const (
+	// duplicateBlockAffix is the rune length of the name prefix and suffix used
+	// as blocking keys
+	duplicateBlockAffix = 3
+	// duplicateMaxBlock drops blocking keys shared by so many items, such as a
+	// common word, that comparing them all would cost more than it finds
+	duplicateMaxBlock = 500
+)
+
+type DuplicateCandidate struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	UserID      int       `json:"user_id"`
+	RatingCount int       `json:"rating_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DuplicateCluster is a group of items linked by pairwise similarity. Score is the
+// highest similarity found between two of its items. The suggested canonical item
+// is the most rated, then the oldest.
+type DuplicateCluster struct {
+	Items                []DuplicateCandidate `json:"items"`
+	Score                float64              `json:"score"`
+	SuggestedCanonicalID uint                 `json:"suggested_canonical_id"`
+}
+
+// duplicateRecord is the normalized form of an item that similarity works on
+type duplicateRecord struct {
+	Name   string
+	Fields map[string]string
+}
+
+// FindDuplicates groups the live items of a schema into clusters of likely
+// duplicates. Items sharing a blocking key are compared on their normalized name
+// and other field values, and pairs at or above threshold are joined into
+// clusters.
+func (qb *EAVQueryBuilder) FindDuplicates(schemaName string, threshold float64) ([]DuplicateCluster, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.Item
+	if err := utils.DB.Preload("FieldValuesRows").
+		Where("schema_id = ?", cached.Schema.ID).
+		Order("id ASC").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to load items: %w", err)
+	}
+
+	records := make([]duplicateRecord, len(items))
+	for i, item := range items {
+		values := buildFieldValuesMap(item.FieldValuesRows, cached.Fields)
+		record := duplicateRecord{Name: normalizeName(item.Name), Fields: make(map[string]string, len(values))}
+		for key, value := range values {
+			if key == "name" {
+				continue
+			}
+			if normalized := normalizeName(fmt.Sprintf("%v", value)); normalized != "" {
+				record.Fields[key] = normalized
+			}
+		}
+		records[i] = record
+	}
+
+	groups, scores := clusterDuplicates(records, threshold)
+	if len(groups) == 0 {
+		return []DuplicateCluster{}, nil
+	}
+
+	ids := make([]uint, 0)
+	for _, group := range groups {
+		for _, index := range group {
+			ids = append(ids, items[index].ID)
+		}
+	}
+	ratingCounts, err := ratingCountsByItem(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make([]DuplicateCluster, len(groups))
+	for i, group := range groups {
+		cluster := DuplicateCluster{Score: scores[i], Items: make([]DuplicateCandidate, len(group))}
+		for j, index := range group {
+			item := items[index]
+			cluster.Items[j] = DuplicateCandidate{
+				ID:          item.ID,
+				Name:        item.Name,
+				UserID:      item.UserID,
+				RatingCount: ratingCounts[item.ID],
+				CreatedAt:   item.CreatedAt,
+			}
+		}
+
+		// Items are in ID order, so the first with the most ratings is the oldest
+		best := cluster.Items[0]
+		for _, candidate := range cluster.Items[1:] {
+			if candidate.RatingCount > best.RatingCount {
+				best = candidate
+			}
+		}
+		cluster.SuggestedCanonicalID = best.ID
+		clusters[i] = cluster
+	}
+
+	return clusters, nil
+}
+
+func ratingCountsByItem(ids []uint) (map[uint]int, error) {
+	var rows []struct {
+		ItemID uint
+		Count  int
+	}
+	if err := utils.DB.Model(&models.Rating{}).
+		Select("item_id, COUNT(*) AS count").
+		Where("item_id IN ?", ids).
+		Group("item_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count ratings: %w", err)
+	}
+
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.ItemID] = row.Count
+	}
+	return counts, nil
+}
+
+// clusterDuplicates links every pair of records sharing a blocking key and
+// scoring at or above threshold, and returns the resulting groups of two or
+// more, as sorted record indexes, with the best pair score of each group. Groups
+// come largest first, then by score.
+func clusterDuplicates(records []duplicateRecord, threshold float64) ([][]int, []float64) {
+	sets := newUnionFind(len(records))
+	type link struct {
+		index int
+		score float64
+	}
+	var links []link
+
+	keys := make([][]string, len(records))
+	blocks := make(map[string][]int)
+	for i, record := range records {
+		keys[i] = duplicateBlockKeys(record.Name)
+		for _, key := range keys[i] {
+			blocks[key] = append(blocks[key], i)
+		}
+	}
+
+	// compared[j] == i marks j as already compared with i
+	compared := make([]int, len(records))
+	for j := range compared {
+		compared[j] = -1
+	}
+	for i := range records {
+		for _, key := range keys[i] {
+			block := blocks[key]
+			if len(block) > duplicateMaxBlock {
+				continue
+			}
+			for _, j := range block {
+				if j <= i || compared[j] == i {
+					continue
+				}
+				compared[j] = i
+				// Skip pairs whose name lengths alone rule out reaching the threshold
+				if duplicateNameWeight*nameSimilarityBound(records[i].Name, records[j].Name)+duplicateFieldWeight < threshold {
+					continue
+				}
+				score := recordSimilarity(records[i], records[j])
+				if score < threshold {
+					continue
+				}
+				sets.union(i, j)
+				links = append(links, link{index: i, score: score})
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range records {
+		root := sets.find(i)
+		members[root] = append(members[root], i)
+	}
+	scores := make(map[int]float64)
+	for _, l := range links {
+		if root := sets.find(l.index); l.score > scores[root] {
+			scores[root] = l.score
+		}
+	}
+
+	var groups [][]int
+	var groupScores []float64
+	roots := make([]int, 0, len(members))
+	for root, group := range members {
+		if len(group) > 1 {
+			roots = append(roots, root)
+		}
+	}
+	sort.Slice(roots, func(a, b int) bool {
+		ga, gb := members[roots[a]], members[roots[b]]
+		if len(ga) != len(gb) {
+			return len(ga) > len(gb)
+		}
+		if scores[roots[a]] != scores[roots[b]] {
+			return scores[roots[a]] > scores[roots[b]]
+		}
+		return ga[0] < gb[0]
+	})
+	for _, root := range roots {
+		groups = append(groups, members[root])
+		groupScores = append(groupScores, scores[root])
+	}
+
+	return groups, groupScores
+}
+
+// duplicateBlockKeys returns the keys a normalized name is blocked under: its
+// first and last runes and each of its words. Likely duplicates differ by a
+// typo or two, so they nearly always share one of them, while only items
+// sharing a key are compared. Unnamed records have no key and are never matched.
+func duplicateBlockKeys(name string) []string {
+	if name == "" {
+		return nil
+	}
+	runes := []rune(name)
+	if len(runes) <= duplicateBlockAffix {
+		return []string{"w:" + name}
+	}
+	keys := []string{
+		"p:" + string(runes[:duplicateBlockAffix]),
+		"s:" + string(runes[len(runes)-duplicateBlockAffix:]),
+	}
+	for _, word := range strings.Fields(name) {
+		if len([]rune(word)) >= duplicateBlockAffix {
+			keys = append(keys, "w:"+word)
+		}
+	}
+	return keys
+}
+
+// recordSimilarity scores two records between 0 and 1. Fields set on only one
+// side say nothing; when no field is set on both, the name decides alone.
+func recordSimilarity(a, b duplicateRecord) float64 {
+	name := stringSimilarity(a.Name, b.Name)
+
+	shared, equal := 0, 0
+	for key, av := range a.Fields {
+		bv, exists := b.Fields[key]
+		if !exists {
+			continue
+		}
+		shared++
+		if av == bv {
+			equal++
+		}
+	}
+	if shared == 0 {
+		return name
+	}
+
+	return duplicateNameWeight*name + duplicateFieldWeight*float64(equal)/float64(shared)
+}
+
+// normalizeName folds case and accents and reduces punctuation and spacing, so
+// "Comté  (AOP)" and "comte aop" compare equal
+func normalizeName(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// stringSimilarity is one minus the Levenshtein distance relative to the longer
+// string
+func stringSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// nameSimilarityBound is the highest stringSimilarity two strings of these
+// lengths can reach
+func nameSimilarityBound(a, b string) float64 {
+	la, lb := len([]rune(a)), len([]rune(b))
+	if la < lb {
+		la, lb = lb, la
+	}
+	if la == 0 {
+		return 1
+	}
+	return float64(lb) / float64(la)
+}
+
+func levenshtein(a, b []rune) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+type unionFind struct {
+	parent []int
+}
+
+func newUnionFind(size int) *unionFind {
+	parent := make([]int, size)
+	for i := range parent {
+		parent[i] = i
+	}
+	return &unionFind{parent: parent}
+}
+
+func (u *unionFind) find(i int) int {
+	for u.parent[i] != i {
+		u.parent[i] = u.parent[u.parent[i]]
+		i = u.parent[i]
+	}
+	return i
+}
+
+func (u *unionFind) union(i, j int) {
+	ri, rj := u.find(i), u.find(j)
+	if ri == rj {
+		return
+	}
+	if rj < ri {
+		ri, rj = rj, ri
+	}
+	u.parent[rj] = ri
+}
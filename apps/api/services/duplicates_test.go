@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := map[string]string{
+		"Comté":              "comte",
+		"  Comté  (AOP) ":    "comte aop",
+		"Saint-Nectaire":     "saint nectaire",
+		"BLEU D'AUVERGNE":    "bleu d auvergne",
+		"Crème brûlée, 2024": "creme brulee 2024",
+		"":                   "",
+		"--":                 "",
+	}
+	for input, expected := range tests {
+		if got := normalizeName(input); got != expected {
+			t.Errorf("normalizeName(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"brie", "", 4},
+		{"", "brie", 4},
+		{"brie", "brie", 0},
+		{"kitten", "sitting", 3},
+		{"roquefort", "rocquefort", 1},
+		{"comte", "conte", 1},
+		{"gruyère", "gruyere", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b)); got != tt.expected {
+			t.Errorf("levenshtein(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestStringSimilarity(t *testing.T) {
+	if got := stringSimilarity("roquefort", "rocquefort"); got != 0.9 {
+		t.Errorf("expected 0.9, got %v", got)
+	}
+	if got := stringSimilarity("", ""); got != 1 {
+		t.Errorf("expected empty strings to be identical, got %v", got)
+	}
+	if got := nameSimilarityBound("brie", "roquefort"); got < stringSimilarity("brie", "roquefort") {
+		t.Errorf("bound %v is below the actual similarity", got)
+	}
+}
+
+func TestRecordSimilarity(t *testing.T) {
+	a := duplicateRecord{Name: "comte", Fields: map[string]string{"type": "hard", "origin": "jura"}}
+	b := duplicateRecord{Name: "comte", Fields: map[string]string{"type": "hard", "origin": "doubs"}}
+	if got := recordSimilarity(a, b); got != 0.9 {
+		t.Errorf("expected 0.9 with one of two shared fields equal, got %v", got)
+	}
+
+	// Fields set on only one side are ignored
+	c := duplicateRecord{Name: "comte", Fields: map[string]string{"color": "yellow"}}
+	if got := recordSimilarity(a, c); got != 1 {
+		t.Errorf("expected the name alone to decide, got %v", got)
+	}
+}
+
+func TestClusterDuplicates(t *testing.T) {
+	records := []duplicateRecord{
+		{Name: "roquefort"},
+		{Name: "brie", Fields: map[string]string{"type": "soft"}},
+		{Name: "rocquefort"},
+		{Name: "brie", Fields: map[string]string{"type": "soft"}},
+		{Name: "roquefortt"},
+		{Name: "morbier"},
+		{Name: ""},
+		{Name: ""},
+		{Name: "brie", Fields: map[string]string{"type": "hard"}},
+	}
+
+	groups, scores := clusterDuplicates(records, 0.85)
+
+	// The roquefort variants chain into one cluster; the hard "brie" stays apart
+	// and the unnamed records are never matched
+	expected := [][]int{{0, 2, 4}, {1, 3}}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("expected groups %v, got %v", expected, groups)
+	}
+	if scores[1] != 1 {
+		t.Errorf("expected identical records to score 1, got %v", scores[1])
+	}
+	if scores[0] < 0.85 || scores[0] >= 1 {
+		t.Errorf("unexpected roquefort cluster score %v", scores[0])
+	}
+
+	if groups, _ := clusterDuplicates(records, 1); len(groups) != 1 {
+		t.Errorf("expected only exact matches at threshold 1, got %v", groups)
+	}
+}
+
+func TestDuplicateBlockKeys(t *testing.T) {
+	keys := duplicateBlockKeys("brie de meaux")
+	expected := []string{"p:bri", "s:aux", "w:brie", "w:meaux"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+	if keys := duplicateBlockKeys("ab"); !reflect.DeepEqual(keys, []string{"w:ab"}) {
+		t.Errorf("expected a short name to be its own key, got %v", keys)
+	}
+	if keys := duplicateBlockKeys(""); keys != nil {
+		t.Errorf("expected no key for an unnamed record, got %v", keys)
+	}
+}
+
+func TestClusterDuplicates_Blocking(t *testing.T) {
+	// A typo at either end of a single word still shares a key, and keys too
+	// common to compare do not hide it
+	records := []duplicateRecord{{Name: "camembert"}, {Name: "kamembert"}, {Name: "camembery"}}
+	for i := 0; i < 3000; i++ {
+		records = append(records, duplicateRecord{
+			Name:   fmt.Sprintf("cheese %d", i),
+			Fields: map[string]string{"code": fmt.Sprint(i)},
+		})
+	}
+
+	groups, _ := clusterDuplicates(records, 0.85)
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0], []int{0, 1, 2}) {
+		t.Errorf("expected only the camembert variants to cluster, got %d groups", len(groups))
+	}
+}
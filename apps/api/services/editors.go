@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+type EditorEntry struct {
+	UserID          int       `json:"user_id"`
+	UserDisplayName string    `json:"user_display_name,omitempty"`
+	GrantedBy       int       `json:"granted_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CanEdit reports whether a user may change an item: its owner, a user the owner
+// granted edit rights to, or an admin. Update, delete, restore and image changes
+// all go through it.
+func CanEdit(tx *gorm.DB, item *models.Item, userID uint, isAdmin bool) (bool, error) {
+	if isAdmin || uint(item.UserID) == userID {
+		return true, nil
+	}
+	if userID == 0 {
+		return false, nil
+	}
+
+	var count int64
+	if err := tx.Model(&models.ItemEditor{}).Where("item_id = ? AND user_id = ?", item.ID, userID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check edit rights: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ListEditors returns the users allowed to edit an item besides its owner. The
+// owner, the editors themselves and admins may see the list.
+func (qb *EAVQueryBuilder) ListEditors(schemaName string, itemID uint, userID uint, isAdmin bool) ([]EditorEntry, error) {
+	item, err := qb.findEditableItem(utils.DB, schemaName, itemID)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := CanEdit(utils.DB, item, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	var editors []models.ItemEditor
+	if err := utils.DB.Where("item_id = ?", item.ID).Order("id ASC").Find(&editors).Error; err != nil {
+		return nil, fmt.Errorf("failed to list editors: %w", err)
+	}
+
+	userIDs := make([]int, len(editors))
+	for i, editor := range editors {
+		userIDs[i] = editor.UserID
+	}
+	names := displayNamesByUser(userIDs)
+
+	entries := make([]EditorEntry, len(editors))
+	for i, editor := range editors {
+		entries[i] = EditorEntry{
+			UserID:          editor.UserID,
+			UserDisplayName: names[editor.UserID],
+			GrantedBy:       editor.GrantedBy,
+			CreatedAt:       editor.CreatedAt,
+		}
+	}
+	return entries, nil
+}
+
+// GrantEditor lets a user edit an item. Only the owner or an admin may grant,
+// and granting an existing editor again is a no-op.
+func (qb *EAVQueryBuilder) GrantEditor(schemaName string, itemID uint, userID uint, isAdmin bool, editorID uint) error {
+	item, err := qb.findEditableItem(utils.DB, schemaName, itemID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin && uint(item.UserID) != userID {
+		return fmt.Errorf("unauthorized")
+	}
+	if uint(item.UserID) == editorID {
+		return fmt.Errorf("the owner can already edit this item")
+	}
+
+	var editor models.User
+	if err := utils.DB.Select("id").First(&editor, editorID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	grant := models.ItemEditor{ItemID: item.ID, UserID: int(editorID), GrantedBy: int(userID)}
+	if err := utils.DB.Where(models.ItemEditor{ItemID: item.ID, UserID: int(editorID)}).FirstOrCreate(&grant).Error; err != nil {
+		return fmt.Errorf("failed to grant edit rights: %w", err)
+	}
+	return nil
+}
+
+// RevokeEditor removes a user's edit rights on an item. The owner or an admin may
+// revoke anyone; editors may give up their own rights.
+func (qb *EAVQueryBuilder) RevokeEditor(schemaName string, itemID uint, userID uint, isAdmin bool, editorID uint) error {
+	item, err := qb.findEditableItem(utils.DB, schemaName, itemID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin && uint(item.UserID) != userID && editorID != userID {
+		return fmt.Errorf("unauthorized")
+	}
+
+	result := utils.DB.Where("item_id = ? AND user_id = ?", item.ID, editorID).Delete(&models.ItemEditor{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke edit rights: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("editor not found")
+	}
+	return nil
+}
+
+func (qb *EAVQueryBuilder) findEditableItem(tx *gorm.DB, schemaName string, itemID uint) (*models.Item, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.Item
+	if err := tx.Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("item not found")
+		}
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+	return &item, nil
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatXLSX   = "xlsx"
+
+	// exportBatchSize is how many items are loaded at a time while exporting
+	exportBatchSize = 500
+)
+
+// ExportColumn is a column of an export: an item key and its header
+type ExportColumn struct {
+	Key   string
+	Label string
+}
+
+// ExportColumns lists the columns of a schema export: the item ID, the schema
+// fields in their display order, the item metadata and, when includeRatings is
+// set, the requesting user's own grade and note
+func (qb *EAVQueryBuilder) ExportColumns(schemaName string, includeRatings bool) ([]ExportColumn, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+	return exportColumns(cached.Fields, includeRatings), nil
+}
+
+func exportColumns(fields []*models.ItemTypeField, includeRatings bool) []ExportColumn {
+	ordered := make([]*models.ItemTypeField, len(fields))
+	copy(ordered, fields)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Order < ordered[j].Order
+	})
+
+	columns := []ExportColumn{{Key: "id", Label: "ID"}}
+	for _, field := range ordered {
+		columns = append(columns, ExportColumn{Key: field.Key, Label: field.Label})
+	}
+	columns = append(columns,
+		ExportColumn{Key: "image_url", Label: "Image URL"},
+		ExportColumn{Key: "user_id", Label: "Owner ID"},
+		ExportColumn{Key: "created_at", Label: "Created At"},
+		ExportColumn{Key: "updated_at", Label: "Updated At"},
+	)
+	if includeRatings {
+		columns = append(columns,
+			ExportColumn{Key: "my_grade", Label: "My Grade"},
+			ExportColumn{Key: "my_note", Label: "My Note"},
+		)
+	}
+	return columns
+}
+
+// ExportItems calls emit for every item matching the filters of params, in ID
+// order. Items are read in batches, each in its own query, so memory use does not
+// depend on the size of the catalog; paging and sort options are ignored. With
+// includeRatings, my_grade and my_note hold the rating of params.ViewerID.
+func (qb *EAVQueryBuilder) ExportItems(params QueryParams, includeRatings bool, emit func(item map[string]interface{}) error) error {
+	cached, err := qb.getCachedSchema(params.SchemaName)
+	if err != nil {
+		return err
+	}
+
+	var lastID uint
+	for {
+		var items []models.Item
+		query := qb.applyListFilters(utils.DB, utils.DB.Model(&models.Item{}).Where("items.schema_id = ?", cached.Schema.ID), cached, params, "")
+		if err := query.
+			Where("items.id > ?", lastID).
+			Order("items.id ASC").
+			Limit(exportBatchSize).
+			Preload("FieldValuesRows").
+			Find(&items).Error; err != nil {
+			return fmt.Errorf("failed to query items: %w", err)
+		}
+		if len(items) == 0 {
+			return nil
+		}
+
+		var ratings map[uint]map[string]interface{}
+		if includeRatings {
+			ids := make([]uint, len(items))
+			for i, item := range items {
+				ids[i] = item.ID
+			}
+			if ratings, err = viewerRatingsByItem(ids, params.ViewerID); err != nil {
+				return err
+			}
+		}
+
+		for i := range items {
+			item := qb.buildItemMap(&items[i], cached)
+			if includeRatings {
+				if rating, ok := ratings[items[i].ID]; ok {
+					item["my_grade"] = rating["grade"]
+					item["my_note"] = rating["note"]
+				}
+			}
+			if err := emit(item); err != nil {
+				return err
+			}
+		}
+
+		if len(items) < exportBatchSize {
+			return nil
+		}
+		lastID = items[len(items)-1].ID
+	}
+}
+
+// ExportWriter writes exported items in one of the export formats
+type ExportWriter interface {
+	Write(item map[string]interface{}) error
+	// Flush pushes buffered rows to the underlying writer
+	Flush() error
+	// Close finishes the file; the writer cannot be used afterwards
+	Close() error
+}
+
+// ExportContentType returns the MIME type of an export format
+func ExportContentType(format string) string {
+	switch format {
+	case ExportFormatCSV:
+		return "text/csv; charset=utf-8"
+	case ExportFormatNDJSON:
+		return "application/x-ndjson"
+	case ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// NewExportWriter starts an export in the given format. CSV and XLSX files get a
+// header row of column labels; NDJSON objects are keyed by column key.
+func NewExportWriter(format string, w io.Writer, sheetName string, columns []ExportColumn) (ExportWriter, error) {
+	labels := make([]interface{}, len(columns))
+	for i, column := range columns {
+		labels[i] = column.Label
+	}
+
+	switch format {
+	case ExportFormatCSV:
+		// The byte order mark lets spreadsheet tools detect UTF-8
+		if _, err := io.WriteString(w, "\xef\xbb\xbf"); err != nil {
+			return nil, err
+		}
+		writer := &csvExportWriter{csv: csv.NewWriter(w), columns: columns}
+		if err := writer.csv.Write(csvSafeCells(labels)); err != nil {
+			return nil, err
+		}
+		return writer, nil
+	case ExportFormatNDJSON:
+		return &ndjsonExportWriter{encoder: json.NewEncoder(w), columns: columns}, nil
+	case ExportFormatXLSX:
+		xlsx, err := utils.NewXLSXWriter(w, sheetName)
+		if err != nil {
+			return nil, err
+		}
+		if err := xlsx.WriteRow(labels); err != nil {
+			return nil, err
+		}
+		return &xlsxExportWriter{xlsx: xlsx, columns: columns}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q; use csv, ndjson or xlsx", format)
+}
+
+type csvExportWriter struct {
+	csv     *csv.Writer
+	columns []ExportColumn
+}
+
+func (w *csvExportWriter) Write(item map[string]interface{}) error {
+	return w.csv.Write(csvSafeCells(exportRow(w.columns, item)))
+}
+
+// csvFormulaTriggers are the leading characters that make spreadsheet tools
+// read a CSV cell as a formula
+const csvFormulaTriggers = "=+-@\t\r"
+
+// csvSafeCells formats a row for CSV, prefixing text that would be read as a
+// formula with a quote. Values are community-entered, so a name such as
+// =HYPERLINK(...) must stay text when the export is opened. Numbers are left as
+// they are; XLSX cells are written as text and need no escaping.
+func csvSafeCells(values []interface{}) []string {
+	cells := exportStrings(values)
+	for i, value := range values {
+		if text, ok := value.(string); ok && text != "" && strings.ContainsRune(csvFormulaTriggers, rune(text[0])) {
+			cells[i] = "'" + text
+		}
+	}
+	return cells
+}
+
+// unescapeCSVFormula reverses csvSafeCells on an imported cell, so an export
+// can be imported back unchanged
+func unescapeCSVFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaTriggers, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+func (w *csvExportWriter) Flush() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func (w *csvExportWriter) Close() error {
+	return w.Flush()
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+	columns []ExportColumn
+}
+
+func (w *ndjsonExportWriter) Write(item map[string]interface{}) error {
+	values := exportRow(w.columns, item)
+	object := make(map[string]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		object[column.Key] = values[i]
+	}
+	return w.encoder.Encode(object)
+}
+
+func (w *ndjsonExportWriter) Flush() error { return nil }
+
+func (w *ndjsonExportWriter) Close() error { return nil }
+
+type xlsxExportWriter struct {
+	xlsx    *utils.XLSXWriter
+	columns []ExportColumn
+}
+
+func (w *xlsxExportWriter) Write(item map[string]interface{}) error {
+	return w.xlsx.WriteRow(exportRow(w.columns, item))
+}
+
+func (w *xlsxExportWriter) Flush() error {
+	return w.xlsx.Flush()
+}
+
+func (w *xlsxExportWriter) Close() error {
+	return w.xlsx.Close()
+}
+
+// exportRow picks the column values out of an item built by buildItemMap,
+// dereferencing pointers and formatting times as RFC 3339
+func exportRow(columns []ExportColumn, item map[string]interface{}) []interface{} {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch v := item[column.Key].(type) {
+		case *string:
+			if v != nil {
+				values[i] = *v
+			}
+		case time.Time:
+			values[i] = v.UTC().Format(time.RFC3339)
+		case *time.Time:
+			if v != nil {
+				values[i] = v.UTC().Format(time.RFC3339)
+			}
+		default:
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func exportStrings(values []interface{}) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			result[i] = v
+		case float64:
+			result[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case float32:
+			result[i] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+		default:
+			result[i] = fmt.Sprint(v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+)
+
+func exportTestColumns() []ExportColumn {
+	return exportColumns([]*models.ItemTypeField{
+		{Key: "origin", Label: "Origin", Order: 2},
+		{Key: "name", Label: "Name", Order: 0},
+		{Key: "age", Label: "Age", Order: 1},
+		{Key: "organic", Label: "Organic", Order: 3},
+	}, true)
+}
+
+func exportTestItem() map[string]interface{} {
+	image := "https://example.com/comte.jpg"
+	return map[string]interface{}{
+		"id":         uint(7),
+		"name":       "Comté, \"extra\"",
+		"age":        18.5,
+		"organic":    true,
+		"image_url":  &image,
+		"user_id":    uint(3),
+		"created_at": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		"updated_at": time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC),
+		"my_grade":   float32(4.5),
+	}
+}
+
+func TestExportColumns(t *testing.T) {
+	var keys []string
+	for _, column := range exportTestColumns() {
+		keys = append(keys, column.Key)
+	}
+	expected := []string{"id", "name", "age", "origin", "organic", "image_url", "user_id", "created_at", "updated_at", "my_grade", "my_note"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	if columns := exportColumns(nil, false); columns[len(columns)-1].Key != "updated_at" {
+		t.Errorf("expected no rating columns, got %v", columns)
+	}
+}
+
+func TestExportWriter_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewExportWriter(ExportFormatCSV, &buf, "Cheese", exportTestColumns())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.Write(exportTestItem()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "\xef\xbb\xbfID,Name,Age,Origin,Organic,Image URL,Owner ID,Created At,Updated At,My Grade,My Note\n" +
+		"7,\"Comté, \"\"extra\"\"\",18.5,,true,https://example.com/comte.jpg,3,2024-05-01T12:00:00Z,2024-05-02T08:30:00Z,4.5,\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected CSV:\n%s", buf.String())
+	}
+
+	// An export can be imported back
+	table, err := ParseImportTable(ImportFormatCSV, buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse export: %v", err)
+	}
+	if table.Headers[1] != "Name" || table.Rows[0].Values[1] != "Comté, \"extra\"" {
+		t.Errorf("unexpected round trip %+v", table)
+	}
+}
+
+func TestExportWriter_CSVFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewExportWriter(ExportFormatCSV, &buf, "Cheese", exportTestColumns())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	item := exportTestItem()
+	item["name"] = `=HYPERLINK("http://evil.example","Brie")`
+	item["origin"] = "+cmd|' /C calc'!A0"
+	item["age"] = -3.0
+	item["my_note"] = "@SUM(A1)"
+	if err := writer.Write(item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	writer.Close()
+
+	table, err := ParseImportTable(ImportFormatCSV, buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse export: %v", err)
+	}
+	raw := strings.Split(buf.String(), "\n")[1]
+	for _, cell := range []string{`"'=HYPERLINK(`, `'+cmd|`, `'@SUM(A1)`, `,-3,`} {
+		if !strings.Contains(raw, cell) {
+			t.Errorf("expected %q in the row, got %s", cell, raw)
+		}
+	}
+
+	// Escaped cells are imported back as they were
+	values := table.Rows[0].Values
+	if values[1] != item["name"] || values[3] != item["origin"] || values[10] != "@SUM(A1)" {
+		t.Errorf("unexpected round trip %v", values)
+	}
+}
+
+func TestExportWriter_NDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewExportWriter(ExportFormatNDJSON, &buf, "Cheese", exportTestColumns())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	writer.Write(exportTestItem())
+	writer.Write(map[string]interface{}{"id": uint(8), "name": "Brie"})
+	writer.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], `"created_at":"2024-05-01T12:00:00Z"`) || !strings.Contains(lines[0], `"my_note":null`) {
+		t.Errorf("unexpected first line %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"origin":null`) {
+		t.Errorf("expected missing fields to be null, got %s", lines[1])
+	}
+}
+
+func TestExportWriter_XLSX(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewExportWriter(ExportFormatXLSX, &buf, "Cheese: 2024/05", exportTestColumns())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	writer.Write(exportTestItem())
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rows, err := utils.ReadXLSX(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to read export: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0][0] != "ID" || rows[0][10] != "My Note" {
+		t.Errorf("unexpected header %v", rows[0])
+	}
+	expected := []string{"7", "Comté, \"extra\"", "18.5", "", "true", "https://example.com/comte.jpg", "3", "2024-05-01T12:00:00Z", "2024-05-02T08:30:00Z", "4.5"}
+	if !reflect.DeepEqual(rows[1], expected) {
+		t.Errorf("expected %v, got %v", expected, rows[1])
+	}
+}
+
+func TestExportWriter_UnknownFormat(t *testing.T) {
+	if _, err := NewExportWriter("pdf", &bytes.Buffer{}, "Cheese", nil); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
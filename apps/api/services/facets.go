@@ -0,0 +1,208 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+const defaultFacetBuckets = 5
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type FacetBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+type Facet struct {
+	Field     string           `json:"field"`
+	Label     string           `json:"label"`
+	FieldType models.FieldType `json:"field_type"`
+	Values    []FacetValue     `json:"values,omitempty"`
+	Buckets   []FacetBucket    `json:"buckets,omitempty"`
+}
+
+// isFacetable reports whether a field can be faceted. Select, enum, checkbox and
+// number fields always can; free text fields must opt in with "facetable": true
+// in their display config.
+func isFacetable(field *models.ItemTypeField) bool {
+	switch field.FieldType {
+	case models.FieldTypeSelect, models.FieldTypeEnum, models.FieldTypeCheckbox, models.FieldTypeNumber:
+		return true
+	}
+	display, err := ParseFieldDisplay(field)
+	if err != nil {
+		return false
+	}
+	facetable, _ := display["facetable"].(bool)
+	return facetable
+}
+
+// ComputeFacets counts the values of the requested fields across the items matching
+// params. Each facet ignores the filter on its own field, so a selected value does
+// not hide the alternatives.
+func (qb *EAVQueryBuilder) ComputeFacets(params QueryParams, keys []string) (map[string]*Facet, error) {
+	cached, err := qb.getCachedSchema(params.SchemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]*models.ItemTypeField, 0, len(keys))
+	for _, key := range keys {
+		field, found := qb.registry.GetFieldByKey(params.SchemaName, key)
+		if !found {
+			return nil, fmt.Errorf("field '%s' not found", key)
+		}
+		if !isFacetable(field) {
+			return nil, fmt.Errorf("field '%s' is not facetable", key)
+		}
+		fields = append(fields, field)
+	}
+
+	facets := make(map[string]*Facet, len(fields))
+
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		for _, field := range fields {
+			matching := qb.applyListFilters(tx,
+				tx.Model(&models.Item{}).Select("items.id").Where("items.schema_id = ?", cached.Schema.ID),
+				cached, params, field.Key)
+
+			facet := &Facet{Field: field.Key, Label: field.Label, FieldType: field.FieldType}
+
+			var err error
+			if field.FieldType == models.FieldTypeNumber {
+				facet.Buckets, err = numberFacetBuckets(tx, field, matching)
+			} else {
+				facet.Values, err = valueFacetCounts(tx, field, matching)
+			}
+			if err != nil {
+				return err
+			}
+
+			facets[field.Key] = facet
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute facets: %w", err)
+	}
+
+	return facets, nil
+}
+
+func valueFacetCounts(tx *gorm.DB, field *models.ItemTypeField, matching *gorm.DB) ([]FacetValue, error) {
+	var rows []FacetValue
+	if err := tx.Model(&models.ItemFieldValue{}).
+		Select("value, COUNT(*) AS count").
+		Where("field_id = ? AND item_id IN (?) AND value IS NOT NULL AND value <> ''", field.ID, matching).
+		Group("value").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		value := row.Value
+		if field.FieldType == models.FieldTypeCheckbox {
+			value = "false"
+			if row.Value == "true" || row.Value == "1" {
+				value = "true"
+			}
+		}
+		counts[value] += row.Count
+	}
+
+	// Declared options are always listed so the UI can show them with a zero count
+	if field.FieldType == models.FieldTypeSelect || field.FieldType == models.FieldTypeEnum {
+		if options, err := ParseFieldOptions(field); err == nil {
+			for _, opt := range options {
+				if _, exists := counts[opt]; !exists {
+					counts[opt] = 0
+				}
+			}
+		}
+	}
+
+	values := make([]FacetValue, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, FacetValue{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+
+	return values, nil
+}
+
+func numberFacetBuckets(tx *gorm.DB, field *models.ItemTypeField, matching *gorm.DB) ([]FacetBucket, error) {
+	numeric := tx.Model(&models.ItemFieldValue{}).
+		Where("field_id = ? AND item_id IN (?) AND value REGEXP ?", field.ID, matching, `^-?[0-9]+(\.[0-9]+)?$`)
+
+	var bounds struct {
+		Min   *float64
+		Max   *float64
+		Count int64
+	}
+	if err := numeric.Session(&gorm.Session{}).
+		Select("MIN(CAST(value AS DECIMAL(20,6))) AS min, MAX(CAST(value AS DECIMAL(20,6))) AS max, COUNT(*) AS count").
+		Scan(&bounds).Error; err != nil {
+		return nil, err
+	}
+	if bounds.Count == 0 || bounds.Min == nil || bounds.Max == nil {
+		return []FacetBucket{}, nil
+	}
+
+	min, max := *bounds.Min, *bounds.Max
+	if min == max {
+		return []FacetBucket{{Min: min, Max: max, Count: bounds.Count}}, nil
+	}
+
+	bucketCount := defaultFacetBuckets
+	if display, err := ParseFieldDisplay(field); err == nil {
+		if n, ok := display["facet_buckets"].(float64); ok && n >= 1 {
+			bucketCount = int(n)
+		}
+	}
+	width := (max - min) / float64(bucketCount)
+
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	if err := numeric.Session(&gorm.Session{}).
+		Select("LEAST(FLOOR((CAST(value AS DECIMAL(20,6)) - ?) / ?), ?) AS bucket, COUNT(*) AS count", min, width, bucketCount-1).
+		Group("bucket").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	buckets := make([]FacetBucket, bucketCount)
+	for i := range buckets {
+		buckets[i].Min = roundFacetBound(min + float64(i)*width)
+		buckets[i].Max = roundFacetBound(min + float64(i+1)*width)
+	}
+	buckets[bucketCount-1].Max = max
+	for _, row := range rows {
+		if row.Bucket >= 0 && row.Bucket < bucketCount {
+			buckets[row.Bucket].Count += row.Count
+		}
+	}
+
+	return buckets, nil
+}
+
+func roundFacetBound(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
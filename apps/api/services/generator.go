@@ -0,0 +1,555 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	MaxGenerateItems = 10000
+	MaxGenerateUsers = 1000
+	// DefaultGenerateFriends is how many users each generated user shares
+	// ratings with, on average
+	DefaultGenerateFriends = 4
+
+	// generateOptionalRate is how often an optional field gets a value
+	generateOptionalRate = 0.7
+	// generateShareRate is how often a rating is shared with each of its author's
+	// friends
+	generateShareRate = 0.6
+	// generateAttempts bounds the retries for a value matching a pattern, or an
+	// item with unique values
+	generateAttempts = 50
+)
+
+// GenerateOptions controls synthetic data generation. The same options and seed
+// always generate the same data for a schema.
+type GenerateOptions struct {
+	Count int   `json:"count"`
+	Seed  int64 `json:"seed"`
+	// Users is the number of users generated to rate items; none when 0
+	Users int `json:"users"`
+	// RatingsPerItem is the average number of ratings of an item
+	RatingsPerItem float64 `json:"ratings_per_item"`
+	// FriendsPerUser is the average number of users a user shares ratings with
+	FriendsPerUser *float64 `json:"friends_per_user"`
+}
+
+// GeneratedUser is a user created to rate generated items
+type GeneratedUser struct {
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+}
+
+// GeneratedData is a generated catalog: its users, and its items in the seed
+// format, with their ratings
+type GeneratedData struct {
+	Seed  int64           `json:"seed"`
+	Users []GeneratedUser `json:"users"`
+	Items []SeedItem      `json:"items"`
+}
+
+// Normalize checks the options and fills in defaults. Without a seed, one is
+// picked from the clock; it is returned with the data so the run can be repeated.
+func (opts *GenerateOptions) Normalize() error {
+	if opts.Count < 1 || opts.Count > MaxGenerateItems {
+		return fmt.Errorf("count must be between 1 and %d", MaxGenerateItems)
+	}
+	if opts.Users < 0 || opts.Users > MaxGenerateUsers {
+		return fmt.Errorf("users must be between 0 and %d", MaxGenerateUsers)
+	}
+	if opts.RatingsPerItem < 0 || opts.RatingsPerItem > float64(opts.Users) {
+		return fmt.Errorf("ratings_per_item must be between 0 and the number of users")
+	}
+	if opts.FriendsPerUser == nil {
+		friends := math.Min(DefaultGenerateFriends, math.Max(float64(opts.Users-1), 0))
+		opts.FriendsPerUser = &friends
+	}
+	if *opts.FriendsPerUser < 0 || (opts.Users > 0 && *opts.FriendsPerUser > float64(opts.Users-1)) {
+		return fmt.Errorf("friends_per_user must be between 0 and the number of other users")
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	return nil
+}
+
+// generator holds the random source of a run; every value is drawn from it in a
+// fixed order, which keeps runs reproducible
+type generator struct {
+	rng    *rand.Rand
+	cached *CachedSchema
+	opts   GenerateOptions
+}
+
+// GenerateData generates items for a schema, and users rating them, following
+// the schema's field types, validation rules, options and unique fields
+func GenerateData(cached *CachedSchema, opts GenerateOptions) (*GeneratedData, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	g := &generator{rng: rand.New(rand.NewSource(opts.Seed)), cached: cached, opts: opts}
+
+	data := &GeneratedData{Seed: opts.Seed, Users: g.users(), Items: make([]SeedItem, 0, opts.Count)}
+
+	seen := make(map[string]bool)
+	for i := 0; i < opts.Count; i++ {
+		fields, err := g.uniqueItem(seen)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i+1, err)
+		}
+		data.Items = append(data.Items, SeedItem{Position: i + 1, Fields: fields})
+	}
+
+	g.ratings(data)
+	return data, nil
+}
+
+func (g *generator) users() []GeneratedUser {
+	users := make([]GeneratedUser, g.opts.Users)
+	for i := range users {
+		first := generateFirstNames[g.rng.Intn(len(generateFirstNames))]
+		last := generateLastInitials[g.rng.Intn(len(generateLastInitials))]
+		users[i] = GeneratedUser{
+			Email:       fmt.Sprintf("taster-%d-%d@generated.example", g.opts.Seed, i+1),
+			DisplayName: fmt.Sprintf("%s %c. %d-%d", first, last, g.opts.Seed, i+1),
+		}
+	}
+	return users
+}
+
+// uniqueItem generates field values until their unique fields differ from those
+// of the items generated before. Text unique fields get a number appended once
+// random values keep colliding.
+func (g *generator) uniqueItem(seen map[string]bool) (map[string]interface{}, error) {
+	for attempt := 0; attempt < generateAttempts; attempt++ {
+		fields, err := g.item()
+		if err != nil {
+			return nil, err
+		}
+		if attempt >= generateAttempts/2 {
+			g.disambiguate(fields, attempt)
+		}
+		key, _ := SeedUniqueKey(g.cached, fields)
+		if key == "" || !seen[key] {
+			if key != "" {
+				seen[key] = true
+			}
+			return fields, nil
+		}
+	}
+	return nil, fmt.Errorf("could not generate an item with unique %s", strings.Join(g.cached.UniqueFields, ", "))
+}
+
+func (g *generator) disambiguate(fields map[string]interface{}, attempt int) {
+	for _, key := range g.cached.UniqueFields {
+		field := g.field(key)
+		if field == nil || (field.FieldType != models.FieldTypeText && field.FieldType != models.FieldTypeTextarea) {
+			continue
+		}
+		if value, ok := fields[key].(string); ok {
+			validation, _ := ParseFieldValidation(field)
+			candidate := fmt.Sprintf("%s %d", value, g.rng.Intn(1000*(attempt+1)))
+			if fitsText(candidate, validation) {
+				fields[key] = candidate
+			}
+		}
+	}
+}
+
+func (g *generator) field(key string) *models.ItemTypeField {
+	for _, field := range g.cached.Fields {
+		if field.Key == key {
+			return field
+		}
+	}
+	return nil
+}
+
+func (g *generator) item() (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for _, field := range g.cached.Fields {
+		// The draw happens for required fields too, so that adding a required
+		// flag does not shift every later value
+		fill := g.rng.Float64() < generateOptionalRate
+		if !field.Required && !fill {
+			continue
+		}
+		value, err := g.value(field)
+		if err != nil {
+			if field.Required {
+				return nil, err
+			}
+			continue
+		}
+		fields[field.Key] = value
+	}
+	return fields, nil
+}
+
+func (g *generator) value(field *models.ItemTypeField) (interface{}, error) {
+	validation, err := ParseFieldValidation(field)
+	if err != nil {
+		return nil, err
+	}
+
+	switch field.FieldType {
+	case models.FieldTypeNumber:
+		return g.number(validation), nil
+	case models.FieldTypeCheckbox:
+		return g.rng.Float64() < 0.4, nil
+	case models.FieldTypeSelect, models.FieldTypeEnum:
+		options, err := ParseFieldOptions(field)
+		if err != nil {
+			return nil, err
+		}
+		if len(options) == 0 {
+			return nil, fmt.Errorf("%s has no options", field.Label)
+		}
+		return options[g.rng.Intn(len(options))], nil
+	default:
+		return g.text(field, validation)
+	}
+}
+
+// number picks a value within the min and max rules, 0 to 100 by default. Whole
+// bounds give whole numbers, others one decimal.
+func (g *generator) number(validation map[string]interface{}) float64 {
+	min, hasMin := validation["min"].(float64)
+	max, hasMax := validation["max"].(float64)
+	switch {
+	case !hasMin && !hasMax:
+		min, max = 0, 100
+	case !hasMin:
+		min = math.Min(0, max)
+	case !hasMax:
+		max = min + 100
+	}
+
+	value := min + g.rng.Float64()*(max-min)
+	if min == math.Trunc(min) && max == math.Trunc(max) {
+		return math.Min(math.Round(value), max)
+	}
+	return math.Max(min, math.Min(math.Round(value*10)/10, max))
+}
+
+// text generates words fitting the field: a name for name fields, a place or
+// maker for fields named like one, sentences for text areas. A pattern rule
+// takes over, with values generated from the pattern itself.
+func (g *generator) text(field *models.ItemTypeField, validation map[string]interface{}) (string, error) {
+	pattern, hasPattern := validation["pattern"].(string)
+	for attempt := 0; attempt < generateAttempts; attempt++ {
+		var value string
+		if hasPattern {
+			generated, err := generateFromPattern(g.rng, pattern)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", field.Label, err)
+			}
+			value = generated
+		} else {
+			value = g.words(field)
+		}
+		value = fitLength(value, validation)
+		if fitsText(value, validation) {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("could not generate a valid %s", field.Label)
+}
+
+func (g *generator) words(field *models.ItemTypeField) string {
+	key := strings.ToLower(field.Key)
+	pick := func(words []string) string { return words[g.rng.Intn(len(words))] }
+
+	switch {
+	case field.FieldType == models.FieldTypeTextarea:
+		sentences := make([]string, 1+g.rng.Intn(3))
+		for i := range sentences {
+			words := make([]string, 6+g.rng.Intn(8))
+			for j := range words {
+				words[j] = pick(generateWords)
+			}
+			sentence := strings.Join(words, " ")
+			sentences[i] = strings.ToUpper(sentence[:1]) + sentence[1:] + "."
+		}
+		return strings.Join(sentences, " ")
+	case key == "name" || strings.HasSuffix(key, "_name") || key == "title":
+		return pick(generateAdjectives) + " " + pick(generateNouns)
+	case containsAny(key, "origin", "country", "region", "location", "place"):
+		return pick(generatePlaces)
+	case containsAny(key, "producer", "maker", "brand", "distillery", "winery", "brewery", "roaster"):
+		return pick(generateMakerPrefixes) + " " + pick(generateSurnames)
+	default:
+		return strings.ToUpper(pick(generateWords)[:1]) + pick(generateWords)[1:]
+	}
+}
+
+func containsAny(value string, parts ...string) bool {
+	for _, part := range parts {
+		if strings.Contains(value, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// fitLength pads or cuts a value to the field's length rules, which count bytes
+// like the validation engine does
+func fitLength(value string, validation map[string]interface{}) string {
+	if minLength, ok := validation["minLength"].(float64); ok {
+		for len(value) < int(minLength) {
+			value += " " + generateWords[len(value)%len(generateWords)]
+		}
+	}
+	if maxLength, ok := validation["maxLength"].(float64); ok {
+		for len(value) > int(maxLength) {
+			_, size := utf8.DecodeLastRuneInString(value)
+			value = value[:len(value)-size]
+		}
+		value = strings.TrimSpace(value)
+	}
+	return value
+}
+
+// fitsText checks a value against the rules the validation engine applies to
+// text fields
+func fitsText(value string, validation map[string]interface{}) bool {
+	if minLength, ok := validation["minLength"].(float64); ok && len(value) < int(minLength) {
+		return false
+	}
+	if maxLength, ok := validation["maxLength"].(float64); ok && len(value) > int(maxLength) {
+		return false
+	}
+	if pattern, ok := validation["pattern"].(string); ok {
+		if matched, _ := regexp.MatchString(pattern, value); !matched {
+			return false
+		}
+	}
+	return strings.TrimSpace(value) != ""
+}
+
+// generateFromPattern builds a string matching a regular expression, choosing
+// at random among alternatives, repetitions and character classes
+func generateFromPattern(rng *rand.Rand, pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	var b strings.Builder
+	if err := writePattern(rng, re.Simplify(), &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func writePattern(rng *rand.Rand, re *syntax.Regexp, b *strings.Builder) error {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			b.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		b.WriteRune(pickRune(rng, re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte(generateAlphabet[rng.Intn(len(generateAlphabet))])
+	case syntax.OpCapture:
+		return writePattern(rng, re.Sub[0], b)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := writePattern(rng, sub, b); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		return writePattern(rng, re.Sub[rng.Intn(len(re.Sub))], b)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := 0, 3
+		switch re.Op {
+		case syntax.OpPlus:
+			min, max = 1, 4
+		case syntax.OpQuest:
+			max = 1
+		case syntax.OpRepeat:
+			min, max = re.Min, re.Max
+			if max < 0 {
+				max = min + 3
+			}
+		}
+		for i, n := 0, min+rng.Intn(max-min+1); i < n; i++ {
+			if err := writePattern(rng, re.Sub[0], b); err != nil {
+				return err
+			}
+		}
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+	default:
+		return errors.New("pattern is not supported for generation")
+	}
+	return nil
+}
+
+// pickRune picks a rune from class ranges, preferring printable ASCII
+func pickRune(rng *rand.Rand, ranges []rune) rune {
+	var printable []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		if lo < ' ' {
+			lo = ' '
+		}
+		if hi > '~' {
+			hi = '~'
+		}
+		if lo <= hi {
+			printable = append(printable, lo, hi)
+		}
+	}
+	if len(printable) == 0 {
+		return ranges[0]
+	}
+	i := rng.Intn(len(printable)/2) * 2
+	return printable[i] + rune(rng.Intn(int(printable[i+1]-printable[i]+1)))
+}
+
+// ratings gives items ratings by the generated users. Each item has a quality
+// and each user a harshness, so grades lean the same way for an item and for a
+// user, and popular items collect more ratings. Ratings are shared with the
+// author's friends in a random friendship graph.
+func (g *generator) ratings(data *GeneratedData) {
+	users := len(data.Users)
+	if users == 0 || g.opts.RatingsPerItem == 0 {
+		return
+	}
+
+	friends := make([][]int, users)
+	if users > 1 {
+		p := *g.opts.FriendsPerUser / float64(users-1)
+		for i := 0; i < users; i++ {
+			for j := i + 1; j < users; j++ {
+				if g.rng.Float64() < p {
+					friends[i] = append(friends[i], j)
+					friends[j] = append(friends[j], i)
+				}
+			}
+		}
+	}
+
+	harshness := make([]float64, users)
+	for i := range harshness {
+		harshness[i] = g.rng.NormFloat64() * 0.4
+	}
+
+	scale := g.cached.RatingScale()
+	criteria := g.cached.RatingCriteria()
+	rate := g.opts.RatingsPerItem / float64(users)
+	for i := range data.Items {
+		quality := g.rng.NormFloat64() * 0.6
+		// exp of a normal averages exp(σ²/2), divided out to keep the mean rate
+		popularity := math.Exp(g.rng.NormFloat64()*0.5) / math.Exp(0.125)
+
+		for u := 0; u < users; u++ {
+			if g.rng.Float64() >= rate*popularity {
+				continue
+			}
+			// Grades are drawn as stars out of 5, then mapped onto the schema's scale
+			stars := math.Max(0.5, math.Min(5, 3.6+quality+harshness[u]+g.rng.NormFloat64()*0.5))
+			grade := float32(scale.Denormalize(stars / 5))
+			rating := SeedRating{User: data.Users[u].Email, Grade: &grade}
+			// Criterion scores wander around the overall impression, which is then
+			// their weighted overall
+			if len(criteria) > 0 {
+				rating.Scores = make(map[string]float64, len(criteria))
+				for _, criterion := range criteria {
+					criterionStars := math.Max(0.5, math.Min(5, stars+g.rng.NormFloat64()*0.4))
+					rating.Scores[criterion.Key] = criterion.ScaleOf(scale).Denormalize(criterionStars / 5)
+				}
+				overall, _ := OverallGrade(g.cached, rating.Scores)
+				grade = float32(overall)
+			}
+			if g.rng.Float64() < 0.3 {
+				rating.Note = generateNotes[g.rng.Intn(len(generateNotes))]
+			}
+			for _, friend := range friends[u] {
+				if g.rng.Float64() < generateShareRate {
+					rating.SharedWith = append(rating.SharedWith, data.Users[friend].Email)
+				}
+			}
+			data.Items[i].Ratings = append(data.Items[i].Ratings, rating)
+		}
+	}
+}
+
+// CreateGeneratedUsers stores generated users that do not exist yet; users from
+// an earlier run with the same seed are reused. They are not discoverable, so
+// they never show up among the users real people can share with.
+func CreateGeneratedUsers(users []GeneratedUser) error {
+	for _, generated := range users {
+		var user models.User
+		err := utils.DB.Where("email = ?", generated.Email).First(&user).Error
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to look up user: %w", err)
+		}
+		user = models.User{
+			GoogleID:         "generated-" + generated.Email,
+			Email:            generated.Email,
+			FullName:         generated.DisplayName,
+			DisplayName:      generated.DisplayName,
+			Discoverable:     false,
+			ProfileCompleted: true,
+			LastLoginAt:      time.Now(),
+		}
+		if err := utils.DB.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed to create user %s: %w", generated.Email, err)
+		}
+	}
+	return nil
+}
+
+const generateAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+var (
+	generateAdjectives = []string{
+		"Golden", "Wild", "Old", "Royal", "Smoky", "Silver", "Velvet", "Rustic", "Bright", "Hidden",
+		"Northern", "Misty", "Amber", "Black", "Little", "Grand", "Quiet", "Crimson", "Mountain", "Coastal",
+	}
+	generateNouns = []string{
+		"Meadow", "Ridge", "Harbor", "Valley", "Reserve", "Cellar", "Orchard", "Summit", "Forest", "River",
+		"Abbey", "Garden", "Hollow", "Crest", "Field", "Cove", "Grove", "Stone", "Vale", "Heath",
+	}
+	generatePlaces = []string{
+		"France", "Italy", "Spain", "Portugal", "Switzerland", "Netherlands", "Belgium", "England", "Scotland", "Ireland",
+		"Germany", "Austria", "Greece", "Québec", "Ontario", "Vermont", "California", "Oregon", "Japan", "Mexico",
+	}
+	generateMakerPrefixes = []string{"Maison", "Domaine", "House of", "Atelier", "Fromagerie", "Distillerie", "Brothers", "Workshop"}
+	generateSurnames      = []string{
+		"Martin", "Bernard", "Dubois", "Tremblay", "Gagnon", "Roy", "Moreau", "Laurent", "Fontaine", "Rossi",
+		"Ferrari", "García", "Silva", "Müller", "Schmidt", "Smith", "Walsh", "Murphy", "Sato", "Novak",
+	}
+	generateWords = []string{
+		"rich", "creamy", "nutty", "bright", "earthy", "crisp", "smooth", "floral", "bold", "delicate",
+		"finish", "aroma", "texture", "notes", "hint", "balance", "aged", "fresh", "sweet", "dry",
+		"citrus", "herbal", "spicy", "woody", "fruity", "mellow", "long", "subtle", "toasted", "honey",
+	}
+	generateNotes = []string{
+		"Would buy again.", "A bit too strong for me.", "Perfect with friends.", "Better than expected.",
+		"Not my favourite.", "Great value.", "Lovely finish.", "Tried it at a tasting.",
+	}
+	generateFirstNames = []string{
+		"Camille", "Alex", "Sam", "Jordan", "Charlie", "Morgan", "Robin", "Dominique", "Noa", "Sacha",
+		"Lou", "Eden", "Maxime", "Andrea", "Kim", "Riley", "Jesse", "Claude", "Ariel", "Quinn",
+	}
+	generateLastInitials = []rune("ABCDEFGHJKLMNPRSTVW")
+)
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"math/rand"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestGenerateData(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetActiveSchema("cheese")
+	cached.UniqueFields = []string{"name"}
+	code := `{"pattern":"^[A-Z]{2}-\\d{3}$"}`
+	cached.Fields[1].Validation = &code // type
+	validation := NewValidationEngine(registry)
+
+	friends := 2.0
+	opts := GenerateOptions{Count: 300, Seed: 42, Users: 8, RatingsPerItem: 3, FriendsPerUser: &friends}
+	data, err := GenerateData(cached, opts)
+	if err != nil {
+		t.Fatalf("GenerateData failed: %v", err)
+	}
+	if len(data.Items) != 300 || len(data.Users) != 8 || data.Seed != 42 {
+		t.Fatalf("expected 300 items and 8 users for seed 42, got %d and %d for %d", len(data.Items), len(data.Users), data.Seed)
+	}
+
+	again, _ := GenerateData(cached, opts)
+	if !reflect.DeepEqual(data, again) {
+		t.Error("expected the same seed to generate the same data")
+	}
+	opts.Seed = 43
+	if other, _ := GenerateData(cached, opts); reflect.DeepEqual(data.Items, other.Items) {
+		t.Error("expected another seed to generate other data")
+	}
+
+	names := make(map[interface{}]bool)
+	emails := make(map[string]bool)
+	for _, user := range data.Users {
+		emails[user.Email] = true
+	}
+	ratings := 0
+	for _, item := range data.Items {
+		if result := validation.ValidateCreate("cheese", item.Fields); !result.Valid {
+			t.Fatalf("item %d is invalid: %+v (%v)", item.Position, result.Errors, item.Fields)
+		}
+		if names[item.Fields["name"]] {
+			t.Fatalf("name %v was generated twice", item.Fields["name"])
+		}
+		names[item.Fields["name"]] = true
+
+		raters := make(map[string]bool)
+		for _, rating := range item.Ratings {
+			ratings++
+			if *rating.Grade < 0.5 || *rating.Grade > 5 || *rating.Grade*2 != float32(int(*rating.Grade*2)) {
+				t.Fatalf("grade %v is not a half step between 0.5 and 5", *rating.Grade)
+			}
+			if raters[rating.User] || !emails[rating.User] {
+				t.Fatalf("unexpected rater %s", rating.User)
+			}
+			raters[rating.User] = true
+			for _, viewer := range rating.SharedWith {
+				if viewer == rating.User || !emails[viewer] {
+					t.Fatalf("unexpected viewer %s of a rating by %s", viewer, rating.User)
+				}
+			}
+		}
+	}
+	// Around 3 ratings per item on average
+	if ratings < 600 || ratings > 1200 {
+		t.Errorf("expected about 900 ratings, got %d", ratings)
+	}
+}
+
+func TestGenerateData_RatingScale(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetActiveSchema("cheese")
+	points := `{"min":50,"max":100,"step":1}`
+	cached.Schema.RatingScale = &points
+
+	data, err := GenerateData(cached, GenerateOptions{Count: 50, Seed: 3, Users: 5, RatingsPerItem: 4})
+	if err != nil {
+		t.Fatalf("GenerateData failed: %v", err)
+	}
+	scale := cached.RatingScale()
+	for _, item := range data.Items {
+		for _, rating := range item.Ratings {
+			if err := scale.Check(float64(*rating.Grade)); err != nil {
+				t.Fatalf("grade %v is off the schema's scale: %v", *rating.Grade, err)
+			}
+		}
+	}
+}
+
+func TestGenerateData_RatingCriteria(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetActiveSchema("cheese")
+	criteria := `[{"key":"texture","label":"Texture"},{"key":"taste","label":"Taste","weight":2,"scale":{"min":0,"max":100,"step":1}}]`
+	cached.Schema.RatingCriteria = &criteria
+	validation := NewValidationEngine(registry)
+
+	data, err := GenerateData(cached, GenerateOptions{Count: 30, Seed: 5, Users: 4, RatingsPerItem: 3})
+	if err != nil {
+		t.Fatalf("GenerateData failed: %v", err)
+	}
+	for _, item := range data.Items {
+		for _, rating := range item.Ratings {
+			grade := float64(*rating.Grade)
+			if result := validation.ValidateRating("cheese", &grade, rating.Scores); !result.Valid || len(rating.Scores) != 2 {
+				t.Fatalf("invalid generated rating %+v: %+v", rating, result.Errors)
+			}
+			if overall, _ := OverallGrade(cached, rating.Scores); overall != grade {
+				t.Fatalf("expected the grade to be the overall %v of the scores, got %v", overall, grade)
+			}
+		}
+	}
+}
+
+func TestGenerateData_Options(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetActiveSchema("cheese")
+
+	tests := []GenerateOptions{
+		{Count: 0},
+		{Count: MaxGenerateItems + 1},
+		{Count: 1, Users: -1},
+		{Count: 1, Users: 2, RatingsPerItem: 3},
+	}
+	for _, opts := range tests {
+		if _, err := GenerateData(cached, opts); err == nil {
+			t.Errorf("expected %+v to be refused", opts)
+		}
+	}
+
+	// A schema cannot hold more unique items than its options allow
+	cached.UniqueFields = []string{"color"}
+	cached.Fields[6].Required = true
+	if _, err := GenerateData(cached, GenerateOptions{Count: 10, Seed: 1}); err == nil {
+		t.Error("expected more items than unique colors to be refused")
+	}
+}
+
+func TestGenerateFromPattern(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	patterns := []string{`^\d{4}$`, `^[A-Z][a-z]+(-[A-Z][a-z]+)?$`, `^(red|white|rosé)$`, `^\w+@example\.com$`, `^.{3,5}$`}
+	for _, pattern := range patterns {
+		for i := 0; i < 20; i++ {
+			value, err := generateFromPattern(rng, pattern)
+			if err != nil {
+				t.Fatalf("%s: %v", pattern, err)
+			}
+			if !regexp.MustCompile(pattern).MatchString(value) {
+				t.Fatalf("%q does not match %s", value, pattern)
+			}
+		}
+	}
+}
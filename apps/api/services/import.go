@@ -0,0 +1,301 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+)
+
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatXLSX = "xlsx"
+
+	DefaultImportPreviewRows = 20
+	MaxImportPreviewRows     = 100
+	// MaxImportRows bounds a single import, whose rows are all stored in the
+	// payload of the background job that applies them
+	MaxImportRows = 10000
+	// maxImportLine is the last line a record can be on, matching the last row of
+	// a spreadsheet. Records are placed at their line number, so this bounds the
+	// blank lines padded in before them.
+	maxImportLine = 1 << 20
+)
+
+// ImportTable is a parsed spreadsheet: its header row and the data rows below it.
+// Line is the row's line number in the file, for error messages.
+type ImportTable struct {
+	Headers []string
+	Rows    []ImportSourceRow
+}
+
+type ImportSourceRow struct {
+	Line   int
+	Values []string
+}
+
+// ImportRow is a data row turned into field values. Errors holds the values that
+// could not be converted to their field type, and later the validation errors.
+type ImportRow struct {
+	Line   int                    `json:"line"`
+	Fields map[string]interface{} `json:"fields"`
+	Errors []ValidationError      `json:"errors,omitempty"`
+}
+
+// ImportFormat picks the format from an explicit value or the file extension
+func ImportFormat(format string, filename string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	switch strings.ToLower(format) {
+	case ImportFormatCSV, "txt", "tsv":
+		return ImportFormatCSV, nil
+	case ImportFormatXLSX:
+		return ImportFormatXLSX, nil
+	}
+	return "", fmt.Errorf("unsupported import format %q; use csv or xlsx", format)
+}
+
+// ParseImportTable reads a CSV or XLSX file. The first non-empty row is the
+// header; blank rows are dropped but keep their place in line numbers.
+func ParseImportTable(format string, data []byte) (*ImportTable, error) {
+	var records [][]string
+	var err error
+	switch format {
+	case ImportFormatCSV:
+		records, err = readImportCSV(data)
+	case ImportFormatXLSX:
+		records, err = utils.ReadXLSX(data)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q; use csv or xlsx", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table := &ImportTable{}
+	for i, record := range records {
+		if isBlankRecord(record) {
+			continue
+		}
+		if table.Headers == nil {
+			table.Headers = make([]string, len(record))
+			for j, header := range record {
+				table.Headers[j] = strings.TrimSpace(header)
+			}
+			continue
+		}
+		table.Rows = append(table.Rows, ImportSourceRow{Line: i + 1, Values: record})
+	}
+
+	if table.Headers == nil {
+		return nil, fmt.Errorf("file has no header row")
+	}
+	if len(table.Rows) > MaxImportRows {
+		return nil, fmt.Errorf("file has %d rows; at most %d can be imported at once", len(table.Rows), MaxImportRows)
+	}
+	return table, nil
+}
+
+// readImportCSV parses CSV exported by spreadsheet tools, which may start with a
+// byte order mark and use semicolons or tabs depending on the locale
+func readImportCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	firstLine := data
+	if end := bytes.IndexByte(data, '\n'); end >= 0 {
+		firstLine = data[:end]
+	}
+	delimiter := ','
+	for _, candidate := range []rune{';', '\t'} {
+		if bytes.Count(firstLine, []byte(string(candidate))) > bytes.Count(firstLine, []byte(string(delimiter))) {
+			delimiter = candidate
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	// The reader skips empty lines, so records are placed at their line number
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if line > maxImportLine {
+			return nil, fmt.Errorf("file has more than %d lines", maxImportLine)
+		}
+		for len(records) < line-1 {
+			records = append(records, nil)
+		}
+		for i, cell := range record {
+			record[i] = unescapeCSVFormula(cell)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// SuggestImportMapping maps each header to the field whose key or label it
+// matches once case, accents and punctuation are ignored. Headers with no match
+// are left out, and a field is used at most once.
+func SuggestImportMapping(fields []*models.ItemTypeField, headers []string) map[string]string {
+	byName := make(map[string]string, len(fields)*2)
+	for _, field := range fields {
+		byName[normalizeName(field.Label)] = field.Key
+	}
+	// Keys win over labels when both match different fields
+	for _, field := range fields {
+		byName[normalizeName(field.Key)] = field.Key
+	}
+
+	mapping := make(map[string]string)
+	used := make(map[string]bool)
+	for _, header := range headers {
+		key, found := byName[normalizeName(header)]
+		if !found || used[key] || header == "" {
+			continue
+		}
+		mapping[header] = key
+		used[key] = true
+	}
+	return mapping
+}
+
+// BuildImportRows converts the rows of a table into field values following the
+// mapping from header to field key. Empty cells are left out.
+func BuildImportRows(fields []*models.ItemTypeField, table *ImportTable, mapping map[string]string) ([]ImportRow, error) {
+	fieldsByKey := make(map[string]*models.ItemTypeField, len(fields))
+	for _, field := range fields {
+		fieldsByKey[field.Key] = field
+	}
+
+	type importColumn struct {
+		index int
+		field *models.ItemTypeField
+	}
+	columns := make([]importColumn, 0, len(mapping))
+	mapped := make(map[string]string, len(mapping))
+	for index, header := range table.Headers {
+		key, ok := mapping[header]
+		if !ok || key == "" {
+			continue
+		}
+		field, found := fieldsByKey[key]
+		if !found {
+			return nil, fmt.Errorf("column '%s' is mapped to unknown field '%s'", header, key)
+		}
+		if other, taken := mapped[key]; taken {
+			return nil, fmt.Errorf("columns '%s' and '%s' are both mapped to field '%s'", other, header, key)
+		}
+		mapped[key] = header
+		columns = append(columns, importColumn{index, field})
+	}
+	for header := range mapping {
+		if !containsString(table.Headers, header) {
+			return nil, fmt.Errorf("mapped column '%s' is not in the file", header)
+		}
+	}
+
+	rows := make([]ImportRow, len(table.Rows))
+	for i, source := range table.Rows {
+		row := ImportRow{Line: source.Line, Fields: make(map[string]interface{}, len(columns))}
+		for _, column := range columns {
+			if column.index >= len(source.Values) {
+				continue
+			}
+			field := column.field
+			raw := strings.TrimSpace(source.Values[column.index])
+			if raw == "" {
+				continue
+			}
+			value, err := CoerceImportValue(field, raw)
+			if err != nil {
+				row.Errors = append(row.Errors, *err)
+				continue
+			}
+			row.Fields[field.Key] = value
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// CoerceImportValue converts a cell to the type its field stores: numbers accept a
+// decimal comma, checkboxes the usual yes/no spellings, and select options match
+// regardless of case
+func CoerceImportValue(field *models.ItemTypeField, raw string) (interface{}, *ValidationError) {
+	switch field.FieldType {
+	case models.FieldTypeNumber:
+		number, err := strconv.ParseFloat(strings.Replace(strings.ReplaceAll(raw, " ", ""), ",", ".", 1), 64)
+		if err != nil {
+			return nil, &ValidationError{
+				Field:   field.Key,
+				Label:   field.Label,
+				Code:    "type_mismatch",
+				Message: fmt.Sprintf("%s must be a number", field.Label),
+				Details: map[string]interface{}{"expected": "number", "actual": raw},
+			}
+		}
+		return number, nil
+
+	case models.FieldTypeCheckbox:
+		switch strings.ToLower(raw) {
+		case "true", "yes", "y", "1", "x", "oui", "vrai":
+			return true, nil
+		case "false", "no", "n", "0", "non", "faux":
+			return false, nil
+		}
+		return nil, &ValidationError{
+			Field:   field.Key,
+			Label:   field.Label,
+			Code:    "type_mismatch",
+			Message: fmt.Sprintf("%s must be a boolean", field.Label),
+			Details: map[string]interface{}{"expected": "boolean", "actual": raw},
+		}
+
+	case models.FieldTypeSelect, models.FieldTypeEnum:
+		// Unknown options are left to validation, which lists the allowed ones
+		if options, err := ParseFieldOptions(field); err == nil {
+			for _, option := range options {
+				if strings.EqualFold(option, raw) {
+					return option, nil
+				}
+			}
+		}
+		return raw, nil
+	}
+
+	return raw, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
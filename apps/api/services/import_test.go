@@ -0,0 +1,178 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func buildTestXLSX(t *testing.T) []byte {
+	t.Helper()
+	return buildTestXLSXSheet(t, `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>Organic</t></is></c></row>
+<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3"><v>18</v></c><c r="C3" t="b"><v>1</v></c></row>
+<row r="4"><c r="C4" t="b"><v>0</v></c></row>`)
+}
+
+func buildTestXLSXSheet(t *testing.T, rows string) []byte {
+	t.Helper()
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Cheeses" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Name</t></si><si><t>Âge</t></si><si><r><t>Com</t></r><r><t>té</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+` + rows + `
+</sheetData></worksheet>`,
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseImportTable_CSV(t *testing.T) {
+	data := []byte("\xef\xbb\xbfName;Âge;Organic\nComté;18,5;oui\n\n;;\nBrie;;\n")
+
+	table, err := ParseImportTable(ImportFormatCSV, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(table.Headers, []string{"Name", "Âge", "Organic"}) {
+		t.Errorf("unexpected headers %v", table.Headers)
+	}
+	if len(table.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(table.Rows))
+	}
+	if table.Rows[0].Line != 2 || table.Rows[1].Line != 5 {
+		t.Errorf("expected lines 2 and 5, got %d and %d", table.Rows[0].Line, table.Rows[1].Line)
+	}
+
+	if _, err := ParseImportTable(ImportFormatCSV, []byte("\n\n")); err == nil {
+		t.Error("expected an error for a file without header")
+	}
+
+	// Records past the last spreadsheet line are refused rather than padded to
+	padded := append([]byte("Name\n"), bytes.Repeat([]byte("\n"), maxImportLine)...)
+	if _, err := ParseImportTable(ImportFormatCSV, append(padded, "Brie\n"...)); err == nil {
+		t.Error("expected an error for a record past the last line")
+	}
+}
+
+func TestParseImportTable_XLSX(t *testing.T) {
+	table, err := ParseImportTable(ImportFormatXLSX, buildTestXLSX(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(table.Headers, []string{"Name", "Âge", "Organic"}) {
+		t.Errorf("unexpected headers %v", table.Headers)
+	}
+	if len(table.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(table.Rows))
+	}
+	if table.Rows[0].Line != 3 || !reflect.DeepEqual(table.Rows[0].Values, []string{"Comté", "18", "true"}) {
+		t.Errorf("unexpected first row %+v", table.Rows[0])
+	}
+	if !reflect.DeepEqual(table.Rows[1].Values, []string{"", "", "false"}) {
+		t.Errorf("expected missing cells to be padded, got %v", table.Rows[1].Values)
+	}
+
+	if _, err := ParseImportTable(ImportFormatXLSX, []byte("not a zip")); err == nil {
+		t.Error("expected an error for an invalid workbook")
+	}
+
+	// A row number past the last row of a sheet is refused rather than padded to
+	far := buildTestXLSXSheet(t, `<row r="1"><c r="A1" t="inlineStr"><is><t>Name</t></is></c></row>
+<row r="2000000000"><c r="A2000000000" t="inlineStr"><is><t>Brie</t></is></c></row>`)
+	if _, err := ParseImportTable(ImportFormatXLSX, far); err == nil {
+		t.Error("expected an error for a row past the last row")
+	}
+}
+
+func TestImportFormat(t *testing.T) {
+	tests := []struct {
+		format, filename, expected string
+	}{
+		{"", "cheeses.CSV", ImportFormatCSV},
+		{"", "cheeses.xlsx", ImportFormatXLSX},
+		{"xlsx", "upload", ImportFormatXLSX},
+	}
+	for _, tt := range tests {
+		if got, err := ImportFormat(tt.format, tt.filename); err != nil || got != tt.expected {
+			t.Errorf("ImportFormat(%q, %q) = %q, %v; expected %q", tt.format, tt.filename, got, err, tt.expected)
+		}
+	}
+	if _, err := ImportFormat("", "cheeses.pdf"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestSuggestImportMapping(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetSchema("cheese")
+
+	mapping := SuggestImportMapping(cached.Fields, []string{"NAME", "Âge", "organic ", "Name", "Notes"})
+	expected := map[string]string{"NAME": "name", "Âge": "age", "organic ": "organic"}
+	if !reflect.DeepEqual(mapping, expected) {
+		t.Errorf("expected %v, got %v", expected, mapping)
+	}
+}
+
+func TestBuildImportRows(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetSchema("cheese")
+
+	table := &ImportTable{
+		Headers: []string{"Name", "Age", "Style", "Organic", "Notes"},
+		Rows: []ImportSourceRow{
+			{Line: 2, Values: []string{" Comté ", "18,5", "hard", "Yes", "ignored"}},
+			{Line: 3, Values: []string{"Brie", "young", "Runny", "maybe"}},
+			{Line: 4, Values: []string{"Feta"}},
+		},
+	}
+	mapping := map[string]string{"Name": "name", "Age": "age", "Style": "style", "Organic": "organic"}
+
+	rows, err := BuildImportRows(cached.Fields, table, mapping)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{"name": "Comté", "age": 18.5, "style": "Hard", "organic": true}
+	if !reflect.DeepEqual(rows[0].Fields, expected) || len(rows[0].Errors) != 0 {
+		t.Errorf("unexpected first row %+v", rows[0])
+	}
+
+	// Unknown options pass through for validation to reject
+	if rows[1].Fields["style"] != "Runny" {
+		t.Errorf("expected unknown option to be kept, got %v", rows[1].Fields["style"])
+	}
+	if len(rows[1].Errors) != 2 {
+		t.Errorf("expected number and checkbox errors, got %+v", rows[1].Errors)
+	}
+
+	if !reflect.DeepEqual(rows[2].Fields, map[string]interface{}{"name": "Feta"}) {
+		t.Errorf("expected short rows to leave fields out, got %v", rows[2].Fields)
+	}
+
+	if _, err := BuildImportRows(cached.Fields, table, map[string]string{"Name": "unknown"}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+	if _, err := BuildImportRows(cached.Fields, table, map[string]string{"Missing": "name"}); err == nil {
+		t.Error("expected an error for a missing column")
+	}
+	if _, err := BuildImportRows(cached.Fields, table, map[string]string{"Name": "name", "Notes": "name"}); err == nil {
+		t.Error("expected an error for a field mapped twice")
+	}
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+)
+
+const (
+	IncludeCommunityStats = "community_stats"
+	IncludeMyRating       = "my_rating"
+	IncludeImage          = "image"
+)
+
+// itemBaseKeys are always returned so a projected item can still be identified
+// and conditionally updated
+var itemBaseKeys = []string{"id", "schema_type", "version"}
+
+// itemBuiltinKeys are the non-field keys that can be requested in a projection
+var itemBuiltinKeys = map[string]bool{
+	"name":         true,
+	"image_url":    true,
+	"user_id":      true,
+	"created_at":   true,
+	"updated_at":   true,
+	"field_values": true,
+}
+
+// ItemResponseOptions controls the shape of the item maps returned to clients:
+// Fields restricts the keys returned, Include embeds related data.
+type ItemResponseOptions struct {
+	Fields   []string
+	Include  []string
+	ViewerID uint
+}
+
+// ShapeItems embeds the requested relations into items built by buildItemMap and
+// applies the sparse fieldset. Relations are loaded with one query per include
+// for the whole batch. The slice is updated in place.
+func (qb *EAVQueryBuilder) ShapeItems(schemaName string, items []map[string]interface{}, opts ItemResponseOptions) error {
+	if err := qb.validateResponseOptions(schemaName, opts); err != nil {
+		return err
+	}
+
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return err
+	}
+	if err := embedIncludes(items, opts, cached.RatingScale()); err != nil {
+		return err
+	}
+
+	// Projection runs last so includes can read any key and are always kept
+	if len(opts.Fields) > 0 {
+		keep := append(append([]string{}, opts.Fields...), opts.Include...)
+		for i, item := range items {
+			items[i] = projectItem(item, keep)
+		}
+	}
+
+	return nil
+}
+
+func embedIncludes(items []map[string]interface{}, opts ItemResponseOptions, scale RatingScale) error {
+	if len(opts.Include) == 0 || len(items) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		if id, ok := item["id"].(uint); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, include := range opts.Include {
+		switch include {
+		case IncludeCommunityStats:
+			stats, err := communityStatsByItem(ids, scale)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				id, _ := item["id"].(uint)
+				if s, ok := stats[id]; ok {
+					item[IncludeCommunityStats] = s
+				} else {
+					item[IncludeCommunityStats] = CommunityStats(0, 0, scale)
+				}
+			}
+		case IncludeMyRating:
+			ratings, err := viewerRatingsByItem(ids, opts.ViewerID)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				id, _ := item["id"].(uint)
+				if r, ok := ratings[id]; ok {
+					item[IncludeMyRating] = r
+				} else {
+					item[IncludeMyRating] = nil
+				}
+			}
+		case IncludeImage:
+			for _, item := range items {
+				item[IncludeImage] = imageInfo(item)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (qb *EAVQueryBuilder) validateResponseOptions(schemaName string, opts ItemResponseOptions) error {
+	for _, key := range opts.Fields {
+		if itemBuiltinKeys[key] || key == "id" || key == "schema_type" {
+			continue
+		}
+		if _, found := qb.registry.GetFieldByKey(schemaName, key); !found {
+			return fmt.Errorf("unknown field '%s'", key)
+		}
+	}
+
+	for _, include := range opts.Include {
+		switch include {
+		case IncludeCommunityStats, IncludeMyRating, IncludeImage:
+		default:
+			return fmt.Errorf("unknown include '%s'", include)
+		}
+	}
+
+	return nil
+}
+
+func projectItem(item map[string]interface{}, fields []string) map[string]interface{} {
+	projected := make(map[string]interface{}, len(fields)+len(itemBaseKeys))
+	for _, key := range itemBaseKeys {
+		projected[key] = item[key]
+	}
+	for _, key := range fields {
+		if value, exists := item[key]; exists {
+			projected[key] = value
+		}
+	}
+	return projected
+}
+
+// CommunityStats describes an item's ratings: their count and average grade,
+// raw on the schema's scale and normalized to 0-1 to compare across schemas
+func CommunityStats(count int, average float64, scale RatingScale) map[string]interface{} {
+	normalized := 0.0
+	if count > 0 {
+		normalized = scale.Normalize(average)
+	}
+	return map[string]interface{}{
+		"total_ratings":      count,
+		"average_rating":     average,
+		"normalized_average": normalized,
+	}
+}
+
+func communityStatsByItem(ids []uint, scale RatingScale) (map[uint]map[string]interface{}, error) {
+	var rows []struct {
+		ItemID  uint
+		Count   int
+		Average float64
+	}
+	if err := utils.DB.Model(&models.Rating{}).
+		Select("item_id, COUNT(*) AS count, COALESCE(AVG(grade), 0) AS average").
+		Where("item_id IN ?", ids).
+		Group("item_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load community stats: %w", err)
+	}
+
+	stats := make(map[uint]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		stats[row.ItemID] = CommunityStats(row.Count, row.Average, scale)
+	}
+	return stats, nil
+}
+
+func viewerRatingsByItem(ids []uint, viewerID uint) (map[uint]map[string]interface{}, error) {
+	if viewerID == 0 {
+		return map[uint]map[string]interface{}{}, nil
+	}
+
+	var ratings []models.Rating
+	if err := utils.DB.
+		Where("user_id = ? AND item_id IN ?", viewerID, ids).
+		Find(&ratings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load ratings: %w", err)
+	}
+
+	result := make(map[uint]map[string]interface{}, len(ratings))
+	for _, rating := range ratings {
+		result[uint(rating.ItemID)] = map[string]interface{}{
+			"id":         rating.ID,
+			"grade":      rating.Grade,
+			"note":       rating.Note,
+			"created_at": rating.CreatedAt,
+			"updated_at": rating.UpdatedAt,
+		}
+	}
+	return result, nil
+}
+
+func imageInfo(item map[string]interface{}) map[string]interface{} {
+	url, _ := item["image_url"].(*string)
+	if url == nil || *url == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"url":      *url,
+		"filename": (*url)[strings.LastIndex(*url, "/")+1:],
+	}
+}
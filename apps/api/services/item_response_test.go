@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+)
+
+func testItemMap(id uint, imageURL *string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           id,
+		"name":         "Brie",
+		"schema_type":  "cheese",
+		"version":      3,
+		"image_url":    imageURL,
+		"user_id":      1,
+		"type":         "Soft",
+		"origin":       "France",
+		"field_values": map[string]interface{}{"name": "Brie", "type": "Soft", "origin": "France"},
+	}
+}
+
+func TestShapeItems_Projection(t *testing.T) {
+	qb := NewEAVQueryBuilder(createTestRegistry())
+
+	items := []map[string]interface{}{testItemMap(1, nil), testItemMap(2, nil)}
+	if err := qb.ShapeItems("cheese", items, ItemResponseOptions{Fields: []string{"name", "origin"}}); err != nil {
+		t.Fatalf("failed to shape items: %v", err)
+	}
+
+	for _, item := range items {
+		if len(item) != 5 {
+			t.Errorf("expected id, schema_type, version, name and origin only, got %v", item)
+		}
+		if item["origin"] != "France" || item["id"] == nil || item["version"] != 3 {
+			t.Errorf("unexpected projected item: %v", item)
+		}
+		if _, exists := item["field_values"]; exists {
+			t.Error("expected field_values to be dropped")
+		}
+	}
+}
+
+func TestShapeItems_NoOptions(t *testing.T) {
+	qb := NewEAVQueryBuilder(createTestRegistry())
+
+	items := []map[string]interface{}{testItemMap(1, nil)}
+	if err := qb.ShapeItems("cheese", items, ItemResponseOptions{}); err != nil {
+		t.Fatalf("failed to shape items: %v", err)
+	}
+	if len(items[0]) != 9 {
+		t.Errorf("expected item to be unchanged, got %v", items[0])
+	}
+}
+
+func TestShapeItems_Image(t *testing.T) {
+	qb := NewEAVQueryBuilder(createTestRegistry())
+
+	url := "http://localhost:9000/alacarte-images/cheese_1.jpg"
+	items := []map[string]interface{}{testItemMap(1, &url), testItemMap(2, nil)}
+	opts := ItemResponseOptions{Fields: []string{"name"}, Include: []string{IncludeImage}}
+	if err := qb.ShapeItems("cheese", items, opts); err != nil {
+		t.Fatalf("failed to shape items: %v", err)
+	}
+
+	image, ok := items[0]["image"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected image to be embedded, got %v", items[0])
+	}
+	if image["filename"] != "cheese_1.jpg" {
+		t.Errorf("expected filename cheese_1.jpg, got %v", image["filename"])
+	}
+	if _, exists := items[0]["image_url"]; exists {
+		t.Error("expected image_url to be projected out")
+	}
+	if items[1]["image"].(map[string]interface{}) != nil {
+		t.Errorf("expected no image for item without one, got %v", items[1]["image"])
+	}
+}
+
+func TestShapeItems_InvalidOptions(t *testing.T) {
+	qb := NewEAVQueryBuilder(createTestRegistry())
+
+	if err := qb.ShapeItems("cheese", nil, ItemResponseOptions{Fields: []string{"bogus"}}); err == nil {
+		t.Error("expected unknown field to be rejected")
+	}
+	if err := qb.ShapeItems("cheese", nil, ItemResponseOptions{Include: []string{"ratings"}}); err == nil {
+		t.Error("expected unknown include to be rejected")
+	}
+}
@@ -0,0 +1,471 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// jobSweepInterval is how often the runner looks for jobs it was not handed
+	// directly: queued on a busy instance, or left behind by a stopped one
+	jobSweepInterval = 30 * time.Second
+	// jobStaleAfter is how long a running job can go without a heartbeat before
+	// it is taken to be orphaned and resumed
+	jobStaleAfter = 2 * time.Minute
+	// jobCheckpointItems and jobCheckpointInterval bound how much work a restart
+	// can repeat: progress is saved after that many items or that much time
+	jobCheckpointItems    = 50
+	jobCheckpointInterval = 5 * time.Second
+)
+
+var errJobCancelled = fmt.Errorf("job cancelled")
+
+// jobPayload is what a job applies: the items to seed and how
+type jobPayload struct {
+	Items   []SeedItem  `json:"items"`
+	Options SeedOptions `json:"options"`
+}
+
+// JobEntry is a job as returned by the API
+type JobEntry struct {
+	ID              uint             `json:"id"`
+	Kind            models.JobKind   `json:"kind"`
+	Schema          string           `json:"schema"`
+	UserID          int              `json:"user_id"`
+	Status          models.JobStatus `json:"status"`
+	Mode            string           `json:"mode"`
+	DryRun          bool             `json:"dry_run"`
+	Total           int              `json:"total"`
+	Processed       int              `json:"processed"`
+	Progress        float64          `json:"progress"`
+	Added           int              `json:"added"`
+	Updated         int              `json:"updated"`
+	Skipped         int              `json:"skipped"`
+	Errors          []string         `json:"errors"`
+	Plan            []SeedPlanEntry  `json:"plan,omitempty"`
+	Error           string           `json:"error,omitempty"`
+	CancelRequested bool             `json:"cancel_requested"`
+	CreatedAt       time.Time        `json:"created_at"`
+	StartedAt       *time.Time       `json:"started_at,omitempty"`
+	FinishedAt      *time.Time       `json:"finished_at,omitempty"`
+}
+
+type JobListResult struct {
+	Jobs       []JobEntry `json:"jobs"`
+	Total      int64      `json:"total"`
+	Page       int        `json:"page"`
+	PerPage    int        `json:"per_page"`
+	TotalPages int        `json:"total_pages"`
+}
+
+// CreateSeedJob stores a seed or import job and hands it to the runner.
+// Problems found before the job was created, such as import rows that could not
+// be read, are passed as errors and plan entries and kept with its results.
+func CreateSeedJob(kind models.JobKind, schemaName string, userID uint, items []SeedItem, opts SeedOptions, errors []string, plan []SeedPlanEntry) (*JobEntry, error) {
+	payload, err := json.Marshal(jobPayload{Items: items, Options: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job: %w", err)
+	}
+	if errors == nil {
+		errors = []string{}
+	}
+	errorsJSON, _ := json.Marshal(errors)
+	planJSON, _ := json.Marshal(plan)
+
+	job := models.Job{
+		Kind:       kind,
+		SchemaName: schemaName,
+		UserID:     int(userID),
+		Status:     models.JobStatusQueued,
+		Payload:    string(payload),
+		Total:      len(items),
+		Errors:     string(errorsJSON),
+	}
+	if opts.DryRun {
+		job.Plan = string(planJSON)
+	}
+	if err := utils.DB.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+
+	GetJobRunner().Enqueue(job.ID)
+	return buildJobEntry(&job, &opts), nil
+}
+
+// GetJob returns a job with its progress and results
+func GetJob(jobID uint) (*JobEntry, error) {
+	job, err := loadJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	return buildJobEntry(job, nil), nil
+}
+
+// ListJobs returns jobs, newest first, optionally only those with a status
+func ListJobs(status string, page, perPage int) (*JobListResult, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 20
+	}
+	if perPage > 100 {
+		perPage = 100
+	}
+
+	query := utils.DB.Model(&models.Job{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	// The payload can be large and is not part of the response
+	var jobs []models.Job
+	if err := query.Omit("payload").Order("id DESC").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	entries := make([]JobEntry, len(jobs))
+	for i := range jobs {
+		entries[i] = *buildJobEntry(&jobs[i], nil)
+		// Plans are only returned for single jobs
+		entries[i].Plan = nil
+	}
+
+	totalPages := int(total) / perPage
+	if int(total)%perPage > 0 {
+		totalPages++
+	}
+
+	return &JobListResult{
+		Jobs:       entries,
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// CancelJob stops a job. A queued job is cancelled at once; a running one stops
+// at its next checkpoint, keeping the items it already processed.
+func CancelJob(jobID uint) (*JobEntry, error) {
+	job, err := loadJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.IsFinished() {
+		return nil, fmt.Errorf("job is already %s", job.Status)
+	}
+
+	now := time.Now()
+	if err := utils.DB.Model(&models.Job{}).
+		Where("id = ? AND status = ?", jobID, models.JobStatusQueued).
+		Updates(map[string]interface{}{
+			"status":           models.JobStatusCancelled,
+			"cancel_requested": true,
+			"finished_at":      now,
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+	if err := utils.DB.Model(&models.Job{}).
+		Where("id = ? AND status = ?", jobID, models.JobStatusRunning).
+		Update("cancel_requested", true).Error; err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	return GetJob(jobID)
+}
+
+func loadJob(jobID uint) (*models.Job, error) {
+	var job models.Job
+	if err := utils.DB.First(&job, jobID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("job not found")
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return &job, nil
+}
+
+// buildJobEntry decodes the stored results of a job. The options are read from
+// the payload unless given.
+func buildJobEntry(job *models.Job, opts *SeedOptions) *JobEntry {
+	entry := &JobEntry{
+		ID:              job.ID,
+		Kind:            job.Kind,
+		Schema:          job.SchemaName,
+		UserID:          job.UserID,
+		Status:          job.Status,
+		Total:           job.Total,
+		Processed:       job.Processed,
+		Added:           job.Added,
+		Updated:         job.Updated,
+		Skipped:         job.Skipped,
+		Errors:          []string{},
+		Error:           job.Error,
+		CancelRequested: job.CancelRequested,
+		CreatedAt:       job.CreatedAt,
+		StartedAt:       job.StartedAt,
+		FinishedAt:      job.FinishedAt,
+	}
+
+	if opts == nil && job.Payload != "" {
+		var payload struct {
+			Options SeedOptions `json:"options"`
+		}
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err == nil {
+			opts = &payload.Options
+		}
+	}
+	if opts != nil {
+		entry.Mode = opts.Mode
+		entry.DryRun = opts.DryRun
+	}
+
+	if job.Errors != "" {
+		json.Unmarshal([]byte(job.Errors), &entry.Errors)
+	}
+	if job.Plan != "" {
+		json.Unmarshal([]byte(job.Plan), &entry.Plan)
+	}
+
+	entry.Progress = 1
+	if job.Total > 0 {
+		entry.Progress = float64(job.Processed) / float64(job.Total)
+	}
+	return entry
+}
+
+// JobRunner runs seed and import jobs one at a time in the background. Jobs are
+// claimed in the database before they run, so several API instances can share
+// the queue, and a job left running by a stopped instance is resumed by another
+// once its heartbeat goes stale.
+type JobRunner struct {
+	qb        *EAVQueryBuilder
+	queue     chan uint
+	startOnce sync.Once
+}
+
+var (
+	jobRunner     *JobRunner
+	jobRunnerOnce sync.Once
+)
+
+func GetJobRunner() *JobRunner {
+	jobRunnerOnce.Do(func() {
+		jobRunner = &JobRunner{
+			qb:    NewEAVQueryBuilder(GetSchemaRegistry()),
+			queue: make(chan uint, 100),
+		}
+	})
+	return jobRunner
+}
+
+// Start launches the runner. It first resumes unfinished jobs, then runs jobs
+// as they are enqueued. Calling it again has no effect.
+func (r *JobRunner) Start() {
+	r.startOnce.Do(func() {
+		go r.loop()
+	})
+}
+
+// Enqueue hands a job to the runner. When the queue is full the job stays
+// queued in the database and is picked up by the next sweep.
+func (r *JobRunner) Enqueue(jobID uint) {
+	select {
+	case r.queue <- jobID:
+	default:
+	}
+}
+
+func (r *JobRunner) loop() {
+	ticker := time.NewTicker(jobSweepInterval)
+	defer ticker.Stop()
+
+	r.sweep()
+	for {
+		select {
+		case jobID := <-r.queue:
+			r.runJob(jobID)
+		case <-ticker.C:
+			r.sweep()
+		}
+	}
+}
+
+// sweep finishes orphaned jobs that were asked to stop, then runs the jobs that
+// are waiting or orphaned
+func (r *JobRunner) sweep() {
+	stale := time.Now().Add(-jobStaleAfter)
+
+	if err := utils.DB.Model(&models.Job{}).
+		Where("status = ? AND cancel_requested = ? AND heartbeat_at < ?", models.JobStatusRunning, true, stale).
+		Updates(map[string]interface{}{
+			"status":      models.JobStatusCancelled,
+			"finished_at": time.Now(),
+		}).Error; err != nil {
+		log.Printf("WARNING: failed to cancel orphaned jobs: %v", err)
+		return
+	}
+
+	var ids []uint
+	if err := utils.DB.Model(&models.Job{}).
+		Where("status = ? OR (status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?))", models.JobStatusQueued, models.JobStatusRunning, stale).
+		Order("id ASC").
+		Pluck("id", &ids).Error; err != nil {
+		log.Printf("WARNING: failed to look for pending jobs: %v", err)
+		return
+	}
+	for _, id := range ids {
+		r.runJob(id)
+	}
+}
+
+// claim marks a job as running on this instance, unless it is finished or
+// already running elsewhere
+func (r *JobRunner) claim(jobID uint) (*models.Job, bool) {
+	now := time.Now()
+	stale := now.Add(-jobStaleAfter)
+
+	result := utils.DB.Model(&models.Job{}).
+		Where("id = ? AND cancel_requested = ?", jobID, false).
+		Where("status = ? OR (status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?))", models.JobStatusQueued, models.JobStatusRunning, stale).
+		Updates(map[string]interface{}{
+			"status":       models.JobStatusRunning,
+			"heartbeat_at": now,
+			"started_at":   gorm.Expr("COALESCE(started_at, ?)", now),
+		})
+	if result.Error != nil {
+		log.Printf("WARNING: failed to claim job %d: %v", jobID, result.Error)
+		return nil, false
+	}
+	if result.RowsAffected == 0 {
+		return nil, false
+	}
+
+	job, err := loadJob(jobID)
+	if err != nil {
+		log.Printf("WARNING: failed to load job %d: %v", jobID, err)
+		return nil, false
+	}
+	return job, true
+}
+
+func (r *JobRunner) runJob(jobID uint) {
+	job, ok := r.claim(jobID)
+	if !ok {
+		return
+	}
+
+	result := utils.SeedResult{Added: job.Added, Updated: job.Updated, Skipped: job.Skipped}
+	var plan []SeedPlanEntry
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("WARNING: job %d panicked: %v", job.ID, recovered)
+			r.finish(job, models.JobStatusFailed, fmt.Sprintf("internal error: %v", recovered), job.Processed, result, plan)
+		}
+	}()
+
+	if job.Errors != "" {
+		json.Unmarshal([]byte(job.Errors), &result.Errors)
+	}
+	if job.Plan != "" {
+		json.Unmarshal([]byte(job.Plan), &plan)
+	}
+
+	var payload jobPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		r.finish(job, models.JobStatusFailed, fmt.Sprintf("invalid job payload: %v", err), job.Processed, result, plan)
+		return
+	}
+
+	processed := job.Processed
+	lastCheckpoint := time.Now()
+	err := r.qb.SeedItems(job.SchemaName, uint(job.UserID), payload.Items, job.Processed, payload.Options, &result, func(done int, entry SeedPlanEntry) error {
+		processed = done
+		if payload.Options.DryRun {
+			plan = append(plan, entry)
+		}
+		if done-job.Processed < jobCheckpointItems && time.Since(lastCheckpoint) < jobCheckpointInterval {
+			return nil
+		}
+		lastCheckpoint = time.Now()
+		return r.checkpoint(job, done, result, plan)
+	})
+
+	switch {
+	case err == errJobCancelled:
+		r.finish(job, models.JobStatusCancelled, "", processed, result, plan)
+	case err != nil:
+		r.finish(job, models.JobStatusFailed, err.Error(), processed, result, plan)
+	default:
+		r.finish(job, models.JobStatusCompleted, "", processed, result, plan)
+	}
+}
+
+// checkpoint saves a running job's progress and reports whether it should stop
+func (r *JobRunner) checkpoint(job *models.Job, processed int, result utils.SeedResult, plan []SeedPlanEntry) error {
+	updates := jobResultUpdates(processed, result, plan)
+	updates["heartbeat_at"] = time.Now()
+	if err := utils.DB.Model(&models.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to save job progress: %w", err)
+	}
+	job.Processed = processed
+
+	var current models.Job
+	if err := utils.DB.Select("id", "cancel_requested").First(&current, job.ID).Error; err != nil {
+		return fmt.Errorf("failed to read job: %w", err)
+	}
+	if current.CancelRequested {
+		return errJobCancelled
+	}
+	return nil
+}
+
+func (r *JobRunner) finish(job *models.Job, status models.JobStatus, message string, processed int, result utils.SeedResult, plan []SeedPlanEntry) {
+	updates := jobResultUpdates(processed, result, plan)
+	updates["status"] = status
+	updates["error"] = message
+	updates["finished_at"] = time.Now()
+	if err := utils.DB.Model(&models.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("WARNING: failed to save the result of job %d: %v", job.ID, err)
+		return
+	}
+	log.Printf("Job %d %s: %d processed, %d added, %d updated, %d skipped, %d errors", job.ID, status, processed, result.Added, result.Updated, result.Skipped, len(result.Errors))
+}
+
+func jobResultUpdates(processed int, result utils.SeedResult, plan []SeedPlanEntry) map[string]interface{} {
+	if result.Errors == nil {
+		result.Errors = []string{}
+	}
+	errorsJSON, _ := json.Marshal(result.Errors)
+	updates := map[string]interface{}{
+		"processed": processed,
+		"added":     result.Added,
+		"updated":   result.Updated,
+		"skipped":   result.Skipped,
+		"errors":    string(errorsJSON),
+	}
+	if plan != nil {
+		sort.SliceStable(plan, func(i, j int) bool { return plan[i].Position < plan[j].Position })
+		planJSON, _ := json.Marshal(plan)
+		updates["plan"] = string(planJSON)
+	}
+	return updates
+}
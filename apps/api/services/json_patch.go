@@ -0,0 +1,341 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is one operation of an RFC 6902 JSON Patch document
+type PatchOperation struct {
+	Op       string
+	Path     string
+	From     string
+	Value    interface{}
+	HasValue bool
+}
+
+// ApplyMergePatch applies an RFC 7396 merge patch to target and returns the
+// result. Objects are merged recursively, null removes a member and any other
+// value replaces the target outright. target is not modified.
+func ApplyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopyJSON(patch)
+	}
+
+	result, ok := deepCopyJSON(target).(map[string]interface{})
+	if !ok {
+		result = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = ApplyMergePatch(result[key], value)
+	}
+
+	return result
+}
+
+// ParseJSONPatch decodes an RFC 6902 JSON Patch document, keeping track of which
+// operations carry a value so that an explicit null can be told from a missing one
+func ParseJSONPatch(data []byte) ([]PatchOperation, error) {
+	var raw []map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON Patch document: %w", err)
+	}
+
+	ops := make([]PatchOperation, len(raw))
+	for i, entry := range raw {
+		op := PatchOperation{}
+		op.Op, _ = entry["op"].(string)
+		path, hasPath := entry["path"].(string)
+		if !hasPath {
+			return nil, fmt.Errorf("operation %d: missing path", i)
+		}
+		op.Path = path
+		op.Value, op.HasValue = entry["value"]
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if !op.HasValue {
+				return nil, fmt.Errorf("operation %d: missing value", i)
+			}
+		case "move", "copy":
+			from, hasFrom := entry["from"].(string)
+			if !hasFrom {
+				return nil, fmt.Errorf("operation %d: missing from", i)
+			}
+			op.From = from
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op '%s'", i, op.Op)
+		}
+
+		ops[i] = op
+	}
+
+	return ops, nil
+}
+
+// ApplyJSONPatch applies RFC 6902 operations in order. The patch is atomic: on
+// error the returned document is nil and doc is left untouched. A failed "test"
+// operation reports "patch test failed".
+func ApplyJSONPatch(doc interface{}, ops []PatchOperation) (interface{}, error) {
+	result := deepCopyJSON(doc)
+
+	for i, op := range ops {
+		path, err := parseJSONPointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch op.Op {
+		case "add":
+			result, err = pointerAdd(result, path, deepCopyJSON(op.Value))
+		case "remove":
+			result, _, err = pointerRemove(result, path)
+		case "replace":
+			if _, err = pointerGet(result, path); err == nil {
+				result, err = pointerReplace(result, path, deepCopyJSON(op.Value))
+			}
+		case "move":
+			var from []string
+			if from, err = parseJSONPointer(op.From); err != nil {
+				break
+			}
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				err = fmt.Errorf("cannot move a value into one of its children")
+				break
+			}
+			var value interface{}
+			if result, value, err = pointerRemove(result, from); err == nil {
+				result, err = pointerAdd(result, path, value)
+			}
+		case "copy":
+			var from []string
+			if from, err = parseJSONPointer(op.From); err != nil {
+				break
+			}
+			var value interface{}
+			if value, err = pointerGet(result, from); err == nil {
+				result, err = pointerAdd(result, path, deepCopyJSON(value))
+			}
+		case "test":
+			var value interface{}
+			if value, err = pointerGet(result, path); err == nil && !reflect.DeepEqual(value, op.Value) {
+				return nil, fmt.Errorf("patch test failed")
+			}
+		default:
+			err = fmt.Errorf("unknown op '%s'", op.Op)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return result, nil
+}
+
+// parseJSONPointer splits an RFC 6901 pointer into unescaped reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer '%s'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array reference token. "-" designates the position after
+// the last element and is only accepted when allowEnd is set.
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if index > max {
+		return 0, fmt.Errorf("array index %d out of bounds", index)
+	}
+	return index, nil
+}
+
+func pointerGet(node interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			value, exists := n[token]
+			if !exists {
+				return nil, fmt.Errorf("path not found")
+			}
+			node = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[index]
+		default:
+			return nil, fmt.Errorf("path not found")
+		}
+	}
+	return node, nil
+}
+
+func pointerAdd(node interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	token, rest := tokens[0], tokens[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			n[token] = value
+			return n, nil
+		}
+		child, exists := n[token]
+		if !exists {
+			return nil, fmt.Errorf("path not found")
+		}
+		updated, err := pointerAdd(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = updated
+		return n, nil
+	case []interface{}:
+		if len(rest) == 0 {
+			index, err := arrayIndex(token, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+			return n, nil
+		}
+		index, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerAdd(n[index], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		n[index] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("path not found")
+	}
+}
+
+func pointerRemove(node interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	token, rest := tokens[0], tokens[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, exists := n[token]
+		if !exists {
+			return nil, nil, fmt.Errorf("path not found")
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+		updated, removed, err := pointerRemove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = updated
+		return n, removed, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[index]
+			return append(n[:index], n[index+1:]...), removed, nil
+		}
+		updated, removed, err := pointerRemove(n[index], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[index] = updated
+		return n, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("path not found")
+	}
+}
+
+// pointerReplace sets an existing location without shifting array elements
+func pointerReplace(node interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parent, err := pointerGet(node, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(p), false)
+		if err != nil {
+			return nil, err
+		}
+		p[index] = value
+	default:
+		return nil, fmt.Errorf("path not found")
+	}
+	return node, nil
+}
+
+func deepCopyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopyJSON(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopyJSON(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
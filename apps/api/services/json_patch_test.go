@@ -0,0 +1,144 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("invalid test JSON %s: %v", data, err)
+	}
+	return v
+}
+
+// Examples from RFC 7396 Appendix A
+func TestApplyMergePatch(t *testing.T) {
+	cases := []struct{ target, patch, expected string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range cases {
+		target := decodeJSON(t, tc.target)
+		got := ApplyMergePatch(target, decodeJSON(t, tc.patch))
+		if expected := decodeJSON(t, tc.expected); !reflect.DeepEqual(got, expected) {
+			t.Errorf("merge %s with %s: expected %s, got %v", tc.target, tc.patch, tc.expected, got)
+		}
+		if !reflect.DeepEqual(target, decodeJSON(t, tc.target)) {
+			t.Errorf("merge %s with %s modified the target", tc.target, tc.patch)
+		}
+	}
+}
+
+// Examples from RFC 6902 Appendix A
+func TestApplyJSONPatch(t *testing.T) {
+	cases := []struct{ doc, patch, expected string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"foo":null}`, `[{"op":"test","path":"/foo","value":null}]`, `{"foo":null}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{`{"foo":"bar"}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"foo":"bar","baz":"bar"}`},
+	}
+
+	for _, tc := range cases {
+		ops, err := ParseJSONPatch([]byte(tc.patch))
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", tc.patch, err)
+		}
+		got, err := ApplyJSONPatch(decodeJSON(t, tc.doc), ops)
+		if err != nil {
+			t.Errorf("patch %s on %s: unexpected error %v", tc.patch, tc.doc, err)
+			continue
+		}
+		if expected := decodeJSON(t, tc.expected); !reflect.DeepEqual(got, expected) {
+			t.Errorf("patch %s on %s: expected %s, got %v", tc.patch, tc.doc, tc.expected, got)
+		}
+	}
+}
+
+func TestApplyJSONPatch_Errors(t *testing.T) {
+	cases := []struct{ doc, patch string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/missing"}]`},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/missing","value":1}]`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/5","value":1}]`},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`},
+		{`{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"foo","value":1}]`},
+	}
+
+	for _, tc := range cases {
+		ops, err := ParseJSONPatch([]byte(tc.patch))
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", tc.patch, err)
+		}
+		doc := decodeJSON(t, tc.doc)
+		if _, err := ApplyJSONPatch(doc, ops); err == nil {
+			t.Errorf("patch %s on %s: expected an error", tc.patch, tc.doc)
+		}
+		if !reflect.DeepEqual(doc, decodeJSON(t, tc.doc)) {
+			t.Errorf("patch %s modified the document", tc.patch)
+		}
+	}
+}
+
+func TestApplyJSONPatch_Atomic(t *testing.T) {
+	doc := decodeJSON(t, `{"name":"Brie","type":"Soft"}`)
+	ops, _ := ParseJSONPatch([]byte(`[{"op":"replace","path":"/type","value":"Hard"},{"op":"test","path":"/name","value":"Comté"}]`))
+
+	result, err := ApplyJSONPatch(doc, ops)
+	if err == nil || err.Error() != "patch test failed" {
+		t.Fatalf("expected failed test, got %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected no result, got %v", result)
+	}
+	if doc.(map[string]interface{})["type"] != "Soft" {
+		t.Error("expected document to be left untouched")
+	}
+}
+
+func TestParseJSONPatch_Invalid(t *testing.T) {
+	for _, patch := range []string{
+		`{"op":"add"}`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"move","path":"/a"}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"remove"}]`,
+	} {
+		if _, err := ParseJSONPatch([]byte(patch)); err == nil {
+			t.Errorf("expected %s to be rejected", patch)
+		}
+	}
+
+	// An explicit null is a value
+	ops, err := ParseJSONPatch([]byte(`[{"op":"add","path":"/a","value":null}]`))
+	if err != nil || !ops[0].HasValue {
+		t.Errorf("expected explicit null to be accepted, got %v", err)
+	}
+}
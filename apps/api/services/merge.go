@@ -0,0 +1,276 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+type MergeResult struct {
+	Item            *models.Item
+	MergedIDs       []uint
+	RatingsMoved    int
+	RatingsCombined int
+}
+
+// MergedFieldValues computes the field values the canonical item will have once
+// it absorbs the duplicates: its own values, then the ones it lacks taken from the
+// duplicates in the given order, then the overrides, where null clears a field.
+func (qb *EAVQueryBuilder) MergedFieldValues(schemaName string, canonicalID uint, duplicateIDs []uint, overrides map[string]interface{}) (map[string]interface{}, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	canonical, duplicates, err := loadMergeItems(utils.DB, cached, canonicalID, duplicateIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := loadFieldValuesMap(utils.DB, canonical.ID, cached.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, duplicate := range duplicates {
+		values, err := loadFieldValuesMap(utils.DB, duplicate.ID, cached.Fields)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			if _, exists := state[key]; !exists {
+				state[key] = value
+			}
+		}
+	}
+
+	for key, value := range overrides {
+		if _, found := qb.registry.GetFieldByKey(schemaName, key); !found {
+			return nil, fmt.Errorf("unknown field '%s'", key)
+		}
+		if value == nil {
+			delete(state, key)
+		} else {
+			state[key] = value
+		}
+	}
+
+	return state, nil
+}
+
+// MergeItems folds duplicates into the canonical item in one transaction. The
+// canonical item takes the given field values, the duplicates' ratings and, if it
+// has none, the first duplicate image. When a user rated both, the most recently
+// updated rating is kept and the shares of both are combined. Duplicates go to the
+// trash and their IDs redirect to the canonical item.
+func (qb *EAVQueryBuilder) MergeItems(schemaName string, canonicalID uint, duplicateIDs []uint, state map[string]interface{}, userID uint, expectedVersion *uint) (*MergeResult, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *MergeResult
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		canonical, duplicates, err := loadMergeItems(tx, cached, canonicalID, duplicateIDs)
+		if err != nil {
+			return err
+		}
+
+		result = &MergeResult{MergedIDs: make([]uint, len(duplicates))}
+		for i, duplicate := range duplicates {
+			result.MergedIDs[i] = duplicate.ID
+		}
+
+		if err := mergeRatings(tx, canonical.ID, result); err != nil {
+			return err
+		}
+
+		if canonical.ImageURL == nil || *canonical.ImageURL == "" {
+			for _, duplicate := range duplicates {
+				if duplicate.ImageURL == nil || *duplicate.ImageURL == "" {
+					continue
+				}
+				// The duplicate lets go of the image so purging it later keeps the file
+				if err := tx.Model(&models.Item{}).Where("id = ?", canonical.ID).Update("image_url", *duplicate.ImageURL).Error; err != nil {
+					return fmt.Errorf("failed to move image: %w", err)
+				}
+				if err := tx.Model(&models.Item{}).Where("id = ?", duplicate.ID).Update("image_url", nil).Error; err != nil {
+					return fmt.Errorf("failed to move image: %w", err)
+				}
+				break
+			}
+		}
+
+		if err := tx.Model(&models.ItemRedirect{}).Where("to_item_id IN ?", result.MergedIDs).Update("to_item_id", canonical.ID).Error; err != nil {
+			return fmt.Errorf("failed to update redirects: %w", err)
+		}
+		for _, duplicate := range duplicates {
+			if err := tx.Unscoped().Where("from_item_id = ?", duplicate.ID).Delete(&models.ItemRedirect{}).Error; err != nil {
+				return fmt.Errorf("failed to update redirects: %w", err)
+			}
+			redirect := models.ItemRedirect{
+				SchemaID:   cached.Schema.ID,
+				FromItemID: duplicate.ID,
+				ToItemID:   canonical.ID,
+				UserID:     int(userID),
+			}
+			if err := tx.Create(&redirect).Error; err != nil {
+				return fmt.Errorf("failed to create redirect: %w", err)
+			}
+
+			if err := qb.deleteItem(tx, cached, duplicate.ID, userID, true); err != nil {
+				return err
+			}
+		}
+
+		// Duplicates are out of the way, so their unique values can now be taken
+		current, err := loadFieldValuesMap(tx, canonical.ID, cached.Fields)
+		if err != nil {
+			return err
+		}
+		result.Item, err = qb.updateItem(tx, cached, canonical.ID, userID, ReplacementUpdates(current, state), UpdateOptions{
+			Action:          models.RevisionActionMerge,
+			IsAdmin:         true,
+			ExpectedVersion: expectedVersion,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ResolveRedirect returns the item a merged item ID now points to
+func (qb *EAVQueryBuilder) ResolveRedirect(schemaName string, itemID uint) (uint, bool) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return 0, false
+	}
+
+	var redirect models.ItemRedirect
+	if err := utils.DB.Where("from_item_id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&redirect).Error; err != nil {
+		return 0, false
+	}
+	return redirect.ToItemID, true
+}
+
+func loadMergeItems(tx *gorm.DB, cached *CachedSchema, canonicalID uint, duplicateIDs []uint) (*models.Item, []models.Item, error) {
+	if len(duplicateIDs) == 0 {
+		return nil, nil, fmt.Errorf("at least one duplicate is required")
+	}
+
+	seen := map[uint]bool{canonicalID: true}
+	ids := []uint{canonicalID}
+	for _, id := range duplicateIDs {
+		if seen[id] {
+			return nil, nil, fmt.Errorf("item %d is listed more than once", id)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	var items []models.Item
+	if err := tx.Where("id IN ? AND schema_id = ?", ids, cached.Schema.ID).Find(&items).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load items: %w", err)
+	}
+	byID := make(map[uint]models.Item, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	for _, id := range ids {
+		if _, found := byID[id]; !found {
+			return nil, nil, fmt.Errorf("item %d not found", id)
+		}
+	}
+
+	canonical := byID[canonicalID]
+	duplicates := make([]models.Item, len(duplicateIDs))
+	for i, id := range duplicateIDs {
+		duplicates[i] = byID[id]
+	}
+	return &canonical, duplicates, nil
+}
+
+// mergeRatings moves the duplicates' live ratings onto the canonical item. A user
+// has at most one rating per item (idx_ratings_user_item), so when a user rated
+// both, the older rating is dropped after its shares are copied to the newer.
+func mergeRatings(tx *gorm.DB, canonicalID uint, result *MergeResult) error {
+	var ratings []models.Rating
+	if err := tx.Where("item_id IN ?", append([]uint{canonicalID}, result.MergedIDs...)).
+		Order("id ASC").
+		Find(&ratings).Error; err != nil {
+		return fmt.Errorf("failed to load ratings: %w", err)
+	}
+
+	kept := make(map[int]models.Rating)
+	var moved, dropped []models.Rating
+	for _, rating := range ratings {
+		existing, conflict := kept[rating.UserID]
+		if !conflict {
+			kept[rating.UserID] = rating
+			continue
+		}
+
+		winner, loser := existing, rating
+		if rating.UpdatedAt.After(existing.UpdatedAt) {
+			winner, loser = rating, existing
+		}
+		kept[rating.UserID] = winner
+		dropped = append(dropped, loser)
+	}
+	for _, rating := range kept {
+		if uint(rating.ItemID) != canonicalID {
+			moved = append(moved, rating)
+		}
+	}
+
+	for _, loser := range dropped {
+		winner := kept[loser.UserID]
+		if err := tx.Exec(
+			"INSERT IGNORE INTO rating_viewers (rating_id, user_id) SELECT ?, user_id FROM rating_viewers WHERE rating_id = ? AND user_id != ?",
+			winner.ID, loser.ID, winner.UserID,
+		).Error; err != nil {
+			return fmt.Errorf("failed to combine rating shares: %w", err)
+		}
+		if err := tx.Exec("DELETE FROM rating_viewers WHERE rating_id = ?", loser.ID).Error; err != nil {
+			return fmt.Errorf("failed to drop rating shares: %w", err)
+		}
+		if err := tx.Unscoped().Delete(&models.Rating{}, loser.ID).Error; err != nil {
+			return fmt.Errorf("failed to drop rating: %w", err)
+		}
+	}
+
+	if len(moved) > 0 {
+		userIDs := make([]int, len(moved))
+		ratingIDs := make([]uint, len(moved))
+		for i, rating := range moved {
+			userIDs[i] = rating.UserID
+			ratingIDs[i] = rating.ID
+		}
+
+		// Ratings removed from the canonical item earlier still hold the user's key
+		stale := tx.Unscoped().Model(&models.Rating{}).Select("id").
+			Where("item_id = ? AND user_id IN ? AND deleted_at IS NOT NULL", canonicalID, userIDs)
+		if err := tx.Exec("DELETE FROM rating_viewers WHERE rating_id IN (?)", stale).Error; err != nil {
+			return fmt.Errorf("failed to clear removed ratings: %w", err)
+		}
+		if err := tx.Unscoped().
+			Where("item_id = ? AND user_id IN ? AND deleted_at IS NOT NULL", canonicalID, userIDs).
+			Delete(&models.Rating{}).Error; err != nil {
+			return fmt.Errorf("failed to clear removed ratings: %w", err)
+		}
+
+		if err := tx.Model(&models.Rating{}).Where("id IN ?", ratingIDs).Update("item_id", canonicalID).Error; err != nil {
+			return fmt.Errorf("failed to move ratings: %w", err)
+		}
+	}
+
+	result.RatingsMoved = len(moved)
+	result.RatingsCombined = len(dropped)
+	return nil
+}
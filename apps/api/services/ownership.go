@@ -0,0 +1,489 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+// SystemOwnerGoogleID identifies the account that keeps catalog items whose
+// owner deleted their account. No Google account can sign in as it.
+const SystemOwnerGoogleID = "system:catalog-owner"
+
+type TransferEntry struct {
+	ID                  uint                  `json:"id"`
+	ItemID              uint                  `json:"item_id"`
+	ItemName            string                `json:"item_name"`
+	SchemaType          string                `json:"schema_type"`
+	FromUserID          int                   `json:"from_user_id"`
+	FromUserDisplayName string                `json:"from_user_display_name,omitempty"`
+	ToUserID            int                   `json:"to_user_id"`
+	ToUserDisplayName   string                `json:"to_user_display_name,omitempty"`
+	ActorID             int                   `json:"actor_id"`
+	Status              models.TransferStatus `json:"status"`
+	Message             string                `json:"message,omitempty"`
+	CreatedAt           time.Time             `json:"created_at"`
+	RespondedAt         *time.Time            `json:"responded_at,omitempty"`
+}
+
+// TransferParams selects the transfers of a user. Direction is "incoming" for
+// transfers offered to them, "outgoing" for the ones they offered, and empty for
+// both.
+type TransferParams struct {
+	UserID    uint
+	Direction string
+	Status    models.TransferStatus
+	Page      int
+	PerPage   int
+}
+
+type TransferListResult struct {
+	Transfers  []TransferEntry
+	Total      int64
+	Page       int
+	PerPage    int
+	TotalPages int
+}
+
+// systemOwnerDisplayName is derived from the system account's Google ID so that
+// it reads as a system name rather than one a person would pick
+const systemOwnerDisplayName = "A la carte (" + SystemOwnerGoogleID + ")"
+
+// maxSystemOwnerNames bounds the numbered display names tried when someone
+// already holds the system account's
+const maxSystemOwnerNames = 100
+
+// SystemOwner returns the system account, creating it on first use. It is
+// created at startup, which takes its display name before anyone can pick it;
+// should a user already hold that name, the first free numbered one is used.
+func SystemOwner(tx *gorm.DB) (*models.User, error) {
+	var owner models.User
+	err := tx.Where("google_id = ?", SystemOwnerGoogleID).First(&owner).Error
+	if err == nil {
+		return &owner, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get system owner: %w", err)
+	}
+
+	displayName, err := freeSystemOwnerDisplayName(tx)
+	if err != nil {
+		return nil, err
+	}
+	owner = models.User{
+		GoogleID:         SystemOwnerGoogleID,
+		Email:            "catalog-owner@system.invalid",
+		DisplayName:      displayName,
+		Discoverable:     false,
+		ProfileCompleted: true,
+		LastLoginAt:      time.Now(),
+	}
+	if err := tx.Create(&owner).Error; err != nil {
+		return nil, fmt.Errorf("failed to create system owner: %w", err)
+	}
+	return &owner, nil
+}
+
+// freeSystemOwnerDisplayName returns the system account's display name, or the
+// first numbered variant of it no account holds, deleted ones included
+func freeSystemOwnerDisplayName(tx *gorm.DB) (string, error) {
+	for i := 1; i <= maxSystemOwnerNames; i++ {
+		name := systemOwnerDisplayName
+		if i > 1 {
+			name = fmt.Sprintf("%s %d", systemOwnerDisplayName, i)
+		}
+		var taken int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("display_name = ?", name).Count(&taken).Error; err != nil {
+			return "", fmt.Errorf("failed to check system owner name: %w", err)
+		}
+		if taken == 0 {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no free display name for the system owner")
+}
+
+// RequestTransfer offers an item to another user. Only the owner can offer it,
+// and an item has at most one pending transfer.
+func (qb *EAVQueryBuilder) RequestTransfer(schemaName string, itemID uint, userID uint, toUserID uint, message string) (*TransferEntry, error) {
+	item, err := qb.findEditableItem(utils.DB, schemaName, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if uint(item.UserID) != userID {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	if toUserID == userID {
+		return nil, fmt.Errorf("you already own this item")
+	}
+
+	var recipient models.User
+	if err := utils.DB.Where("id = ? AND google_id != ?", toUserID, SystemOwnerGoogleID).First(&recipient).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var pending int64
+	if err := utils.DB.Model(&models.ItemTransfer{}).
+		Where("item_id = ? AND status = ?", item.ID, models.TransferStatusPending).
+		Count(&pending).Error; err != nil {
+		return nil, fmt.Errorf("failed to check pending transfers: %w", err)
+	}
+	if pending > 0 {
+		return nil, fmt.Errorf("a transfer is already pending for this item")
+	}
+
+	transfer := models.ItemTransfer{
+		ItemID:     item.ID,
+		SchemaID:   item.SchemaID,
+		FromUserID: item.UserID,
+		ToUserID:   int(toUserID),
+		ActorID:    int(userID),
+		Status:     models.TransferStatusPending,
+		Message:    strings.TrimSpace(message),
+	}
+	if err := utils.DB.Create(&transfer).Error; err != nil {
+		return nil, fmt.Errorf("failed to save transfer: %w", err)
+	}
+
+	entries, err := qb.buildTransferEntries([]models.ItemTransfer{transfer})
+	if err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// ListTransfers returns a user's transfers, newest first
+func (qb *EAVQueryBuilder) ListTransfers(params TransferParams) (*TransferListResult, error) {
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	if params.PerPage < 1 {
+		params.PerPage = 20
+	}
+	if params.PerPage > 100 {
+		params.PerPage = 100
+	}
+
+	query := utils.DB.Model(&models.ItemTransfer{})
+	switch params.Direction {
+	case "incoming":
+		query = query.Where("to_user_id = ?", params.UserID)
+	case "outgoing":
+		query = query.Where("from_user_id = ?", params.UserID)
+	case "":
+		query = query.Where("to_user_id = ? OR from_user_id = ?", params.UserID, params.UserID)
+	default:
+		return nil, fmt.Errorf("direction must be incoming or outgoing")
+	}
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count transfers: %w", err)
+	}
+
+	var transfers []models.ItemTransfer
+	if err := query.Order("id DESC").
+		Offset((params.Page - 1) * params.PerPage).
+		Limit(params.PerPage).
+		Find(&transfers).Error; err != nil {
+		return nil, fmt.Errorf("failed to list transfers: %w", err)
+	}
+
+	entries, err := qb.buildTransferEntries(transfers)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPages := int(total) / params.PerPage
+	if int(total)%params.PerPage > 0 {
+		totalPages++
+	}
+
+	return &TransferListResult{
+		Transfers:  entries,
+		Total:      total,
+		Page:       params.Page,
+		PerPage:    params.PerPage,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// AcceptTransfer makes the recipient of a pending transfer the item's owner.
+// The transfer lapses if the item changed hands since it was offered.
+func (qb *EAVQueryBuilder) AcceptTransfer(transferID uint, userID uint) (*models.Item, error) {
+	var item *models.Item
+	var stale bool
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		transfer, err := pendingTransfer(tx, transferID)
+		if err != nil {
+			return err
+		}
+		if uint(transfer.ToUserID) != userID {
+			return fmt.Errorf("unauthorized")
+		}
+
+		var current models.Item
+		if err := tx.Where("id = ?", transfer.ItemID).First(&current).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("item not found")
+			}
+			return fmt.Errorf("failed to get item: %w", err)
+		}
+		if current.UserID != transfer.FromUserID {
+			stale = true
+			return closeTransfer(tx, transfer, models.TransferStatusCancelled)
+		}
+
+		if err := setItemOwner(tx, &current, uint(transfer.ToUserID)); err != nil {
+			return err
+		}
+		item = &current
+		return closeTransfer(tx, transfer, models.TransferStatusAccepted)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		return nil, fmt.Errorf("the item changed owner since the transfer was offered")
+	}
+
+	return item, nil
+}
+
+// DeclineTransfer lets the recipient turn a pending transfer down
+func (qb *EAVQueryBuilder) DeclineTransfer(transferID uint, userID uint) error {
+	return utils.DB.Transaction(func(tx *gorm.DB) error {
+		transfer, err := pendingTransfer(tx, transferID)
+		if err != nil {
+			return err
+		}
+		if uint(transfer.ToUserID) != userID {
+			return fmt.Errorf("unauthorized")
+		}
+		return closeTransfer(tx, transfer, models.TransferStatusDeclined)
+	})
+}
+
+// CancelTransfer lets the owner withdraw a pending transfer
+func (qb *EAVQueryBuilder) CancelTransfer(transferID uint, userID uint) error {
+	return utils.DB.Transaction(func(tx *gorm.DB) error {
+		transfer, err := pendingTransfer(tx, transferID)
+		if err != nil {
+			return err
+		}
+		if uint(transfer.FromUserID) != userID {
+			return fmt.Errorf("unauthorized")
+		}
+		return closeTransfer(tx, transfer, models.TransferStatusCancelled)
+	})
+}
+
+// ReassignItem gives an item to another user without asking them. Meant for
+// admins; pending transfers of the item are cancelled.
+func (qb *EAVQueryBuilder) ReassignItem(schemaName string, itemID uint, toUserID uint, actorID uint) (*models.Item, error) {
+	var item *models.Item
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		item, err = qb.findEditableItem(tx, schemaName, itemID)
+		if err != nil {
+			return err
+		}
+
+		var recipient models.User
+		if err := tx.Select("id").First(&recipient, toUserID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("user not found")
+			}
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if uint(item.UserID) == toUserID {
+			return nil
+		}
+
+		transfer := models.ItemTransfer{
+			ItemID:     item.ID,
+			SchemaID:   item.SchemaID,
+			FromUserID: item.UserID,
+			ToUserID:   int(toUserID),
+			ActorID:    int(actorID),
+			Status:     models.TransferStatusReassigned,
+		}
+		if err := tx.Create(&transfer).Error; err != nil {
+			return fmt.Errorf("failed to record reassignment: %w", err)
+		}
+
+		return setItemOwner(tx, item, toUserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ReassignUserItems hands every item of a user, trashed ones included, to
+// another user within tx, so deleting the account keeps the catalog. The user's
+// pending transfers are cancelled and their edit grants removed. It returns how
+// many items changed owner.
+func ReassignUserItems(tx *gorm.DB, fromUserID uint, toUserID uint, actorID uint) (int, error) {
+	var items []models.Item
+	if err := tx.Unscoped().Select("id, schema_id").Where("user_id = ?", fromUserID).Find(&items).Error; err != nil {
+		return 0, fmt.Errorf("failed to list items: %w", err)
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.ItemTransfer{}).
+		Where("status = ? AND (from_user_id = ? OR to_user_id = ?)", models.TransferStatusPending, fromUserID, fromUserID).
+		Updates(map[string]interface{}{"status": models.TransferStatusCancelled, "responded_at": now}).Error; err != nil {
+		return 0, fmt.Errorf("failed to cancel transfers: %w", err)
+	}
+	if err := tx.Where("user_id = ?", fromUserID).Delete(&models.ItemEditor{}).Error; err != nil {
+		return 0, fmt.Errorf("failed to remove edit grants: %w", err)
+	}
+
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	transfers := make([]models.ItemTransfer, len(items))
+	for i, item := range items {
+		transfers[i] = models.ItemTransfer{
+			ItemID:      item.ID,
+			SchemaID:    item.SchemaID,
+			FromUserID:  int(fromUserID),
+			ToUserID:    int(toUserID),
+			ActorID:     int(actorID),
+			Status:      models.TransferStatusReassigned,
+			RespondedAt: &now,
+		}
+	}
+	if err := tx.CreateInBatches(&transfers, 100).Error; err != nil {
+		return 0, fmt.Errorf("failed to record reassignments: %w", err)
+	}
+
+	if err := tx.Where("user_id = ? AND item_id IN (?)", toUserID,
+		tx.Unscoped().Model(&models.Item{}).Select("id").Where("user_id = ?", fromUserID),
+	).Delete(&models.ItemEditor{}).Error; err != nil {
+		return 0, fmt.Errorf("failed to remove edit grants: %w", err)
+	}
+	if err := tx.Unscoped().Model(&models.Item{}).
+		Where("user_id = ?", fromUserID).
+		Updates(map[string]interface{}{"user_id": toUserID, "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return 0, fmt.Errorf("failed to reassign items: %w", err)
+	}
+
+	return len(items), nil
+}
+
+// setItemOwner changes an item's owner within tx. The new owner no longer needs
+// an edit grant, and transfers still pending are cancelled.
+func setItemOwner(tx *gorm.DB, item *models.Item, toUserID uint) error {
+	if err := tx.Model(&models.ItemTransfer{}).
+		Where("item_id = ? AND status = ?", item.ID, models.TransferStatusPending).
+		Updates(map[string]interface{}{"status": models.TransferStatusCancelled, "responded_at": time.Now()}).Error; err != nil {
+		return fmt.Errorf("failed to cancel transfers: %w", err)
+	}
+	if err := tx.Where("item_id = ? AND user_id = ?", item.ID, toUserID).Delete(&models.ItemEditor{}).Error; err != nil {
+		return fmt.Errorf("failed to remove edit grant: %w", err)
+	}
+
+	item.UserID = int(toUserID)
+	item.Version++
+	if err := tx.Model(item).Updates(map[string]interface{}{
+		"user_id": item.UserID,
+		"version": item.Version,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to change owner: %w", err)
+	}
+	return nil
+}
+
+func pendingTransfer(tx *gorm.DB, transferID uint) (*models.ItemTransfer, error) {
+	var transfer models.ItemTransfer
+	if err := tx.First(&transfer, transferID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("transfer not found")
+		}
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+	if transfer.Status != models.TransferStatusPending {
+		return nil, fmt.Errorf("transfer is already %s", transfer.Status)
+	}
+	return &transfer, nil
+}
+
+func closeTransfer(tx *gorm.DB, transfer *models.ItemTransfer, status models.TransferStatus) error {
+	now := time.Now()
+	result := tx.Model(transfer).
+		Where("status = ?", models.TransferStatusPending).
+		Updates(map[string]interface{}{"status": status, "responded_at": now})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update transfer: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("transfer is no longer pending")
+	}
+
+	transfer.Status = status
+	transfer.RespondedAt = &now
+	return nil
+}
+
+func (qb *EAVQueryBuilder) buildTransferEntries(transfers []models.ItemTransfer) ([]TransferEntry, error) {
+	entries := make([]TransferEntry, len(transfers))
+	if len(transfers) == 0 {
+		return entries, nil
+	}
+
+	userIDs := make([]int, 0, len(transfers)*2)
+	itemIDs := make([]uint, len(transfers))
+	for i, transfer := range transfers {
+		userIDs = append(userIDs, transfer.FromUserID, transfer.ToUserID)
+		itemIDs[i] = transfer.ItemID
+	}
+	names := displayNamesByUser(userIDs)
+
+	var items []models.Item
+	if err := utils.DB.Unscoped().Select("id, name").Where("id IN ?", itemIDs).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to load items: %w", err)
+	}
+	itemNames := make(map[uint]string, len(items))
+	for _, item := range items {
+		itemNames[item.ID] = item.Name
+	}
+
+	schemaNames := make(map[uint]string)
+	for _, cached := range qb.registry.GetAllSchemas() {
+		schemaNames[cached.Schema.ID] = cached.Schema.Name
+	}
+
+	for i, transfer := range transfers {
+		entries[i] = TransferEntry{
+			ID:                  transfer.ID,
+			ItemID:              transfer.ItemID,
+			ItemName:            itemNames[transfer.ItemID],
+			SchemaType:          schemaNames[transfer.SchemaID],
+			FromUserID:          transfer.FromUserID,
+			FromUserDisplayName: names[transfer.FromUserID],
+			ToUserID:            transfer.ToUserID,
+			ToUserDisplayName:   names[transfer.ToUserID],
+			ActorID:             transfer.ActorID,
+			Status:              transfer.Status,
+			Message:             transfer.Message,
+			CreatedAt:           transfer.CreatedAt,
+			RespondedAt:         transfer.RespondedAt,
+		}
+	}
+
+	return entries, nil
+}
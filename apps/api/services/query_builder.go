@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/davidcharbonnier/alacarte-api/models"
 	"github.com/davidcharbonnier/alacarte-api/utils"
@@ -31,6 +32,13 @@ type QueryParams struct {
 	HasImage      *bool
 	Rated         bool
 	RatedByUserID int
+	Facets        []string
+	// ViewerID is the current user, needed by personal sort keys such as my_grade
+	ViewerID uint
+	// UseCursor switches from page/offset paging to keyset paging. An empty
+	// Cursor then requests the first page.
+	UseCursor bool
+	Cursor    string
 }
 
 type ListResult struct {
@@ -39,6 +47,9 @@ type ListResult struct {
 	Page       int
 	PerPage    int
 	TotalPages int
+	Facets     map[string]*Facet
+	NextCursor string
+	HasMore    bool
 }
 
 func (qb *EAVQueryBuilder) getCachedSchema(schemaName string) (*CachedSchema, error) {
@@ -73,101 +84,48 @@ func (qb *EAVQueryBuilder) BuildListQuery(params QueryParams) (*ListResult, erro
 
 	var total int64
 	var items []models.Item
+	var nextCursor string
 
 	err = utils.DB.Transaction(func(tx *gorm.DB) error {
-		query := tx.Model(&models.Item{}).Where("schema_id = ?", cached.Schema.ID)
+		query := qb.applyListFilters(tx, tx.Model(&models.Item{}).Where("items.schema_id = ?", cached.Schema.ID), cached, params, "")
 
-		if params.HasImage != nil {
-			if *params.HasImage {
-				query = query.Where("image_url IS NOT NULL AND image_url != ''")
-			} else {
-				query = query.Where("image_url IS NULL OR image_url = ''")
-			}
-		}
-
-		if params.Search != "" {
-			searchTerm := strings.ToLower(params.Search)
-			eavSubquery := tx.Model(&models.ItemFieldValue{}).
-				Select("item_id").
-				Where("field_id IN (?)",
-					tx.Model(&models.ItemTypeField{}).
-						Select("id").
-						Where("schema_id = ? AND display LIKE ?", cached.Schema.ID, "%\"searchable\":true%"))
-			query = query.Where("id IN (?) OR LOWER(field_values) LIKE ?", eavSubquery, "%"+searchTerm+"%")
+		if err := query.Count(&total).Error; err != nil {
+			return err
 		}
 
-		if params.Rated && params.RatedByUserID > 0 {
-			authorSubQuery := tx.Model(&models.Rating{}).
-				Select("item_id").
-				Where("user_id = ?", params.RatedByUserID)
-			viewerSubQuery := tx.Table("rating_viewers").
-				Select("DISTINCT r.item_id").
-				Joins("JOIN ratings r ON r.id = rating_viewers.rating_id").
-				Where("rating_viewers.user_id = ? AND r.deleted_at IS NULL", params.RatedByUserID)
-			query = query.Where("id IN (?) OR id IN (?)", authorSubQuery, viewerSubQuery)
-		}
+		plan := qb.buildSortPlan(cached, params.Sort, params.ViewerID)
+		query = plan.applyOrder(plan.applyJoins(query))
 
-		if params.Filters != nil {
-			for key, value := range params.Filters {
-				field, found := qb.registry.GetFieldByKey(params.SchemaName, key)
-				if !found {
-					continue
+		if !params.UseCursor {
+			offset := (params.Page - 1) * params.PerPage
+			query = query.Offset(offset).Limit(params.PerPage)
+		} else {
+			if params.Cursor != "" {
+				values, err := DecodeCursor(params.Cursor, params.Sort)
+				if err != nil {
+					return err
 				}
-
-				eavQuery := tx.Model(&models.ItemFieldValue{}).
-					Select("item_id").
-					Where("field_id = ?", field.ID)
-
-				switch v := value.(type) {
-				case string:
-					if v != "" {
-						eavQuery = eavQuery.Where("value = ?", v)
-					}
-				case []string:
-					if len(v) > 0 {
-						eavQuery = eavQuery.Where("value IN (?)", v)
-					}
-				default:
-					eavQuery = eavQuery.Where("value = ?", fmt.Sprintf("%v", v))
+				condition, args, err := plan.keysetCondition(values)
+				if err != nil {
+					return err
 				}
-
-				query = query.Where("id IN (?)", eavQuery)
+				query = query.Where(condition, args...)
 			}
+			// Fetch one extra row to know whether another page follows
+			query = query.Limit(params.PerPage + 1)
 		}
 
-		if err := query.Count(&total).Error; err != nil {
+		if err := query.Preload("FieldValuesRows").Find(&items).Error; err != nil {
 			return err
 		}
 
-		sortField := "name"
-		sortDir := "ASC"
-		if params.Sort != "" {
-			if strings.HasPrefix(params.Sort, "-") {
-				sortDir = "DESC"
-				sortField = strings.TrimPrefix(params.Sort, "-")
-			} else {
-				sortField = params.Sort
-			}
-		}
-
-		switch sortField {
-		case "created_at", "updated_at", "name":
-			query = query.Order(fmt.Sprintf("%s %s", sortField, sortDir))
-		default:
-			if field, found := qb.registry.GetFieldByKey(params.SchemaName, sortField); found {
-				query = query.
-					Joins("LEFT JOIN item_field_values ON items.id = item_field_values.item_id AND item_field_values.field_id = ?", field.ID).
-					Order(fmt.Sprintf("item_field_values.value %s", sortDir))
-			} else {
-				query = query.Order("name ASC")
+		if params.UseCursor && len(items) > params.PerPage {
+			items = items[:params.PerPage]
+			values, err := plan.cursorValues(tx, items[len(items)-1].ID)
+			if err != nil {
+				return err
 			}
-		}
-
-		offset := (params.Page - 1) * params.PerPage
-		query = query.Offset(offset).Limit(params.PerPage)
-
-		if err := query.Preload("FieldValuesRows").Find(&items).Error; err != nil {
-			return err
+			nextCursor = EncodeCursor(params.Sort, values)
 		}
 
 		return nil
@@ -187,13 +145,92 @@ func (qb *EAVQueryBuilder) BuildListQuery(params QueryParams) (*ListResult, erro
 		totalPages++
 	}
 
-	return &ListResult{
+	result := &ListResult{
 		Items:      resultItems,
 		Total:      total,
 		Page:       params.Page,
 		PerPage:    params.PerPage,
 		TotalPages: totalPages,
-	}, nil
+		NextCursor: nextCursor,
+		HasMore:    nextCursor != "",
+	}
+
+	if len(params.Facets) > 0 {
+		facets, err := qb.ComputeFacets(params, params.Facets)
+		if err != nil {
+			return nil, err
+		}
+		result.Facets = facets
+	}
+
+	return result, nil
+}
+
+// applyListFilters narrows an items query to the image, search, rated and field
+// filters of params. The field filter on skipKey is left out, which lets facets
+// count the values a user could still switch to.
+func (qb *EAVQueryBuilder) applyListFilters(tx *gorm.DB, query *gorm.DB, cached *CachedSchema, params QueryParams, skipKey string) *gorm.DB {
+	if params.HasImage != nil {
+		if *params.HasImage {
+			query = query.Where("items.image_url IS NOT NULL AND items.image_url != ''")
+		} else {
+			query = query.Where("items.image_url IS NULL OR items.image_url = ''")
+		}
+	}
+
+	if params.Search != "" {
+		searchTerm := strings.ToLower(params.Search)
+		eavSubquery := tx.Model(&models.ItemFieldValue{}).
+			Select("item_id").
+			Where("field_id IN (?)",
+				tx.Model(&models.ItemTypeField{}).
+					Select("id").
+					Where("schema_id = ? AND display LIKE ?", cached.Schema.ID, "%\"searchable\":true%")).
+			Where("LOWER(value) LIKE ?", "%"+searchTerm+"%")
+		query = query.Where("items.id IN (?) OR LOWER(items.field_values) LIKE ?", eavSubquery, "%"+searchTerm+"%")
+	}
+
+	if params.Rated && params.RatedByUserID > 0 {
+		authorSubQuery := tx.Model(&models.Rating{}).
+			Select("item_id").
+			Where("user_id = ?", params.RatedByUserID)
+		viewerSubQuery := tx.Table("rating_viewers").
+			Select("DISTINCT r.item_id").
+			Joins("JOIN ratings r ON r.id = rating_viewers.rating_id").
+			Where("rating_viewers.user_id = ? AND r.deleted_at IS NULL", params.RatedByUserID)
+		query = query.Where("items.id IN (?) OR items.id IN (?)", authorSubQuery, viewerSubQuery)
+	}
+
+	for key, value := range params.Filters {
+		if key == skipKey {
+			continue
+		}
+		field, found := qb.registry.GetFieldByKey(cached.Schema.Name, key)
+		if !found {
+			continue
+		}
+
+		eavQuery := tx.Model(&models.ItemFieldValue{}).
+			Select("item_id").
+			Where("field_id = ?", field.ID)
+
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				eavQuery = eavQuery.Where("value = ?", v)
+			}
+		case []string:
+			if len(v) > 0 {
+				eavQuery = eavQuery.Where("value IN (?)", v)
+			}
+		default:
+			eavQuery = eavQuery.Where("value = ?", fmt.Sprintf("%v", v))
+		}
+
+		query = query.Where("items.id IN (?)", eavQuery)
+	}
+
+	return query
 }
 
 func (qb *EAVQueryBuilder) GetItem(schemaName string, itemID uint) (*map[string]interface{}, error) {
@@ -217,6 +254,44 @@ func (qb *EAVQueryBuilder) GetItem(schemaName string, itemID uint) (*map[string]
 	return &result, nil
 }
 
+// GetItemFieldValues returns an item's current field values, read from its EAV
+// rows, along with the item version they belong to
+func (qb *EAVQueryBuilder) GetItemFieldValues(schemaName string, itemID uint) (map[string]interface{}, uint, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var item models.Item
+	if err := utils.DB.
+		Preload("FieldValuesRows").
+		Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).
+		First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, 0, fmt.Errorf("item not found")
+		}
+		return nil, 0, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	return buildFieldValuesMap(item.FieldValuesRows, cached.Fields), item.Version, nil
+}
+
+// ReplacementUpdates turns a full target state into the updates UpdateItem needs
+// to reach it: every target value, plus nil for each current field the target
+// leaves out
+func ReplacementUpdates(current, target map[string]interface{}) map[string]interface{} {
+	updates := make(map[string]interface{}, len(target))
+	for key, value := range target {
+		updates[key] = value
+	}
+	for key := range current {
+		if _, exists := target[key]; !exists {
+			updates[key] = nil
+		}
+	}
+	return updates
+}
+
 func (qb *EAVQueryBuilder) buildItemMap(item *models.Item, cached *CachedSchema) map[string]interface{} {
 	result := map[string]interface{}{
 		"id":          item.ID,
@@ -226,6 +301,7 @@ func (qb *EAVQueryBuilder) buildItemMap(item *models.Item, cached *CachedSchema)
 		"user_id":     item.UserID,
 		"created_at":  item.CreatedAt,
 		"updated_at":  item.UpdatedAt,
+		"version":     item.Version,
 	}
 
 	if item.FieldValues != "" {
@@ -259,7 +335,7 @@ func (qb *EAVQueryBuilder) buildItemMap(item *models.Item, cached *CachedSchema)
 	return result
 }
 
-func (qb *EAVQueryBuilder) checkUniqueness(cached *CachedSchema, fields map[string]interface{}, excludeItemID *uint) (bool, error) {
+func (qb *EAVQueryBuilder) checkUniqueness(tx *gorm.DB, cached *CachedSchema, fields map[string]interface{}, excludeItemID *uint) (bool, error) {
 	if len(cached.UniqueFields) == 0 {
 		return true, nil
 	}
@@ -279,7 +355,7 @@ func (qb *EAVQueryBuilder) checkUniqueness(cached *CachedSchema, fields map[stri
 		return true, nil
 	}
 
-	query := utils.DB.Model(&models.Item{}).Where("schema_id = ?", cached.Schema.ID)
+	query := tx.Model(&models.Item{}).Where("schema_id = ?", cached.Schema.ID)
 
 	if excludeItemID != nil {
 		query = query.Where("id != ?", *excludeItemID)
@@ -294,7 +370,7 @@ func (qb *EAVQueryBuilder) checkUniqueness(cached *CachedSchema, fields map[stri
 				continue
 			}
 
-			subquery := utils.DB.Model(&models.ItemFieldValue{}).
+			subquery := tx.Model(&models.ItemFieldValue{}).
 				Select("item_id").
 				Where("field_id = ? AND value = ?", field.ID, value)
 
@@ -316,7 +392,26 @@ func (qb *EAVQueryBuilder) CreateItem(schemaName string, userID uint, fields map
 		return nil, err
 	}
 
-	unique, err := qb.checkUniqueness(cached, fields, nil)
+	tx := utils.DB.Begin()
+
+	item, err := qb.createItem(tx, cached, userID, fields)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return item, nil
+}
+
+// createItem creates an item within tx. Committing or rolling back is left to
+// the caller.
+func (qb *EAVQueryBuilder) createItem(tx *gorm.DB, cached *CachedSchema, userID uint, fields map[string]interface{}) (*models.Item, error) {
+	unique, err := qb.checkUniqueness(tx, cached, fields, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -327,6 +422,7 @@ func (qb *EAVQueryBuilder) CreateItem(schemaName string, userID uint, fields map
 	item := &models.Item{
 		SchemaID: cached.Schema.ID,
 		UserID:   int(userID),
+		Version:  1,
 	}
 
 	if name, ok := fields["name"].(string); ok {
@@ -341,66 +437,98 @@ func (qb *EAVQueryBuilder) CreateItem(schemaName string, userID uint, fields map
 		item.SchemaVersionID = &cached.Version.ID
 	}
 
-	fieldValuesJSON, err := json.Marshal(fields)
+	rows := fieldValueRows(cached.Fields, fields)
+
+	// The JSON copy is built from the EAV rows, as updates do, so it only holds
+	// schema fields with their stored types
+	after := buildFieldValuesMap(rows, cached.Fields)
+	fieldValuesJSON, err := json.Marshal(after)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal field values: %w", err)
 	}
 	item.FieldValues = string(fieldValuesJSON)
 
-	tx := utils.DB.Begin()
-
 	if err := tx.Create(item).Error; err != nil {
-		tx.Rollback()
 		return nil, fmt.Errorf("failed to create item: %w", err)
 	}
 
-	for _, field := range cached.Fields {
-		if value, exists := fields[field.Key]; exists {
-			var valueStr *string
-			if value != nil {
-				str := fmt.Sprintf("%v", value)
-				valueStr = &str
-			}
-
-			fv := models.ItemFieldValue{
-				ItemID:  item.ID,
-				FieldID: field.ID,
-				Value:   valueStr,
-			}
-			if err := tx.Create(&fv).Error; err != nil {
-				tx.Rollback()
-				return nil, fmt.Errorf("failed to create field value: %w", err)
-			}
+	for i := range rows {
+		rows[i].ItemID = item.ID
+		if err := tx.Create(&rows[i]).Error; err != nil {
+			return nil, fmt.Errorf("failed to create field value: %w", err)
 		}
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	if err := recordRevision(tx, cached, item, userID, models.RevisionActionCreate, nil, after); err != nil {
+		return nil, err
 	}
 
 	return item, nil
 }
 
+// UpdateOptions tunes an item update: the action recorded in its revision,
+// whether the caller may edit items they do not own, and the version the caller
+// last saw, if it wants the update to fail on a concurrent change.
+type UpdateOptions struct {
+	Action          models.RevisionAction
+	IsAdmin         bool
+	ExpectedVersion *uint
+}
+
 func (qb *EAVQueryBuilder) UpdateItem(schemaName string, itemID uint, userID uint, fields map[string]interface{}) (*models.Item, error) {
+	return qb.UpdateItemWithOptions(schemaName, itemID, userID, fields, UpdateOptions{})
+}
+
+func (qb *EAVQueryBuilder) UpdateItemWithOptions(schemaName string, itemID uint, userID uint, fields map[string]interface{}, opts UpdateOptions) (*models.Item, error) {
 	cached, err := qb.getCachedSchema(schemaName)
 	if err != nil {
 		return nil, err
 	}
 
+	tx := utils.DB.Begin()
+
+	item, err := qb.updateItem(tx, cached, itemID, userID, fields, opts)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return item, nil
+}
+
+// updateItem updates an item within tx. Committing or rolling back is left to
+// the caller.
+func (qb *EAVQueryBuilder) updateItem(tx *gorm.DB, cached *CachedSchema, itemID uint, userID uint, fields map[string]interface{}, opts UpdateOptions) (*models.Item, error) {
+	if opts.Action == "" {
+		opts.Action = models.RevisionActionUpdate
+	}
+
 	var item models.Item
-	if err := utils.DB.Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&item).Error; err != nil {
+	if err := tx.Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&item).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("item not found")
 		}
 		return nil, fmt.Errorf("failed to get item: %w", err)
 	}
 
-	if userID != uint(item.UserID) {
+	allowed, err := CanEdit(tx, &item, userID, opts.IsAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
 		return nil, fmt.Errorf("unauthorized")
 	}
 
-	unique, err := qb.checkUniqueness(cached, fields, &itemID)
+	if opts.ExpectedVersion != nil && item.Version != *opts.ExpectedVersion {
+		return nil, fmt.Errorf("version conflict")
+	}
+
+	unique, err := qb.checkUniqueness(tx, cached, fields, &itemID)
 	if err != nil {
 		return nil, err
 	}
@@ -416,7 +544,10 @@ func (qb *EAVQueryBuilder) UpdateItem(schemaName string, itemID uint, userID uin
 		item.ImageURL = &imageURL
 	}
 
-	tx := utils.DB.Begin()
+	before, err := loadFieldValuesMap(tx, item.ID, cached.Fields)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, field := range cached.Fields {
 		if value, exists := fields[field.Key]; exists {
@@ -426,8 +557,10 @@ func (qb *EAVQueryBuilder) UpdateItem(schemaName string, itemID uint, userID uin
 				valueStr = &str
 			}
 
+			// Soft-deleted rows still hold the (item_id, field_id) unique key, so a
+			// cleared field is revived rather than inserted again
 			var fv models.ItemFieldValue
-			err := tx.Where("item_id = ? AND field_id = ?", item.ID, field.ID).First(&fv).Error
+			err := tx.Unscoped().Where("item_id = ? AND field_id = ?", item.ID, field.ID).First(&fv).Error
 			if err == gorm.ErrRecordNotFound {
 				if valueStr != nil {
 					fv = models.ItemFieldValue{
@@ -436,20 +569,18 @@ func (qb *EAVQueryBuilder) UpdateItem(schemaName string, itemID uint, userID uin
 						Value:   valueStr,
 					}
 					if err := tx.Create(&fv).Error; err != nil {
-						tx.Rollback()
 						return nil, fmt.Errorf("failed to create field value: %w", err)
 					}
 				}
 			} else {
 				if valueStr != nil {
 					fv.Value = valueStr
-					if err := tx.Save(&fv).Error; err != nil {
-						tx.Rollback()
+					fv.DeletedAt = gorm.DeletedAt{}
+					if err := tx.Unscoped().Save(&fv).Error; err != nil {
 						return nil, fmt.Errorf("failed to update field value: %w", err)
 					}
-				} else {
+				} else if !fv.DeletedAt.Valid {
 					if err := tx.Delete(&fv).Error; err != nil {
-						tx.Rollback()
 						return nil, fmt.Errorf("failed to delete field value: %w", err)
 					}
 				}
@@ -460,23 +591,28 @@ func (qb *EAVQueryBuilder) UpdateItem(schemaName string, itemID uint, userID uin
 	// Rebuild field_values JSON from all EAV rows to ensure completeness after partial updates
 	var allFieldValues []models.ItemFieldValue
 	if err := tx.Where("item_id = ?", item.ID).Find(&allFieldValues).Error; err != nil {
-		tx.Rollback()
 		return nil, fmt.Errorf("failed to read field values: %w", err)
 	}
-	fieldValuesJSON, err := BuildFieldValuesJSON(allFieldValues, cached.Fields)
+	after := buildFieldValuesMap(allFieldValues, cached.Fields)
+	fieldValuesJSON, err := json.Marshal(after)
 	if err != nil {
-		tx.Rollback()
 		return nil, fmt.Errorf("failed to build field values JSON: %w", err)
 	}
-	item.FieldValues = fieldValuesJSON
-	if err := tx.Save(&item).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to update item: %w", err)
+	item.FieldValues = string(fieldValuesJSON)
+
+	// Only write over the version read above, so a concurrent update is detected
+	readVersion := item.Version
+	item.Version++
+	result := tx.Model(&item).Where("version = ?", readVersion).Select("*").Updates(&item)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update item: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("version conflict")
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	if err := recordRevision(tx, cached, &item, userID, opts.Action, before, after); err != nil {
+		return nil, err
 	}
 
 	return &item, nil
@@ -488,33 +624,62 @@ func (qb *EAVQueryBuilder) DeleteItem(schemaName string, itemID uint, userID uin
 		return err
 	}
 
+	tx := utils.DB.Begin()
+
+	if err := qb.deleteItem(tx, cached, itemID, userID, isAdmin); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// deleteItem deletes an item within tx. Committing or rolling back is left to
+// the caller.
+func (qb *EAVQueryBuilder) deleteItem(tx *gorm.DB, cached *CachedSchema, itemID uint, userID uint, isAdmin bool) error {
 	var item models.Item
-	if err := utils.DB.Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&item).Error; err != nil {
+	if err := tx.Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&item).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return fmt.Errorf("item not found")
 		}
 		return fmt.Errorf("failed to get item: %w", err)
 	}
 
-	if !isAdmin && uint(item.UserID) != userID {
+	allowed, err := CanEdit(tx, &item, userID, isAdmin)
+	if err != nil {
+		return err
+	}
+	if !allowed {
 		return fmt.Errorf("unauthorized")
 	}
 
-	tx := utils.DB.Begin()
+	before, err := loadFieldValuesMap(tx, item.ID, cached.Fields)
+	if err != nil {
+		return err
+	}
+	if err := recordRevision(tx, cached, &item, userID, models.RevisionActionDelete, before, nil); err != nil {
+		return err
+	}
 
-	if err := tx.Delete(&models.ItemFieldValue{}, "item_id = ?", itemID).Error; err != nil {
-		tx.Rollback()
+	// Field values and ratings go to the trash with the item under the same
+	// timestamp, which is how a restore tells them from earlier deletions
+	deletedAt := time.Now()
+
+	if err := tx.Model(&models.ItemFieldValue{}).Where("item_id = ?", itemID).Update("deleted_at", deletedAt).Error; err != nil {
 		return fmt.Errorf("failed to delete field values: %w", err)
 	}
 
-	if err := tx.Delete(&item).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to delete item: %w", err)
+	if err := tx.Model(&models.Rating{}).Where("item_id = ?", itemID).Update("deleted_at", deletedAt).Error; err != nil {
+		return fmt.Errorf("failed to delete ratings: %w", err)
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if err := tx.Model(&item).Update("deleted_at", deletedAt).Error; err != nil {
+		return fmt.Errorf("failed to delete item: %w", err)
 	}
 
 	return nil
@@ -602,8 +767,8 @@ func (qb *EAVQueryBuilder) GetDeleteImpact(schemaName string, itemID uint) (map[
 	return map[string]interface{}{
 		"can_delete": true,
 		"warnings": []string{
-			"This will permanently delete all ratings for this item",
-			"Users who rated this item will lose their ratings",
+			"All ratings for this item will be moved to the trash with it",
+			"Users who rated this item will lose their ratings unless it is restored",
 		},
 		"impact": map[string]interface{}{
 			"ratings_count":  len(ratings),
@@ -615,6 +780,15 @@ func (qb *EAVQueryBuilder) GetDeleteImpact(schemaName string, itemID uint) (map[
 }
 
 func BuildFieldValuesJSON(fieldValues []models.ItemFieldValue, fields []*models.ItemTypeField) (string, error) {
+	jsonBytes, err := json.Marshal(buildFieldValuesMap(fieldValues, fields))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// buildFieldValuesMap converts EAV rows to typed values keyed by field key
+func buildFieldValuesMap(fieldValues []models.ItemFieldValue, fields []*models.ItemTypeField) map[string]interface{} {
 	result := make(map[string]interface{})
 
 	fieldMap := make(map[uint]*models.ItemTypeField)
@@ -639,9 +813,5 @@ func BuildFieldValuesJSON(fieldValues []models.ItemFieldValue, fields []*models.
 		}
 	}
 
-	jsonBytes, err := json.Marshal(result)
-	if err != nil {
-		return "", err
-	}
-	return string(jsonBytes), nil
+	return result
 }
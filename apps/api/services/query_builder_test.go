@@ -2,7 +2,9 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -820,3 +822,1352 @@ func TestEAVQueryBuilder_RatedBy(t *testing.T) {
 		t.Errorf("expected 1 item on page 2 with per_page=1, got %d", len(result.Items))
 	}
 }
+
+// The per-type search matches on searchable EAV values, not on having any
+// searchable value at all
+func TestEAVQueryBuilder_SearchEAVValues(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+
+	for _, name := range []string{"Brie de Meaux", "Cheddar", "Comté"} {
+		if _, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{
+			"name": name,
+			"type": "Soft",
+		}); err != nil {
+			t.Fatalf("failed to create cheese: %v", err)
+		}
+	}
+	// Leave only the EAV values to search on
+	utils.DB.Model(&models.Item{}).Where("1 = 1").Update("field_values", "{}")
+
+	result, err := qb.BuildListQuery(QueryParams{SchemaName: "cheese", Search: "brie"})
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if result.Total != 1 {
+		t.Errorf("expected 1 result for 'brie', got %d", result.Total)
+	}
+}
+
+func TestEAVQueryBuilder_SearchAll(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+
+	for _, name := range []string{"Brie de Meaux", "Brie de Melun", "Cheddar"} {
+		if _, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{
+			"name": name,
+			"type": "Soft",
+		}); err != nil {
+			t.Fatalf("failed to create cheese: %v", err)
+		}
+	}
+	if _, err := qb.CreateItem("gin", uint(user.ID), map[string]interface{}{
+		"name":     "Brie Botanical",
+		"producer": "Distillerie",
+		"profile":  "Floral",
+	}); err != nil {
+		t.Fatalf("failed to create gin: %v", err)
+	}
+
+	result, err := qb.SearchAll(SearchParams{Query: "brie", PerPage: 1})
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if result.Total != 3 {
+		t.Errorf("expected 3 total hits, got %d", result.Total)
+	}
+	if len(result.Groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(result.Groups))
+	}
+	for _, group := range result.Groups {
+		if len(group.Items) != 1 {
+			t.Errorf("expected 1 item per group page for %s, got %d", group.Schema.Schema.Name, len(group.Items))
+		}
+		if group.Schema.Schema.Name == "cheese" && group.TotalPages != 2 {
+			t.Errorf("expected 2 pages of cheese hits, got %d", group.TotalPages)
+		}
+	}
+
+	// Inactive schemas are excluded
+	utils.DB.Model(&models.ItemTypeSchema{}).Where("name = ?", "gin").Update("is_active", false)
+	if err := qb.registry.RefreshSchema("gin"); err != nil {
+		t.Fatalf("failed to refresh schema: %v", err)
+	}
+
+	result, err = qb.SearchAll(SearchParams{Query: "brie"})
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(result.Groups) != 1 || result.Groups[0].Schema.Schema.Name != "cheese" {
+		t.Errorf("expected only the cheese group, got %d groups", len(result.Groups))
+	}
+}
+
+func TestEAVQueryBuilder_SuggestFieldValues(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+
+	for i, origin := range []string{"Normandie", "Normandie", "normandie", "Nord", "Savoie"} {
+		if _, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{
+			"name":   fmt.Sprintf("Cheese %d", i),
+			"type":   "Soft",
+			"origin": origin,
+		}); err != nil {
+			t.Fatalf("failed to create item: %v", err)
+		}
+	}
+
+	// Fields must opt in through their display config
+	if _, err := qb.SuggestFieldValues("cheese", "origin", "No", 10); !errors.Is(err, ErrFieldNotSuggestible) {
+		t.Fatalf("expected non-suggestible field to be rejected, got %v", err)
+	}
+
+	utils.DB.Model(&models.ItemTypeField{}).
+		Where("`key` = ? AND schema_id = (SELECT id FROM item_type_schemas WHERE name = ?)", "origin", "cheese").
+		Update("display", `{"suggestible":true}`)
+	if err := qb.registry.RefreshSchema("cheese"); err != nil {
+		t.Fatalf("failed to refresh schema: %v", err)
+	}
+
+	suggestions, err := qb.SuggestFieldValues("cheese", "origin", "no", 10)
+	if err != nil {
+		t.Fatalf("failed to suggest: %v", err)
+	}
+	if len(suggestions) != 2 {
+		t.Fatalf("expected 2 suggestions, got %d: %v", len(suggestions), suggestions)
+	}
+	if suggestions[0].Count != 3 {
+		t.Errorf("expected most used value first with count 3, got %v", suggestions[0])
+	}
+	if suggestions[1].Value != "Nord" {
+		t.Errorf("expected 'Nord' second, got %v", suggestions[1].Value)
+	}
+
+	// Limits above the maximum are clamped to it
+	for i := 0; i < 25; i++ {
+		if _, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{
+			"name":   fmt.Sprintf("Valley Cheese %d", i),
+			"type":   "Soft",
+			"origin": fmt.Sprintf("Vallée %02d", i),
+		}); err != nil {
+			t.Fatalf("failed to create item: %v", err)
+		}
+	}
+	suggestions, err = qb.SuggestFieldValues("cheese", "origin", "val", 25)
+	if err != nil {
+		t.Fatalf("failed to suggest: %v", err)
+	}
+	if len(suggestions) != maxSuggestions {
+		t.Errorf("expected %d suggestions, got %d", maxSuggestions, len(suggestions))
+	}
+}
+
+func TestEAVQueryBuilder_Facets(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+
+	wines := []map[string]interface{}{
+		{"name": "Wine A", "country": "France", "color": "Rouge", "alcohol": 12.5, "organic": true},
+		{"name": "Wine B", "country": "France", "color": "Rouge", "alcohol": 13.0, "organic": false},
+		{"name": "Wine C", "country": "Italy", "color": "Blanc", "alcohol": 11.0, "organic": true},
+		{"name": "Wine D", "country": "Italy", "color": "Rouge", "alcohol": 14.0},
+	}
+	for _, wine := range wines {
+		if _, err := qb.CreateItem("wine", uint(user.ID), wine); err != nil {
+			t.Fatalf("failed to create wine: %v", err)
+		}
+	}
+
+	result, err := qb.BuildListQuery(QueryParams{
+		SchemaName: "wine",
+		Filters:    map[string]interface{}{"color": "Rouge"},
+		Facets:     []string{"color", "organic", "alcohol"},
+	})
+	if err != nil {
+		t.Fatalf("failed to list with facets: %v", err)
+	}
+	if result.Total != 3 {
+		t.Errorf("expected 3 red wines, got %d", result.Total)
+	}
+
+	// The color facet ignores the color filter itself
+	counts := map[string]int64{}
+	for _, v := range result.Facets["color"].Values {
+		counts[v.Value] = v.Count
+	}
+	if counts["Rouge"] != 3 || counts["Blanc"] != 1 {
+		t.Errorf("unexpected color facet counts: %v", counts)
+	}
+	if _, listed := counts["Rosé"]; !listed {
+		t.Error("expected unused enum options to be listed with a zero count")
+	}
+
+	// Other facets reflect the color filter
+	counts = map[string]int64{}
+	for _, v := range result.Facets["organic"].Values {
+		counts[v.Value] = v.Count
+	}
+	if counts["true"] != 1 || counts["false"] != 1 {
+		t.Errorf("unexpected organic facet counts: %v", counts)
+	}
+
+	var bucketed int64
+	for _, b := range result.Facets["alcohol"].Buckets {
+		bucketed += b.Count
+	}
+	if bucketed != 3 {
+		t.Errorf("expected 3 alcohol values across buckets, got %d", bucketed)
+	}
+
+	// Free text fields are not facetable unless they opt in
+	if _, err := qb.BuildListQuery(QueryParams{SchemaName: "wine", Facets: []string{"country"}}); err == nil {
+		t.Error("expected text facet to be rejected")
+	}
+}
+
+func TestEAVQueryBuilder_CursorPagination(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+
+	// Duplicate origins exercise the ID tie-breaker, missing ones the NULL handling
+	for i := 0; i < 12; i++ {
+		fields := map[string]interface{}{
+			"name": fmt.Sprintf("Cheese %02d", i),
+			"type": "Soft",
+		}
+		if i%3 != 0 {
+			fields["origin"] = fmt.Sprintf("Origin %d", i%2)
+		}
+		if _, err := qb.CreateItem("cheese", uint(user.ID), fields); err != nil {
+			t.Fatalf("failed to create item: %v", err)
+		}
+	}
+
+	for _, sort := range []string{"name", "-name", "origin", "-origin", "-created_at"} {
+		seen := map[interface{}]bool{}
+		cursor := ""
+		pages := 0
+
+		for {
+			result, err := qb.BuildListQuery(QueryParams{
+				SchemaName: "cheese",
+				Sort:       sort,
+				PerPage:    5,
+				UseCursor:  true,
+				Cursor:     cursor,
+			})
+			if err != nil {
+				t.Fatalf("sort %s: failed to list page %d: %v", sort, pages+1, err)
+			}
+			pages++
+
+			for _, item := range result.Items {
+				if seen[item["id"]] {
+					t.Errorf("sort %s: item %v returned twice", sort, item["id"])
+				}
+				seen[item["id"]] = true
+			}
+
+			if !result.HasMore {
+				break
+			}
+			if pages > 5 {
+				t.Fatalf("sort %s: cursor pagination did not terminate", sort)
+			}
+			cursor = result.NextCursor
+		}
+
+		if len(seen) != 12 {
+			t.Errorf("sort %s: expected 12 items across pages, got %d", sort, len(seen))
+		}
+		if pages != 3 {
+			t.Errorf("sort %s: expected 3 pages, got %d", sort, pages)
+		}
+	}
+
+	// A cursor issued for one sort is rejected for another
+	result, err := qb.BuildListQuery(QueryParams{SchemaName: "cheese", Sort: "name", PerPage: 5, UseCursor: true})
+	if err != nil {
+		t.Fatalf("failed to list first page: %v", err)
+	}
+	if _, err := qb.BuildListQuery(QueryParams{SchemaName: "cheese", Sort: "-name", PerPage: 5, UseCursor: true, Cursor: result.NextCursor}); err == nil {
+		t.Error("expected cursor with mismatched sort to be rejected")
+	}
+}
+
+func TestEAVQueryBuilder_RatingSortKeys(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+	other := createTestUser(t)
+
+	items := map[string]*models.Item{}
+	for _, name := range []string{"Brie", "Comté", "Morbier", "Reblochon"} {
+		item, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{"name": name, "type": "Soft"})
+		if err != nil {
+			t.Fatalf("failed to create item: %v", err)
+		}
+		items[name] = item
+	}
+
+	// Brie and Comté tie on average, Comté has more ratings, Reblochon is unrated
+	ratings := []models.Rating{
+		{Grade: 4, UserID: int(user.ID), ItemID: int(items["Brie"].ID)},
+		{Grade: 4, UserID: int(user.ID), ItemID: int(items["Comté"].ID)},
+		{Grade: 4, UserID: int(other.ID), ItemID: int(items["Comté"].ID)},
+		{Grade: 2, UserID: int(other.ID), ItemID: int(items["Morbier"].ID)},
+	}
+	for i := range ratings {
+		if err := utils.DB.Create(&ratings[i]).Error; err != nil {
+			t.Fatalf("failed to create rating: %v", err)
+		}
+	}
+
+	names := func(result *ListResult) []string {
+		out := make([]string, len(result.Items))
+		for i, item := range result.Items {
+			out[i] = item["name"].(string)
+		}
+		return out
+	}
+
+	result, err := qb.BuildListQuery(QueryParams{SchemaName: "cheese", Sort: "-avg_rating,-rating_count,name"})
+	if err != nil {
+		t.Fatalf("failed to sort by rating aggregates: %v", err)
+	}
+	if got := strings.Join(names(result), ","); got != "Comté,Brie,Morbier,Reblochon" {
+		t.Errorf("unexpected order by rating aggregates: %s", got)
+	}
+
+	// Personal keys use the viewer's own ratings; unrated items sort last descending
+	result, err = qb.BuildListQuery(QueryParams{SchemaName: "cheese", Sort: "-my_grade,-name", ViewerID: uint(other.ID)})
+	if err != nil {
+		t.Fatalf("failed to sort by my grade: %v", err)
+	}
+	if got := strings.Join(names(result), ","); got != "Comté,Morbier,Reblochon,Brie" {
+		t.Errorf("unexpected order by my grade: %s", got)
+	}
+
+	// Cursor paging walks the same order
+	var paged []string
+	cursor := ""
+	for {
+		result, err := qb.BuildListQuery(QueryParams{
+			SchemaName: "cheese",
+			Sort:       "-avg_rating,-rating_count,name",
+			PerPage:    1,
+			UseCursor:  true,
+			Cursor:     cursor,
+		})
+		if err != nil {
+			t.Fatalf("failed to page by rating aggregates: %v", err)
+		}
+		paged = append(paged, names(result)...)
+		if !result.HasMore || len(paged) > 4 {
+			break
+		}
+		cursor = result.NextCursor
+	}
+	if got := strings.Join(paged, ","); got != "Comté,Brie,Morbier,Reblochon" {
+		t.Errorf("unexpected cursor order by rating aggregates: %s", got)
+	}
+}
+
+func TestEAVQueryBuilder_ShapeItemsIncludes(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+	other := createTestUser(t)
+
+	rated, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{"name": "Brie", "type": "Soft"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	if _, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{"name": "Comté", "type": "Hard"}); err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	ratings := []models.Rating{
+		{Grade: 4, Note: "Creamy", UserID: int(user.ID), ItemID: int(rated.ID)},
+		{Grade: 2, UserID: int(other.ID), ItemID: int(rated.ID)},
+	}
+	for i := range ratings {
+		if err := utils.DB.Create(&ratings[i]).Error; err != nil {
+			t.Fatalf("failed to create rating: %v", err)
+		}
+	}
+
+	result, err := qb.BuildListQuery(QueryParams{SchemaName: "cheese", Sort: "name"})
+	if err != nil {
+		t.Fatalf("failed to list items: %v", err)
+	}
+	err = qb.ShapeItems("cheese", result.Items, ItemResponseOptions{
+		Fields:   []string{"name"},
+		Include:  []string{IncludeCommunityStats, IncludeMyRating},
+		ViewerID: uint(user.ID),
+	})
+	if err != nil {
+		t.Fatalf("failed to shape items: %v", err)
+	}
+
+	brie, comte := result.Items[0], result.Items[1]
+
+	stats := brie[IncludeCommunityStats].(map[string]interface{})
+	if stats["total_ratings"] != 2 || stats["average_rating"] != 3.0 {
+		t.Errorf("unexpected community stats: %v", stats)
+	}
+	mine, ok := brie[IncludeMyRating].(map[string]interface{})
+	if !ok || mine["note"] != "Creamy" {
+		t.Errorf("expected own rating to be embedded, got %v", brie[IncludeMyRating])
+	}
+
+	stats = comte[IncludeCommunityStats].(map[string]interface{})
+	if stats["total_ratings"] != 0 {
+		t.Errorf("expected no ratings for unrated item, got %v", stats)
+	}
+	if comte[IncludeMyRating] != nil {
+		t.Errorf("expected no own rating for unrated item, got %v", comte[IncludeMyRating])
+	}
+}
+
+func TestEAVQueryBuilder_Revisions(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+	other := createTestUser(t)
+
+	item, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{"name": "Tomme", "type": "Soft", "origin": "Savoie"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	if _, err := qb.UpdateItem("cheese", item.ID, uint(user.ID), map[string]interface{}{"type": "Hard", "origin": nil}); err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+
+	// An update that changes nothing is not recorded
+	if _, err := qb.UpdateItem("cheese", item.ID, uint(user.ID), map[string]interface{}{"type": "Hard"}); err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+
+	history, err := qb.GetItemHistory("cheese", item.ID, 1, 20)
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if history.Total != 2 {
+		t.Fatalf("expected 2 revisions, got %d", history.Total)
+	}
+	created := history.Revisions[1]
+	if created.Action != models.RevisionActionCreate || created.Snapshot["origin"] != "Savoie" {
+		t.Errorf("unexpected create revision: %+v", created)
+	}
+
+	// Only the owner or an admin may revert
+	if _, _, err := qb.RevertFields("cheese", item.ID, created.ID, uint(other.ID), false); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+
+	state, updates, err := qb.RevertFields("cheese", item.ID, created.ID, uint(other.ID), true)
+	if err != nil {
+		t.Fatalf("failed to prepare revert: %v", err)
+	}
+	if state["type"] != "Soft" || updates["origin"] != "Savoie" {
+		t.Errorf("unexpected revert fields: %v / %v", state, updates)
+	}
+
+	if _, err := qb.UpdateItemWithOptions("cheese", item.ID, uint(other.ID), updates, UpdateOptions{Action: models.RevisionActionRevert, IsAdmin: true}); err != nil {
+		t.Fatalf("failed to revert: %v", err)
+	}
+
+	reverted, err := qb.GetItem("cheese", item.ID)
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if (*reverted)["type"] != "Soft" || (*reverted)["origin"] != "Savoie" {
+		t.Errorf("expected original values back, got %v", *reverted)
+	}
+
+	if err := qb.DeleteItem("cheese", item.ID, uint(user.ID), false); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+
+	// History remains readable after deletion
+	history, err = qb.GetItemHistory("cheese", item.ID, 1, 20)
+	if err != nil {
+		t.Fatalf("failed to get history after delete: %v", err)
+	}
+	if history.Total != 4 || history.Revisions[0].Action != models.RevisionActionDelete {
+		t.Errorf("expected delete revision on top of 4, got %d: %+v", history.Total, history.Revisions)
+	}
+	if history.Revisions[1].UserID != int(other.ID) {
+		t.Errorf("expected revert to be attributed to the admin, got user %d", history.Revisions[1].UserID)
+	}
+}
+
+func TestEAVQueryBuilder_VersionConflict(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+
+	item, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{"name": "Abondance", "type": "Hard"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	if item.Version != 1 {
+		t.Fatalf("expected new item at version 1, got %d", item.Version)
+	}
+
+	seen := item.Version
+	updated, err := qb.UpdateItemWithOptions("cheese", item.ID, uint(user.ID), map[string]interface{}{"origin": "Savoie"}, UpdateOptions{ExpectedVersion: &seen})
+	if err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("expected version 2 after update, got %d", updated.Version)
+	}
+
+	_, err = qb.UpdateItemWithOptions("cheese", item.ID, uint(user.ID), map[string]interface{}{"origin": "Jura"}, UpdateOptions{ExpectedVersion: &seen})
+	if err == nil || err.Error() != "version conflict" {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+
+	current, _ := qb.GetItem("cheese", item.ID)
+	if (*current)["origin"] != "Savoie" || (*current)["version"] != uint(2) {
+		t.Errorf("expected stale write to be discarded, got %v", *current)
+	}
+}
+
+func TestEAVQueryBuilder_Batch(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+	validator := NewValidationEngine(qb.registry)
+
+	existing, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{"name": "Beaufort", "type": "Hard"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	// The second create duplicates the first within the same batch, so nothing is kept
+	atomicOps := []BatchOperation{
+		{Op: BatchOpUpdate, ID: existing.ID, Fields: map[string]interface{}{"origin": "Savoie"}},
+		{Op: BatchOpCreate, Fields: map[string]interface{}{"name": "Morbier", "type": "Semi-soft"}},
+		{Op: BatchOpCreate, Fields: map[string]interface{}{"name": "Morbier", "type": "Semi-soft"}},
+		{Op: BatchOpDelete, ID: existing.ID},
+	}
+	result, err := qb.ExecuteBatch(validator, "cheese", uint(user.ID), false, atomicOps, BatchModeAtomic)
+	if err != nil {
+		t.Fatalf("atomic batch failed: %v", err)
+	}
+	if result.Committed {
+		t.Fatal("expected atomic batch to be rolled back")
+	}
+	expected := []string{BatchStatusRolledBack, BatchStatusRolledBack, BatchStatusFailed, BatchStatusSkipped}
+	for i, status := range expected {
+		if result.Results[i].Status != status {
+			t.Errorf("atomic operation %d: expected %s, got %s", i, status, result.Results[i].Status)
+		}
+	}
+	if result.Results[2].Error != "duplicate item" {
+		t.Errorf("expected duplicate item error, got %q", result.Results[2].Error)
+	}
+
+	var count int64
+	utils.DB.Model(&models.Item{}).Where("name = ?", "Morbier").Count(&count)
+	if count != 0 {
+		t.Errorf("expected rolled back create to leave no item, found %d", count)
+	}
+	current, _ := qb.GetItem("cheese", existing.ID)
+	if _, set := (*current)["origin"]; set {
+		t.Errorf("expected rolled back update to leave origin unset, got %v", (*current)["origin"])
+	}
+
+	stale := uint(7)
+	result, err = qb.ExecuteBatch(validator, "cheese", uint(user.ID), false, append(atomicOps, BatchOperation{Op: BatchOpUpdate, ID: existing.ID, Version: &stale}), BatchModeBestEffort)
+	if err != nil {
+		t.Fatalf("best effort batch failed: %v", err)
+	}
+	if !result.Committed || result.Succeeded != 3 || result.Failed != 2 {
+		t.Fatalf("expected 3 succeeded and 2 failed, got %+v", result)
+	}
+	if result.Results[1].ID == 0 || result.Results[1].Version != 1 {
+		t.Errorf("expected created item id and version, got %+v", result.Results[1])
+	}
+	if result.Results[0].Version != 2 {
+		t.Errorf("expected updated item at version 2, got %+v", result.Results[0])
+	}
+	if result.Results[4].Error != "item not found" {
+		t.Errorf("expected update after delete to fail, got %+v", result.Results[4])
+	}
+
+	if _, err := qb.GetItem("cheese", existing.ID); err == nil {
+		t.Error("expected item to be deleted")
+	}
+	utils.DB.Model(&models.Item{}).Where("name = ?", "Morbier").Count(&count)
+	if count != 1 {
+		t.Errorf("expected one Morbier after best effort batch, found %d", count)
+	}
+}
+
+func TestEAVQueryBuilder_TrashRestorePurge(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	owner := createTestUser(t)
+	other := createTestUser(t)
+
+	item, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Salers", "type": "Hard"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	// A field cleared before the deletion must stay cleared after a restore
+	if _, err := qb.UpdateItem("cheese", item.ID, uint(owner.ID), map[string]interface{}{"origin": "Auvergne"}); err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+	if _, err := qb.UpdateItem("cheese", item.ID, uint(owner.ID), map[string]interface{}{"origin": nil}); err != nil {
+		t.Fatalf("failed to clear origin: %v", err)
+	}
+
+	rating := models.Rating{Grade: 4, UserID: int(other.ID), ItemID: int(item.ID)}
+	if err := utils.DB.Create(&rating).Error; err != nil {
+		t.Fatalf("failed to create rating: %v", err)
+	}
+
+	if err := qb.DeleteItem("cheese", item.ID, uint(owner.ID), false); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+
+	var count int64
+	utils.DB.Model(&models.Rating{}).Where("item_id = ?", item.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("expected the rating to be trashed with the item, found %d live", count)
+	}
+
+	trash, err := qb.ListTrash(TrashParams{SchemaName: "cheese", OwnerID: uint(owner.ID)})
+	if err != nil {
+		t.Fatalf("failed to list trash: %v", err)
+	}
+	if trash.Total != 1 || trash.Items[0]["id"] != item.ID || trash.Items[0]["deleted_by"] != int(owner.ID) {
+		t.Fatalf("unexpected trash: %+v", trash.Items)
+	}
+	if trash, _ := qb.ListTrash(TrashParams{OwnerID: uint(other.ID)}); trash.Total != 0 {
+		t.Errorf("expected other user's trash to be empty, got %d", trash.Total)
+	}
+
+	if _, err := qb.RestoreItem("cheese", item.ID, uint(other.ID), false); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected unauthorized restore, got %v", err)
+	}
+
+	// A live item took the name in the meantime
+	taken, err := qb.CreateItem("cheese", uint(other.ID), map[string]interface{}{"name": "Salers", "type": "Hard"})
+	if err != nil {
+		t.Fatalf("expected the trashed name to be free, got %v", err)
+	}
+	if _, err := qb.RestoreItem("cheese", item.ID, uint(owner.ID), false); err == nil || err.Error() != "duplicate item" {
+		t.Fatalf("expected duplicate item on restore, got %v", err)
+	}
+	if err := qb.DeleteItem("cheese", taken.ID, uint(other.ID), false); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+
+	restored, err := qb.RestoreItem("cheese", item.ID, uint(owner.ID), false)
+	if err != nil {
+		t.Fatalf("failed to restore item: %v", err)
+	}
+	if restored.Version != 4 {
+		t.Errorf("expected restore to bump the version to 4, got %d", restored.Version)
+	}
+
+	current, err := qb.GetItem("cheese", item.ID)
+	if err != nil {
+		t.Fatalf("expected restored item to be readable: %v", err)
+	}
+	if (*current)["type"] != "Hard" {
+		t.Errorf("expected field values to be restored, got %v", *current)
+	}
+	if _, set := (*current)["origin"]; set {
+		t.Errorf("expected previously cleared origin to stay cleared, got %v", (*current)["origin"])
+	}
+	utils.DB.Model(&models.Rating{}).Where("item_id = ?", item.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("expected the rating to be restored, found %d", count)
+	}
+
+	if _, err := qb.PurgeItem("cheese", item.ID); err == nil || err.Error() != "item not found in trash" {
+		t.Errorf("expected live item not to be purgeable, got %v", err)
+	}
+
+	// The other user's item has been trashed for a while
+	utils.DB.Unscoped().Model(&models.Item{}).Where("id = ?", taken.ID).Update("deleted_at", time.Now().AddDate(0, 0, -40))
+	if err := qb.DeleteItem("cheese", item.ID, uint(owner.ID), false); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+
+	purged, err := PurgeTrashedItems(time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatalf("failed to purge trash: %v", err)
+	}
+	if purged.Purged != 1 {
+		t.Errorf("expected only the expired item to be purged, got %d", purged.Purged)
+	}
+	utils.DB.Unscoped().Model(&models.Item{}).Where("id = ?", taken.ID).Count(&count)
+	if count != 0 {
+		t.Error("expected expired item to be gone")
+	}
+
+	if _, err := qb.PurgeItem("cheese", item.ID); err != nil {
+		t.Fatalf("failed to purge item: %v", err)
+	}
+	utils.DB.Unscoped().Model(&models.Rating{}).Where("item_id = ?", item.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("expected purged item's ratings to be gone, found %d", count)
+	}
+	utils.DB.Model(&models.ItemRevision{}).Where("item_id = ?", item.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("expected purged item's history to be gone, found %d", count)
+	}
+}
+
+func TestEAVQueryBuilder_DuplicatesAndMerge(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	owner := createTestUser(t)
+	alice := createTestUser(t)
+	bob := createTestUser(t)
+
+	canonical, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Roquefort", "type": "Blue"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	image := "https://storage.example.com/bucket/roquefort.jpg"
+	duplicate, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Rocquefort", "type": "Blue", "origin": "Aveyron", "image_url": image})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	if _, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Morbier", "type": "Semi-soft"}); err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	clusters, err := qb.FindDuplicates("cheese", DefaultDuplicateThreshold)
+	if err != nil {
+		t.Fatalf("failed to find duplicates: %v", err)
+	}
+	if len(clusters) != 1 || len(clusters[0].Items) != 2 || clusters[0].Items[0].ID != canonical.ID {
+		t.Fatalf("expected the two roquefort items in one cluster, got %+v", clusters)
+	}
+
+	// Alice rated both, most recently the duplicate; Bob only the duplicate
+	older := models.Rating{Grade: 2, UserID: int(alice.ID), ItemID: int(canonical.ID)}
+	utils.DB.Create(&older)
+	utils.DB.Model(&older).Update("updated_at", time.Now().Add(-time.Hour))
+	newer := models.Rating{Grade: 4, UserID: int(alice.ID), ItemID: int(duplicate.ID)}
+	utils.DB.Create(&newer)
+	utils.DB.Exec("INSERT INTO rating_viewers (rating_id, user_id) VALUES (?, ?)", older.ID, bob.ID)
+	bobs := models.Rating{Grade: 5, UserID: int(bob.ID), ItemID: int(duplicate.ID)}
+	utils.DB.Create(&bobs)
+
+	state, err := qb.MergedFieldValues("cheese", canonical.ID, []uint{duplicate.ID}, nil)
+	if err != nil {
+		t.Fatalf("failed to compute merged values: %v", err)
+	}
+	if state["name"] != "Roquefort" || state["origin"] != "Aveyron" {
+		t.Errorf("expected canonical name and the duplicate's origin, got %v", state)
+	}
+
+	result, err := qb.MergeItems("cheese", canonical.ID, []uint{duplicate.ID}, state, uint(owner.ID), nil)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if result.RatingsMoved != 2 || result.RatingsCombined != 1 {
+		t.Errorf("expected 2 moved and 1 combined rating, got %+v", result)
+	}
+
+	var ratings []models.Rating
+	utils.DB.Where("item_id = ?", canonical.ID).Order("user_id").Find(&ratings)
+	if len(ratings) != 2 {
+		t.Fatalf("expected 2 ratings on the canonical item, got %d", len(ratings))
+	}
+	if ratings[0].ID != newer.ID {
+		t.Errorf("expected alice's newer rating to be kept, got %+v", ratings[0])
+	}
+	var shares int64
+	utils.DB.Table("rating_viewers").Where("rating_id = ? AND user_id = ?", newer.ID, bob.ID).Count(&shares)
+	if shares != 1 {
+		t.Error("expected the dropped rating's share to carry over")
+	}
+
+	merged, _ := qb.GetItem("cheese", canonical.ID)
+	if (*merged)["origin"] != "Aveyron" || (*merged)["image_url"] == nil || *(*merged)["image_url"].(*string) != image {
+		t.Errorf("expected merged origin and image, got %v", *merged)
+	}
+
+	if target, ok := qb.ResolveRedirect("cheese", duplicate.ID); !ok || target != canonical.ID {
+		t.Errorf("expected duplicate to redirect to %d, got %d", canonical.ID, target)
+	}
+	if _, err := qb.GetItem("cheese", duplicate.ID); err == nil {
+		t.Error("expected duplicate to be trashed")
+	}
+
+	// Restoring the duplicate drops its redirect
+	if _, err := qb.UpdateItem("cheese", canonical.ID, uint(owner.ID), map[string]interface{}{"name": "Roquefort AOP"}); err != nil {
+		t.Fatalf("failed to rename: %v", err)
+	}
+	if _, err := qb.RestoreItem("cheese", duplicate.ID, uint(owner.ID), true); err != nil {
+		t.Fatalf("failed to restore duplicate: %v", err)
+	}
+	if _, ok := qb.ResolveRedirect("cheese", duplicate.ID); ok {
+		t.Error("expected restored item not to redirect")
+	}
+}
+
+func TestEAVQueryBuilder_Suggestions(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	owner := createTestUser(t)
+	submitter := createTestUser(t)
+	outsider := createTestUser(t)
+
+	item, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Comte", "type": "Hard", "origin": "Jura"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	if _, err := qb.SubmitSuggestion("cheese", item.ID, uint(owner.ID), map[string]interface{}{"name": "Comté"}, ""); err == nil {
+		t.Error("expected owners to be refused suggestions on their own items")
+	}
+	if _, err := qb.SubmitSuggestion("cheese", item.ID, uint(submitter.ID), map[string]interface{}{"origin": "Jura"}, ""); err == nil || err.Error() != "suggestion changes nothing" {
+		t.Errorf("expected a no-op suggestion to be refused, got %v", err)
+	}
+
+	accepted, err := qb.SubmitSuggestion("cheese", item.ID, uint(submitter.ID), map[string]interface{}{"name": "Comté", "origin": "Jura"}, "Accent")
+	if err != nil {
+		t.Fatalf("failed to submit suggestion: %v", err)
+	}
+	if len(accepted.Changes) != 1 || accepted.Changes["name"].From != "Comte" {
+		t.Errorf("expected only the name change against the current value, got %+v", accepted.Changes)
+	}
+	rejected, err := qb.SubmitSuggestion("cheese", item.ID, uint(submitter.ID), map[string]interface{}{"origin": "Doubs"}, "")
+	if err != nil {
+		t.Fatalf("failed to submit suggestion: %v", err)
+	}
+
+	queue, err := qb.ListSuggestions(SuggestionParams{SchemaName: "cheese", OwnerID: uint(owner.ID), Status: models.SuggestionStatusPending})
+	if err != nil || queue.Total != 2 {
+		t.Fatalf("expected two pending suggestions in the owner's queue, got %v, %v", queue, err)
+	}
+
+	if _, err := qb.GetSuggestion("cheese", accepted.ID, uint(outsider.ID), false); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected outsiders not to see suggestions, got %v", err)
+	}
+	validator := NewValidationEngine(qb.registry)
+	if _, _, err := qb.AcceptSuggestion(validator, "cheese", accepted.ID, uint(submitter.ID), false); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected submitters not to accept their own suggestions, got %v", err)
+	}
+
+	updated, validation, err := qb.AcceptSuggestion(validator, "cheese", accepted.ID, uint(owner.ID), false)
+	if err != nil || validation != nil {
+		t.Fatalf("failed to accept suggestion: %v, %+v", err, validation)
+	}
+	if updated.Name != "Comté" {
+		t.Errorf("expected the suggestion to be applied, got %q", updated.Name)
+	}
+
+	history, err := qb.GetItemHistory("cheese", item.ID, 1, 1)
+	if err != nil || len(history.Revisions) != 1 || history.Revisions[0].UserID != int(submitter.ID) {
+		t.Errorf("expected the update to be credited to the submitter, got %+v, %v", history, err)
+	}
+
+	if err := qb.RejectSuggestion("cheese", rejected.ID, uint(owner.ID), false, "Made in Jura"); err != nil {
+		t.Fatalf("failed to reject suggestion: %v", err)
+	}
+	if _, _, err := qb.AcceptSuggestion(validator, "cheese", rejected.ID, uint(owner.ID), false); err == nil {
+		t.Error("expected a rejected suggestion not to be accepted")
+	}
+
+	// A suggestion made before the owner's latest edit would overwrite it
+	stale, err := qb.SubmitSuggestion("cheese", item.ID, uint(submitter.ID), map[string]interface{}{"type": "Semi-hard"}, "")
+	if err != nil {
+		t.Fatalf("failed to submit suggestion: %v", err)
+	}
+	if _, err := qb.UpdateItem("cheese", item.ID, uint(owner.ID), map[string]interface{}{"type": "Pressed"}); err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+	if _, _, err := qb.AcceptSuggestion(validator, "cheese", stale.ID, uint(owner.ID), false); err == nil || err.Error() != "version conflict" {
+		t.Errorf("expected a stale suggestion to be refused, got %v", err)
+	}
+	if current, _, _ := qb.GetItemFieldValues("cheese", item.ID); current["type"] != "Pressed" {
+		t.Errorf("expected the owner's edit to be kept, got %v", current["type"])
+	}
+
+	// Accepting one suggestion leaves the others on different fields acceptable
+	renamed, err := qb.SubmitSuggestion("cheese", item.ID, uint(submitter.ID), map[string]interface{}{"name": "Comté AOP"}, "")
+	if err != nil {
+		t.Fatalf("failed to submit suggestion: %v", err)
+	}
+	moved, err := qb.SubmitSuggestion("cheese", item.ID, uint(submitter.ID), map[string]interface{}{"origin": "Doubs"}, "")
+	if err != nil {
+		t.Fatalf("failed to submit suggestion: %v", err)
+	}
+	if _, _, err := qb.AcceptSuggestion(validator, "cheese", renamed.ID, uint(owner.ID), false); err != nil {
+		t.Fatalf("failed to accept suggestion: %v", err)
+	}
+	updated, validation, err = qb.AcceptSuggestion(validator, "cheese", moved.ID, uint(owner.ID), false)
+	if err != nil || validation != nil {
+		t.Fatalf("expected a suggestion on another field to apply on top, got %v, %+v", err, validation)
+	}
+	if current, _, _ := qb.GetItemFieldValues("cheese", updated.ID); current["origin"] != "Doubs" || current["name"] != "Comté AOP" {
+		t.Errorf("expected both suggestions applied, got %v", current)
+	}
+
+	detail, err := qb.GetSuggestion("cheese", rejected.ID, uint(submitter.ID), false)
+	if err != nil {
+		t.Fatalf("failed to get suggestion: %v", err)
+	}
+	if detail.Status != models.SuggestionStatusRejected || len(detail.Comments) != 1 || detail.Comments[0].Body != "Made in Jura" {
+		t.Errorf("expected a rejected suggestion with the reason as comment, got %+v", detail)
+	}
+
+	mine, err := qb.ListSuggestions(SuggestionParams{SubmitterID: uint(submitter.ID)})
+	if err != nil || mine.Total != 5 {
+		t.Errorf("expected the submitter's five suggestions, got %v, %v", mine, err)
+	}
+}
+
+func TestEAVQueryBuilder_Editors(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	owner := createTestUser(t)
+	editor := createTestUser(t)
+	outsider := createTestUser(t)
+
+	item, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Ossau-Iraty", "type": "Hard"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	if err := qb.GrantEditor("cheese", item.ID, uint(outsider.ID), false, uint(editor.ID)); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected only the owner to grant edit rights, got %v", err)
+	}
+	if err := qb.GrantEditor("cheese", item.ID, uint(owner.ID), false, uint(editor.ID)); err != nil {
+		t.Fatalf("failed to grant edit rights: %v", err)
+	}
+	if err := qb.GrantEditor("cheese", item.ID, uint(owner.ID), false, uint(editor.ID)); err != nil {
+		t.Errorf("expected granting twice to be a no-op, got %v", err)
+	}
+
+	editors, err := qb.ListEditors("cheese", item.ID, uint(editor.ID), false)
+	if err != nil || len(editors) != 1 || editors[0].UserID != int(editor.ID) {
+		t.Fatalf("expected one editor, got %+v, %v", editors, err)
+	}
+
+	if _, err := qb.UpdateItem("cheese", item.ID, uint(editor.ID), map[string]interface{}{"origin": "Pays basque"}); err != nil {
+		t.Errorf("expected the editor to update, got %v", err)
+	}
+	if _, err := qb.UpdateItem("cheese", item.ID, uint(outsider.ID), map[string]interface{}{"origin": "Béarn"}); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected outsiders to be refused, got %v", err)
+	}
+	if _, err := qb.UpdateItemWithOptions("cheese", item.ID, uint(outsider.ID), map[string]interface{}{"origin": "Béarn"}, UpdateOptions{IsAdmin: true}); err != nil {
+		t.Errorf("expected admins to update any item, got %v", err)
+	}
+
+	if err := qb.RevokeEditor("cheese", item.ID, uint(editor.ID), false, uint(editor.ID)); err != nil {
+		t.Fatalf("expected editors to give up their rights, got %v", err)
+	}
+	if err := qb.DeleteItem("cheese", item.ID, uint(editor.ID), false); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected a revoked editor to be refused, got %v", err)
+	}
+
+	if err := qb.GrantEditor("cheese", item.ID, uint(owner.ID), false, uint(editor.ID)); err != nil {
+		t.Fatalf("failed to grant edit rights again: %v", err)
+	}
+	if err := qb.DeleteItem("cheese", item.ID, uint(editor.ID), false); err != nil {
+		t.Errorf("expected the editor to delete, got %v", err)
+	}
+}
+
+func TestEAVQueryBuilder_OwnershipTransfer(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	owner := createTestUser(t)
+	recipient := createTestUser(t)
+	admin := createTestUser(t)
+
+	item, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Abondance", "type": "Hard"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	if err := qb.GrantEditor("cheese", item.ID, uint(owner.ID), false, uint(recipient.ID)); err != nil {
+		t.Fatalf("failed to grant edit rights: %v", err)
+	}
+
+	if _, err := qb.RequestTransfer("cheese", item.ID, uint(recipient.ID), uint(admin.ID), ""); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected only the owner to offer the item, got %v", err)
+	}
+	declined, err := qb.RequestTransfer("cheese", item.ID, uint(owner.ID), uint(recipient.ID), "")
+	if err != nil {
+		t.Fatalf("failed to offer item: %v", err)
+	}
+	if _, err := qb.RequestTransfer("cheese", item.ID, uint(owner.ID), uint(admin.ID), ""); err == nil {
+		t.Error("expected a second pending transfer to be refused")
+	}
+	if err := qb.DeclineTransfer(declined.ID, uint(recipient.ID)); err != nil {
+		t.Fatalf("failed to decline transfer: %v", err)
+	}
+
+	transfer, err := qb.RequestTransfer("cheese", item.ID, uint(owner.ID), uint(recipient.ID), "Yours now")
+	if err != nil {
+		t.Fatalf("failed to offer item: %v", err)
+	}
+	incoming, err := qb.ListTransfers(TransferParams{UserID: uint(recipient.ID), Direction: "incoming", Status: models.TransferStatusPending})
+	if err != nil || incoming.Total != 1 || incoming.Transfers[0].ItemName != "Abondance" {
+		t.Fatalf("expected one pending incoming transfer, got %+v, %v", incoming, err)
+	}
+	if _, err := qb.AcceptTransfer(transfer.ID, uint(owner.ID)); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("expected only the recipient to accept, got %v", err)
+	}
+
+	accepted, err := qb.AcceptTransfer(transfer.ID, uint(recipient.ID))
+	if err != nil {
+		t.Fatalf("failed to accept transfer: %v", err)
+	}
+	if accepted.UserID != int(recipient.ID) || accepted.Version != item.Version+1 {
+		t.Errorf("expected the recipient to own a new version, got owner %d version %d", accepted.UserID, accepted.Version)
+	}
+	var grants int64
+	utils.DB.Model(&models.ItemEditor{}).Where("item_id = ?", item.ID).Count(&grants)
+	if grants != 0 {
+		t.Errorf("expected the new owner's edit grant to be dropped, got %d grants", grants)
+	}
+	if _, err := qb.UpdateItem("cheese", item.ID, uint(owner.ID), map[string]interface{}{"origin": "Savoie"}); err == nil {
+		t.Error("expected the previous owner to lose edit rights")
+	}
+
+	reassigned, err := qb.ReassignItem("cheese", item.ID, uint(admin.ID), uint(admin.ID))
+	if err != nil || reassigned.UserID != int(admin.ID) {
+		t.Fatalf("expected admin reassignment, got %+v, %v", reassigned, err)
+	}
+
+	// Deleting an account hands its items, trashed ones included, to the system owner
+	if _, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Tamié", "type": "Soft"}); err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	trashed, err := qb.CreateItem("cheese", uint(owner.ID), map[string]interface{}{"name": "Chevrotin", "type": "Soft"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	if err := qb.DeleteItem("cheese", trashed.ID, uint(owner.ID), false); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+
+	system, err := SystemOwner(utils.DB)
+	if err != nil {
+		t.Fatalf("failed to get system owner: %v", err)
+	}
+	count, err := ReassignUserItems(utils.DB, uint(owner.ID), system.ID, uint(owner.ID))
+	if err != nil || count != 2 {
+		t.Fatalf("expected two items reassigned, got %d, %v", count, err)
+	}
+	var remaining int64
+	utils.DB.Unscoped().Model(&models.Item{}).Where("user_id = ?", owner.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("expected no item left to the deleted user, got %d", remaining)
+	}
+}
+
+func TestSystemOwner_DisplayNameTaken(t *testing.T) {
+	_, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+	utils.DB.Model(user).Update("display_name", systemOwnerDisplayName)
+
+	system, err := SystemOwner(utils.DB)
+	if err != nil {
+		t.Fatalf("failed to get system owner: %v", err)
+	}
+	if system.DisplayName != systemOwnerDisplayName+" 2" {
+		t.Errorf("expected the next free display name, got %q", system.DisplayName)
+	}
+	again, err := SystemOwner(utils.DB)
+	if err != nil || again.ID != system.ID {
+		t.Errorf("expected the same system owner, got %v, %v", again, err)
+	}
+}
+
+func TestEAVQueryBuilder_SeedChanges(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+	item, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{"name": "Comte", "type": "Hard", "origin": "Jura"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	changes, state, version, err := qb.SeedChanges("cheese", item.ID, map[string]interface{}{
+		"name":     "Comte",
+		"origin":   "Doubs",
+		"producer": "Fruitière",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 2 || changes["origin"].From != "Jura" || changes["producer"].From != nil {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+	if state["type"] != "Hard" || state["origin"] != "Doubs" {
+		t.Errorf("expected fields left out of the seed to be kept, got %v", state)
+	}
+	if version != item.Version {
+		t.Errorf("expected version %d, got %d", item.Version, version)
+	}
+
+	changes, _, _, err = qb.SeedChanges("cheese", item.ID, map[string]interface{}{"name": "Comte", "origin": nil, "description": nil})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes["origin"].To != nil {
+		t.Errorf("expected only the origin to be cleared, got %+v", changes)
+	}
+
+	if _, _, _, err := qb.SeedChanges("cheese", item.ID, map[string]interface{}{"unknown": "x"}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestEAVQueryBuilder_SeedItemsWithRatings(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	admin := createTestUser(t)
+	alice := createTestUser(t)
+	bob := createTestUser(t)
+	grade := float32(4.5)
+
+	items := []SeedItem{
+		{Position: 1, Fields: map[string]interface{}{"name": "Comte", "type": "Hard"}, Ratings: []SeedRating{
+			{User: strings.ToUpper(alice.Email), Grade: &grade, Note: "Nutty", SharedWith: []string{bob.Email, alice.Email}},
+		}},
+		{Position: 2, Fields: map[string]interface{}{"name": "Brie", "type": "Soft"}, Ratings: []SeedRating{
+			{User: "nobody@example.com", Grade: &grade},
+		}},
+	}
+	result := utils.SeedResult{}
+	var plan []SeedPlanEntry
+	err := qb.SeedItems("cheese", admin.ID, items, 0, SeedOptions{Mode: SeedModeUpsert}, &result, func(done int, entry SeedPlanEntry) error {
+		plan = append(plan, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Added != 1 || len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "unknown user 'nobody@example.com'") {
+		t.Fatalf("expected the item with an unknown rater to be refused, got %+v", result)
+	}
+	if plan[0].Ratings != 1 || plan[1].Action != SeedActionInvalid {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	var rating models.Rating
+	if err := utils.DB.Preload("Viewers").Where("user_id = ? AND item_id = ?", alice.ID, plan[0].ItemID).First(&rating).Error; err != nil {
+		t.Fatalf("expected the rating to be created: %v", err)
+	}
+	if rating.Grade != 4.5 || rating.Note != "Nutty" || len(rating.Viewers) != 1 || rating.Viewers[0].ID != bob.ID {
+		t.Errorf("expected a rating shared with bob only, got %+v", rating)
+	}
+
+	// Seeding the same rating again changes nothing
+	result = utils.SeedResult{}
+	plan = nil
+	qb.SeedItems("cheese", admin.ID, items[:1], 0, SeedOptions{Mode: SeedModeUpsert}, &result, func(done int, entry SeedPlanEntry) error {
+		plan = append(plan, entry)
+		return nil
+	})
+	if result.Skipped != 1 || plan[0].Reason != "already up to date" {
+		t.Errorf("expected the item to be up to date, got %+v", plan)
+	}
+
+	// A new grade updates the rating, and unsharing clears its viewers
+	newGrade := float32(3)
+	items[0].Ratings = []SeedRating{{User: alice.Email, Grade: &newGrade}}
+	result = utils.SeedResult{}
+	plan = nil
+	qb.SeedItems("cheese", admin.ID, items[:1], 0, SeedOptions{Mode: SeedModeUpsert}, &result, func(done int, entry SeedPlanEntry) error {
+		plan = append(plan, entry)
+		return nil
+	})
+	if result.Updated != 1 || plan[0].Action != SeedActionUpdate || plan[0].Ratings != 1 {
+		t.Errorf("expected the rating to be updated, got %+v", plan)
+	}
+	rating = models.Rating{}
+	utils.DB.Preload("Viewers").Where("user_id = ? AND item_id = ?", alice.ID, plan[0].ItemID).First(&rating)
+	if rating.Grade != 3 || rating.Note != "" || len(rating.Viewers) != 0 {
+		t.Errorf("expected the rating to be replaced, got %+v", rating)
+	}
+}
+
+func TestEAVQueryBuilder_CheckConsistency(t *testing.T) {
+	qb, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+	item, err := qb.CreateItem("cheese", uint(user.ID), map[string]interface{}{"name": "Comte", "type": "Hard", "unknown": "x"})
+	if err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	report, err := qb.CheckConsistency("cheese", ConsistencyOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.ItemsChecked != 1 || report.ItemsWithIssues != 0 {
+		t.Fatalf("expected a new item to be consistent, got %+v", report)
+	}
+
+	// Drift the JSON copy away from the rows
+	utils.DB.Model(&models.Item{}).Where("id = ?", item.ID).UpdateColumn("field_values", `{"name":"Comté","type":"Hard","unknown":"x"}`)
+
+	report, _ = qb.CheckConsistency("cheese", ConsistencyOptions{})
+	if report.IssueCounts[IssueMismatch] != 1 || report.IssueCounts[IssueUnknownKey] != 1 || report.Repaired != 0 {
+		t.Fatalf("expected a mismatch and an unknown key, got %+v", report)
+	}
+
+	// Rebuilding the rows from the JSON takes its name, and records a revision
+	report, _ = qb.CheckConsistency("cheese", ConsistencyOptions{Repair: RepairSourceJSON})
+	if report.Repaired != 1 || len(report.RepairErrors) != 0 {
+		t.Fatalf("expected the item to be repaired, got %+v", report)
+	}
+	values, version, _ := qb.GetItemFieldValues("cheese", item.ID)
+	if values["name"] != "Comté" || version != item.Version+1 {
+		t.Errorf("expected the rows to follow the JSON, got %v at version %d", values, version)
+	}
+	var revision models.ItemRevision
+	utils.DB.Where("item_id = ?", item.ID).Order("id DESC").First(&revision)
+	if revision.Action != models.RevisionActionRepair {
+		t.Errorf("expected a repair revision, got %s", revision.Action)
+	}
+
+	// Rebuilding the JSON from the rows leaves the version alone
+	utils.DB.Model(&models.Item{}).Where("id = ?", item.ID).UpdateColumn("field_values", `{"name":"Brie"}`)
+	report, _ = qb.CheckConsistency("cheese", ConsistencyOptions{Repair: RepairSourceEAV})
+	if report.Repaired != 1 {
+		t.Fatalf("expected the item to be repaired, got %+v", report)
+	}
+	var dbItem models.Item
+	utils.DB.First(&dbItem, item.ID)
+	var stored map[string]interface{}
+	json.Unmarshal([]byte(dbItem.FieldValues), &stored)
+	if stored["name"] != "Comté" || stored["type"] != "Hard" || dbItem.Version != version {
+		t.Errorf("expected the JSON to follow the rows, got %v at version %d", stored, dbItem.Version)
+	}
+
+	report, _ = qb.CheckConsistency("", ConsistencyOptions{})
+	if report.ItemsWithIssues != 0 {
+		t.Errorf("expected no issues after repair, got %+v", report.Issues)
+	}
+
+	if _, err := qb.CheckConsistency("cheese", ConsistencyOptions{Repair: "both"}); err == nil {
+		t.Error("expected an error for an unknown repair source")
+	}
+}
+
+func TestJobRunner_ResumeAndCancel(t *testing.T) {
+	_, cleanup := setupQueryBuilderTest(t)
+	defer cleanup()
+
+	user := createTestUser(t)
+	payload, _ := json.Marshal(jobPayload{
+		Items: []SeedItem{
+			{Position: 1, Fields: map[string]interface{}{"name": "Brie", "type": "Soft"}},
+			{Position: 2, Fields: map[string]interface{}{"name": "Brie", "type": "Soft"}},
+			{Position: 3, Fields: map[string]interface{}{"name": "Comte", "type": "Hard"}},
+		},
+		Options: SeedOptions{Mode: SeedModeInsert},
+	})
+
+	// A job left running by a stopped instance after its first item
+	stale := time.Now().Add(-time.Hour)
+	job := models.Job{
+		Kind:        models.JobKindSeed,
+		SchemaName:  "cheese",
+		UserID:      int(user.ID),
+		Status:      models.JobStatusRunning,
+		Payload:     string(payload),
+		Total:       3,
+		Processed:   1,
+		Added:       1,
+		Errors:      "[]",
+		HeartbeatAt: &stale,
+	}
+	if err := utils.DB.Create(&job).Error; err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+
+	GetJobRunner().runJob(job.ID)
+
+	entry, err := GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	if entry.Status != models.JobStatusCompleted || entry.Processed != 3 {
+		t.Fatalf("expected the job to complete, got %+v", entry)
+	}
+	// The first item is not seeded again, and still counts as seen
+	if entry.Added != 2 || entry.Skipped != 1 {
+		t.Errorf("expected 2 added and 1 repeat skipped, got %+v", entry)
+	}
+	var count int64
+	utils.DB.Model(&models.Item{}).Where("name = ?", "Brie").Count(&count)
+	if count != 0 {
+		t.Errorf("expected the already processed item to be left alone, found %d", count)
+	}
+
+	// A running job with a live heartbeat is not claimed twice
+	now := time.Now()
+	running := models.Job{Kind: models.JobKindSeed, SchemaName: "cheese", UserID: int(user.ID), Status: models.JobStatusRunning, Payload: string(payload), Total: 3, HeartbeatAt: &now}
+	utils.DB.Create(&running)
+	if _, claimed := GetJobRunner().claim(running.ID); claimed {
+		t.Error("expected a live job not to be claimed")
+	}
+
+	queued := models.Job{Kind: models.JobKindSeed, SchemaName: "cheese", UserID: int(user.ID), Status: models.JobStatusQueued, Payload: string(payload), Total: 3}
+	utils.DB.Create(&queued)
+	cancelled, err := CancelJob(queued.ID)
+	if err != nil {
+		t.Fatalf("failed to cancel job: %v", err)
+	}
+	if cancelled.Status != models.JobStatusCancelled {
+		t.Errorf("expected a queued job to be cancelled at once, got %s", cancelled.Status)
+	}
+	if _, err := CancelJob(queued.ID); err == nil || err.Error() != "job is already cancelled" {
+		t.Errorf("expected a finished job to be refused, got %v", err)
+	}
+
+	// A running job stops at its next checkpoint
+	cancelled, err = CancelJob(running.ID)
+	if err != nil || !cancelled.CancelRequested || cancelled.Status != models.JobStatusRunning {
+		t.Errorf("expected cancellation to be requested, got %+v, %v", cancelled, err)
+	}
+	if err := GetJobRunner().checkpoint(&running, 1, utils.SeedResult{}, nil); err != errJobCancelled {
+		t.Errorf("expected the checkpoint to stop the job, got %v", err)
+	}
+}
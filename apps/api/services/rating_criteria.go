@@ -0,0 +1,232 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+// maxRatingCriteria bounds the criteria a schema can declare
+const maxRatingCriteria = 20
+
+var ratingCriterionKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// RatingCriterion is an aspect of an item scored on its own, such as the nose of
+// a wine. Its scale defaults to the schema's rating scale, and its weight, 1 by
+// default, sets its share of the overall grade.
+type RatingCriterion struct {
+	Key    string       `json:"key"`
+	Label  string       `json:"label"`
+	Scale  *RatingScale `json:"scale,omitempty"`
+	Weight *float64     `json:"weight,omitempty"`
+}
+
+// RatingCriteria returns the schema's rating criteria; none when unset
+func (cs *CachedSchema) RatingCriteria() []RatingCriterion {
+	criteria, err := ParseRatingCriteria(cs.Schema.RatingCriteria)
+	if err != nil {
+		return nil
+	}
+	return criteria
+}
+
+// ScaleOf returns the criterion's scale, given the schema's
+func (c RatingCriterion) ScaleOf(schemaScale RatingScale) RatingScale {
+	if c.Scale != nil {
+		return *c.Scale
+	}
+	return schemaScale
+}
+
+// WeightOf returns the criterion's weight
+func (c RatingCriterion) WeightOf() float64 {
+	if c.Weight != nil {
+		return *c.Weight
+	}
+	return 1
+}
+
+// ParseRatingCriteria reads stored rating criteria
+func ParseRatingCriteria(raw *string) ([]RatingCriterion, error) {
+	if raw == nil || *raw == "" || *raw == "null" {
+		return nil, nil
+	}
+	var criteria []RatingCriterion
+	if err := json.Unmarshal([]byte(*raw), &criteria); err != nil {
+		return nil, fmt.Errorf("invalid rating criteria: %w", err)
+	}
+	return criteria, ValidateRatingCriteria(criteria)
+}
+
+// ValidateRatingCriteria checks criteria keys, labels, scales and weights
+func ValidateRatingCriteria(criteria []RatingCriterion) error {
+	if len(criteria) > maxRatingCriteria {
+		return fmt.Errorf("a schema cannot have more than %d rating criteria", maxRatingCriteria)
+	}
+	seen := make(map[string]bool, len(criteria))
+	totalWeight := 0.0
+	for _, criterion := range criteria {
+		if !ratingCriterionKeyPattern.MatchString(criterion.Key) || len(criterion.Key) > 50 {
+			return fmt.Errorf("rating criterion key '%s' must be lowercase letters, digits and underscores", criterion.Key)
+		}
+		if seen[criterion.Key] {
+			return fmt.Errorf("rating criterion '%s' is declared twice", criterion.Key)
+		}
+		seen[criterion.Key] = true
+		if criterion.Label == "" {
+			return fmt.Errorf("rating criterion '%s' has no label", criterion.Key)
+		}
+		if criterion.Scale != nil {
+			if err := criterion.Scale.Validate(); err != nil {
+				return fmt.Errorf("rating criterion '%s': %v", criterion.Key, err)
+			}
+		}
+		if criterion.WeightOf() < 0 {
+			return fmt.Errorf("rating criterion '%s' cannot have a negative weight", criterion.Key)
+		}
+		totalWeight += criterion.WeightOf()
+	}
+	if len(criteria) > 0 && totalWeight == 0 {
+		return fmt.Errorf("rating criteria need a positive weight in total")
+	}
+	return nil
+}
+
+// OverallGrade is the weighted mean of the scores, each normalized on its
+// criterion's scale, as a grade of the schema's scale. Criteria without a score
+// are left out of the mean; ok is false when no weighted score is given.
+func OverallGrade(cached *CachedSchema, scores map[string]float64) (grade float64, ok bool) {
+	scale := cached.RatingScale()
+	total, weights := 0.0, 0.0
+	for _, criterion := range cached.RatingCriteria() {
+		score, exists := scores[criterion.Key]
+		if !exists {
+			continue
+		}
+		weight := criterion.WeightOf()
+		total += weight * criterion.ScaleOf(scale).Normalize(score)
+		weights += weight
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return scale.Denormalize(total / weights), true
+}
+
+// SaveRatingScores replaces a rating's criterion scores
+func SaveRatingScores(tx *gorm.DB, ratingID uint, scores map[string]float64) error {
+	if err := tx.Unscoped().Where("rating_id = ?", ratingID).Delete(&models.RatingScore{}).Error; err != nil {
+		return fmt.Errorf("failed to clear rating scores: %w", err)
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(scores))
+	for key := range scores {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rows := make([]models.RatingScore, len(keys))
+	for i, key := range keys {
+		rows[i] = models.RatingScore{RatingID: ratingID, CriterionKey: key, Score: float32(scores[key])}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return fmt.Errorf("failed to save rating scores: %w", err)
+	}
+	return nil
+}
+
+// RescaleRatingScores converts the stored scores of a schema's criteria within
+// tx when the scale of a criterion changes, whether its own or the schema's it
+// defaults to. Criteria are matched by key; scores of criteria no longer
+// declared are left as they are. It returns the number of scores changed.
+func RescaleRatingScores(tx *gorm.DB, schemaID uint, fromScale, toScale RatingScale, fromCriteria, toCriteria []RatingCriterion) (int64, error) {
+	previous := make(map[string]RatingScale, len(fromCriteria))
+	for _, criterion := range fromCriteria {
+		previous[criterion.Key] = criterion.ScaleOf(fromScale)
+	}
+
+	var changed int64
+	items := tx.Unscoped().Model(&models.Item{}).Select("id").Where("schema_id = ?", schemaID)
+	ratings := tx.Unscoped().Model(&models.Rating{}).Select("id").Where("item_id IN (?)", items)
+	for _, criterion := range toCriteria {
+		from, ok := previous[criterion.Key]
+		to := criterion.ScaleOf(toScale)
+		if !ok || from.SameRange(to) {
+			continue
+		}
+
+		var batch []models.RatingScore
+		result := tx.Unscoped().Select("id, score").
+			Where("criterion_key = ? AND rating_id IN (?)", criterion.Key, ratings).
+			FindInBatches(&batch, rescaleBatchSize, func(batchTx *gorm.DB, _ int) error {
+				for _, score := range batch {
+					rescaled := float32(from.Rescale(float64(score.Score), to))
+					if rescaled == score.Score {
+						continue
+					}
+					if err := tx.Unscoped().Model(&models.RatingScore{}).Where("id = ?", score.ID).UpdateColumn("score", rescaled).Error; err != nil {
+						return err
+					}
+					changed++
+				}
+				return nil
+			})
+		if result.Error != nil {
+			return 0, fmt.Errorf("failed to rescale rating scores: %w", result.Error)
+		}
+	}
+	return changed, nil
+}
+
+// CriterionStats is the community average of an item's scores on a criterion
+type CriterionStats struct {
+	Key               string      `json:"key"`
+	Label             string      `json:"label"`
+	TotalScores       int         `json:"total_scores"`
+	Average           float64     `json:"average"`
+	NormalizedAverage float64     `json:"normalized_average"`
+	Scale             RatingScale `json:"scale"`
+}
+
+// CriteriaStatsForItem averages an item's live ratings on each of its schema's
+// criteria, in the order the schema declares them
+func CriteriaStatsForItem(cached *CachedSchema, itemID uint) ([]CriterionStats, error) {
+	var rows []struct {
+		CriterionKey string
+		Count        int
+		Average      float64
+	}
+	if err := utils.DB.Model(&models.RatingScore{}).
+		Select("rating_scores.criterion_key, COUNT(*) AS count, AVG(rating_scores.score) AS average").
+		Joins("JOIN ratings ON ratings.id = rating_scores.rating_id AND ratings.deleted_at IS NULL").
+		Where("ratings.item_id = ?", itemID).
+		Group("rating_scores.criterion_key").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load criteria stats: %w", err)
+	}
+
+	byKey := make(map[string]int, len(rows))
+	for i, row := range rows {
+		byKey[row.CriterionKey] = i
+	}
+
+	scale := cached.RatingScale()
+	stats := []CriterionStats{}
+	for _, criterion := range cached.RatingCriteria() {
+		entry := CriterionStats{Key: criterion.Key, Label: criterion.Label, Scale: criterion.ScaleOf(scale)}
+		if i, ok := byKey[criterion.Key]; ok && rows[i].Count > 0 {
+			entry.TotalScores = rows[i].Count
+			entry.Average = rows[i].Average
+			entry.NormalizedAverage = entry.Scale.Normalize(rows[i].Average)
+		}
+		stats = append(stats, entry)
+	}
+	return stats, nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestValidateRatingCriteria(t *testing.T) {
+	zero, negative := 0.0, -1.0
+	valid := []RatingCriterion{
+		{Key: "nose", Label: "Nose"},
+		{Key: "finish", Label: "Finish", Scale: &RatingScale{Min: 1, Max: 10, Step: 1}, Weight: &zero},
+	}
+	if err := ValidateRatingCriteria(valid); err != nil {
+		t.Errorf("expected criteria to be accepted: %v", err)
+	}
+
+	invalid := [][]RatingCriterion{
+		{{Key: "Nose", Label: "Nose"}},
+		{{Key: "nose", Label: "Nose"}, {Key: "nose", Label: "Nose again"}},
+		{{Key: "nose"}},
+		{{Key: "nose", Label: "Nose", Scale: &RatingScale{Min: 1, Max: 1, Step: 1}}},
+		{{Key: "nose", Label: "Nose", Weight: &negative}},
+		{{Key: "nose", Label: "Nose", Weight: &zero}},
+	}
+	for _, criteria := range invalid {
+		if err := ValidateRatingCriteria(criteria); err == nil {
+			t.Errorf("expected %+v to be refused", criteria)
+		}
+	}
+}
+
+func TestValidationEngine_Rating(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetSchema("cheese")
+	criteria := `[{"key":"texture","label":"Texture"},{"key":"taste","label":"Taste","weight":3,"scale":{"min":0,"max":100,"step":1}}]`
+	cached.Schema.RatingCriteria = &criteria
+	engine := NewValidationEngine(registry)
+
+	grade := 4.5
+	if result := engine.ValidateRating("cheese", &grade, map[string]float64{"texture": 3, "taste": 80}); !result.Valid {
+		t.Errorf("expected a valid rating, got %+v", result.Errors)
+	}
+	// Scores alone give the overall grade
+	if result := engine.ValidateRating("cheese", nil, map[string]float64{"taste": 80}); !result.Valid {
+		t.Errorf("expected scores without a grade to be accepted, got %+v", result.Errors)
+	}
+
+	offScale := 4.25
+	result := engine.ValidateRating("cheese", &offScale, map[string]float64{"texture": 6, "taste": 80.5, "aroma": 2})
+	codes := make(map[string]string)
+	for _, err := range result.Errors {
+		codes[err.Field] = err.Code
+	}
+	expected := map[string]string{"grade": "invalid_step", "scores.texture": "max_value", "scores.taste": "invalid_step", "scores.aroma": "unknown_criterion"}
+	if result.Valid || len(codes) != len(expected) {
+		t.Fatalf("expected %v, got %+v", expected, result.Errors)
+	}
+	for field, code := range expected {
+		if codes[field] != code {
+			t.Errorf("expected %s on %s, got %s", code, field, codes[field])
+		}
+	}
+
+	if result := engine.ValidateRating("cheese", nil, nil); result.Valid || result.Errors[0].Code != "required" {
+		t.Errorf("expected a grade to be required without scores, got %+v", result.Errors)
+	}
+}
+
+func TestOverallGrade(t *testing.T) {
+	registry := createTestRegistry()
+	cached, _ := registry.GetSchema("cheese")
+	criteria := `[{"key":"texture","label":"Texture"},{"key":"taste","label":"Taste","weight":3,"scale":{"min":0,"max":100,"step":1}}]`
+	cached.Schema.RatingCriteria = &criteria
+
+	// (1 * 2/5 + 3 * 90/100) / 4 = 0.775 of 5 stars, rounded to the half star
+	if grade, ok := OverallGrade(cached, map[string]float64{"texture": 2, "taste": 90}); !ok || grade != 4 {
+		t.Errorf("expected an overall of 4, got %v (%v)", grade, ok)
+	}
+	if grade, ok := OverallGrade(cached, map[string]float64{"texture": 5}); !ok || grade != 5 {
+		t.Errorf("expected missing criteria to be left out, got %v (%v)", grade, ok)
+	}
+	if _, ok := OverallGrade(cached, nil); ok {
+		t.Error("expected no overall without scores")
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+// rescaleBatchSize is the number of ratings converted at a time
+const rescaleBatchSize = 500
+
+// maxRatingScaleSteps bounds the number of grades a scale can offer
+const maxRatingScaleSteps = 1000
+
+// RatingScale is the range of grades a schema's items are rated on: from Min to
+// Max in Step increments, with optional labels for some grades, keyed by grade
+type RatingScale struct {
+	Min    float64           `json:"min"`
+	Max    float64           `json:"max"`
+	Step   float64           `json:"step"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// DefaultRatingScale is the five-star scale with half stars used by schemas that
+// do not declare one
+var DefaultRatingScale = RatingScale{Min: 0, Max: 5, Step: 0.5}
+
+// RatingScale returns the schema's rating scale, or the default one
+func (cs *CachedSchema) RatingScale() RatingScale {
+	scale, err := ParseRatingScale(cs.Schema.RatingScale)
+	if err != nil {
+		return DefaultRatingScale
+	}
+	return scale
+}
+
+// ParseRatingScale reads a stored rating scale; an unset one is the default
+func ParseRatingScale(raw *string) (RatingScale, error) {
+	if raw == nil || *raw == "" || *raw == "null" {
+		return DefaultRatingScale, nil
+	}
+	var scale RatingScale
+	if err := json.Unmarshal([]byte(*raw), &scale); err != nil {
+		return DefaultRatingScale, fmt.Errorf("invalid rating scale: %w", err)
+	}
+	return scale, scale.Validate()
+}
+
+// Validate checks that the scale is usable: a range of whole steps, labelled
+// only on its grades
+func (s RatingScale) Validate() error {
+	if s.Max <= s.Min {
+		return fmt.Errorf("rating scale max must be greater than min")
+	}
+	if s.Step <= 0 {
+		return fmt.Errorf("rating scale step must be positive")
+	}
+	steps := (s.Max - s.Min) / s.Step
+	if !nearlyWhole(steps) {
+		return fmt.Errorf("rating scale step must divide the range from min to max")
+	}
+	if steps > maxRatingScaleSteps {
+		return fmt.Errorf("rating scale cannot have more than %d steps", maxRatingScaleSteps)
+	}
+	for key := range s.Labels {
+		grade, err := strconv.ParseFloat(key, 64)
+		if err != nil || s.Check(grade) != nil {
+			return fmt.Errorf("rating scale label '%s' is not a grade of the scale", key)
+		}
+	}
+	return nil
+}
+
+// Check tells whether a grade is on the scale
+func (s RatingScale) Check(grade float64) error {
+	if grade < s.Min-ratingScaleEpsilon || grade > s.Max+ratingScaleEpsilon {
+		return fmt.Errorf("grade must be between %g and %g", s.Min, s.Max)
+	}
+	if !nearlyWhole((grade - s.Min) / s.Step) {
+		return fmt.Errorf("grade must be in steps of %g from %g", s.Step, s.Min)
+	}
+	return nil
+}
+
+// Normalize maps a grade on the scale to the 0-1 range
+func (s RatingScale) Normalize(grade float64) float64 {
+	return (grade - s.Min) / (s.Max - s.Min)
+}
+
+// Denormalize maps a 0-1 value to the nearest grade of the scale
+func (s RatingScale) Denormalize(value float64) float64 {
+	steps := math.Round(value * (s.Max - s.Min) / s.Step)
+	return math.Max(s.Min, math.Min(s.Max, s.Min+steps*s.Step))
+}
+
+// SameRange tells whether two scales offer the same grades; labels aside
+func (s RatingScale) SameRange(other RatingScale) bool {
+	return s.Min == other.Min && s.Max == other.Max && s.Step == other.Step
+}
+
+// Rescale maps a grade of the scale to the nearest grade of another scale,
+// keeping its position between min and max
+func (s RatingScale) Rescale(grade float64, to RatingScale) float64 {
+	return to.Denormalize(s.Normalize(grade))
+}
+
+// RescaleRatings converts the grades of every rating of a schema's items, trashed
+// ones included, from one scale to another within tx, so stored grades and their
+// averages stay on the schema's scale. It returns the number of ratings changed.
+func RescaleRatings(tx *gorm.DB, schemaID uint, from, to RatingScale) (int64, error) {
+	if from.SameRange(to) {
+		return 0, nil
+	}
+
+	var changed int64
+	var batch []models.Rating
+	items := tx.Unscoped().Model(&models.Item{}).Select("id").Where("schema_id = ?", schemaID)
+	result := tx.Unscoped().Select("id, grade").Where("item_id IN (?)", items).
+		FindInBatches(&batch, rescaleBatchSize, func(batchTx *gorm.DB, _ int) error {
+			for _, rating := range batch {
+				grade := float32(from.Rescale(float64(rating.Grade), to))
+				if grade == rating.Grade {
+					continue
+				}
+				if err := tx.Unscoped().Model(&models.Rating{}).Where("id = ?", rating.ID).UpdateColumn("grade", grade).Error; err != nil {
+					return err
+				}
+				changed++
+			}
+			return nil
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to rescale ratings: %w", result.Error)
+	}
+	return changed, nil
+}
+
+// ratingScaleEpsilon absorbs the float32 rounding of stored grades
+const ratingScaleEpsilon = 1e-4
+
+func nearlyWhole(value float64) bool {
+	return math.Abs(value-math.Round(value)) < ratingScaleEpsilon
+}
+
+// ItemSchema returns the schema of a live item
+func ItemSchema(itemID uint) (*CachedSchema, error) {
+	var item models.Item
+	if err := utils.DB.Select("id, schema_id").First(&item, itemID).Error; err != nil {
+		return nil, fmt.Errorf("item not found")
+	}
+	cached, ok := GetSchemaRegistry().GetSchemaByID(item.SchemaID)
+	if !ok {
+		return nil, fmt.Errorf("schema not found")
+	}
+	return cached, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestParseRatingScale(t *testing.T) {
+	scale, err := ParseRatingScale(nil)
+	if err != nil || scale.Max != DefaultRatingScale.Max || scale.Step != DefaultRatingScale.Step {
+		t.Errorf("expected the default scale when unset, got %+v (%v)", scale, err)
+	}
+
+	raw := `{"min":50,"max":100,"step":1,"labels":{"50":"Flawed","90":"Outstanding"}}`
+	scale, err = ParseRatingScale(&raw)
+	if err != nil || scale.Min != 50 || scale.Labels["90"] != "Outstanding" {
+		t.Errorf("unexpected scale %+v (%v)", scale, err)
+	}
+
+	invalid := []string{
+		`{"min":5,"max":5,"step":1}`,
+		`{"min":0,"max":10,"step":0}`,
+		`{"min":0,"max":10,"step":3}`,
+		`{"min":0,"max":100000,"step":1}`,
+		`{"min":0,"max":5,"step":1,"labels":{"2.5":"Average"}}`,
+		`{"min":0,"max":5,"step":1,"labels":{"good":"Good"}}`,
+		`{"min":"zero"}`,
+	}
+	for _, raw := range invalid {
+		if _, err := ParseRatingScale(&raw); err == nil {
+			t.Errorf("expected %s to be refused", raw)
+		}
+	}
+}
+
+func TestRatingScale_Check(t *testing.T) {
+	scale := RatingScale{Min: 6, Max: 10, Step: 0.25}
+	for _, grade := range []float32{6, 8.75, 10} {
+		if err := scale.Check(float64(grade)); err != nil {
+			t.Errorf("expected %v to be on the scale: %v", grade, err)
+		}
+	}
+	for _, grade := range []float32{5.75, 10.25, 8.8} {
+		if err := scale.Check(float64(grade)); err == nil {
+			t.Errorf("expected %v to be refused", grade)
+		}
+	}
+
+	// Grades stored as float32 keep steps that are not exact in binary
+	tenths := RatingScale{Min: 0, Max: 10, Step: 0.1}
+	if err := tenths.Check(float64(float32(7.3))); err != nil {
+		t.Errorf("expected 7.3 to be on a scale of tenths: %v", err)
+	}
+
+	if normalized := scale.Normalize(9); normalized != 0.75 {
+		t.Errorf("expected 9 out of 6-10 to normalize to 0.75, got %v", normalized)
+	}
+	if grade := scale.Denormalize(0.8); grade != 9.25 {
+		t.Errorf("expected 0.8 to map to 9.25, got %v", grade)
+	}
+	if grade := scale.Denormalize(1.2); grade != 10 {
+		t.Errorf("expected values above 1 to map to the max, got %v", grade)
+	}
+}
+
+func TestRatingScale_Rescale(t *testing.T) {
+	five := RatingScale{Min: 0, Max: 5, Step: 0.5}
+	hundred := RatingScale{Min: 0, Max: 100, Step: 1}
+
+	if grade := five.Rescale(4.5, hundred); grade != 90 {
+		t.Errorf("expected 4.5 out of 5 to become 90 out of 100, got %v", grade)
+	}
+	if grade := hundred.Rescale(73, five); grade != 3.5 {
+		t.Errorf("expected 73 out of 100 to round to 3.5 out of 5, got %v", grade)
+	}
+	if !five.SameRange(RatingScale{Min: 0, Max: 5, Step: 0.5}) {
+		t.Error("expected identical scales to share a range")
+	}
+	if five.SameRange(hundred) {
+		t.Error("expected different scales not to share a range")
+	}
+}
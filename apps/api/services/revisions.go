@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type RevisionEntry struct {
+	ID              uint                   `json:"id"`
+	Action          models.RevisionAction  `json:"action"`
+	UserID          int                    `json:"user_id"`
+	UserDisplayName string                 `json:"user_display_name,omitempty"`
+	SchemaVersionID *uint                  `json:"schema_version_id,omitempty"`
+	SchemaVersion   int                    `json:"schema_version,omitempty"`
+	Changes         map[string]FieldChange `json:"changes"`
+	Snapshot        map[string]interface{} `json:"snapshot"`
+	CreatedAt       time.Time              `json:"created_at"`
+}
+
+type HistoryResult struct {
+	Revisions  []RevisionEntry
+	Total      int64
+	Page       int
+	PerPage    int
+	TotalPages int
+}
+
+// loadFieldValuesMap reads an item's current EAV rows as typed values
+func loadFieldValuesMap(tx *gorm.DB, itemID uint, fields []*models.ItemTypeField) (map[string]interface{}, error) {
+	var rows []models.ItemFieldValue
+	if err := tx.Where("item_id = ?", itemID).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read field values: %w", err)
+	}
+	return buildFieldValuesMap(rows, fields), nil
+}
+
+// diffFieldValues lists the fields whose value differs between two states. A
+// missing key stands for no value.
+func diffFieldValues(before, after map[string]interface{}) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	for key, from := range before {
+		if to, exists := after[key]; !exists || !reflect.DeepEqual(from, to) {
+			changes[key] = FieldChange{From: from, To: after[key]}
+		}
+	}
+	for key, to := range after {
+		if _, exists := before[key]; !exists {
+			changes[key] = FieldChange{From: nil, To: to}
+		}
+	}
+	return changes
+}
+
+// recordRevision stores a revision for a change made within tx. Updates that
+// change nothing are not recorded.
+func recordRevision(tx *gorm.DB, cached *CachedSchema, item *models.Item, userID uint, action models.RevisionAction, before, after map[string]interface{}) error {
+	changes := diffFieldValues(before, after)
+	if action == models.RevisionActionUpdate && len(changes) == 0 {
+		return nil
+	}
+
+	snapshot := after
+	if action == models.RevisionActionDelete {
+		snapshot = before
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revision changes: %w", err)
+	}
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revision snapshot: %w", err)
+	}
+
+	revision := models.ItemRevision{
+		ItemID:          item.ID,
+		SchemaID:        item.SchemaID,
+		SchemaVersionID: item.SchemaVersionID,
+		UserID:          int(userID),
+		Action:          action,
+		Changes:         string(changesJSON),
+		Snapshot:        string(snapshotJSON),
+	}
+	if cached.Version != nil {
+		revision.SchemaVersionID = &cached.Version.ID
+	}
+
+	if err := tx.Create(&revision).Error; err != nil {
+		return fmt.Errorf("failed to record revision: %w", err)
+	}
+	return nil
+}
+
+// GetItemHistory returns an item's revisions, newest first. History stays
+// readable after the item is deleted.
+func (qb *EAVQueryBuilder) GetItemHistory(schemaName string, itemID uint, page, perPage int) (*HistoryResult, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.Item
+	if err := utils.DB.Unscoped().Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("item not found")
+		}
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 20
+	}
+	if perPage > 100 {
+		perPage = 100
+	}
+
+	query := utils.DB.Model(&models.ItemRevision{}).Where("item_id = ?", itemID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count revisions: %w", err)
+	}
+
+	var revisions []models.ItemRevision
+	if err := query.Order("id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+
+	userIDs := make([]int, 0, len(revisions))
+	versionIDs := make([]uint, 0, len(revisions))
+	for _, revision := range revisions {
+		userIDs = append(userIDs, revision.UserID)
+		if revision.SchemaVersionID != nil {
+			versionIDs = append(versionIDs, *revision.SchemaVersionID)
+		}
+	}
+
+	var users []models.User
+	if len(userIDs) > 0 {
+		utils.DB.Unscoped().Select("id, display_name").Where("id IN ?", userIDs).Find(&users)
+	}
+	displayNames := make(map[int]string, len(users))
+	for _, user := range users {
+		displayNames[int(user.ID)] = user.DisplayName
+	}
+
+	var versions []models.SchemaVersion
+	if len(versionIDs) > 0 {
+		utils.DB.Select("id, version").Where("id IN ?", versionIDs).Find(&versions)
+	}
+	versionNumbers := make(map[uint]int, len(versions))
+	for _, version := range versions {
+		versionNumbers[version.ID] = version.Version
+	}
+
+	entries := make([]RevisionEntry, len(revisions))
+	for i, revision := range revisions {
+		entry := RevisionEntry{
+			ID:              revision.ID,
+			Action:          revision.Action,
+			UserID:          revision.UserID,
+			UserDisplayName: displayNames[revision.UserID],
+			SchemaVersionID: revision.SchemaVersionID,
+			Changes:         map[string]FieldChange{},
+			Snapshot:        map[string]interface{}{},
+			CreatedAt:       revision.CreatedAt,
+		}
+		if revision.SchemaVersionID != nil {
+			entry.SchemaVersion = versionNumbers[*revision.SchemaVersionID]
+		}
+		if revision.Changes != "" {
+			json.Unmarshal([]byte(revision.Changes), &entry.Changes)
+		}
+		if revision.Snapshot != "" {
+			json.Unmarshal([]byte(revision.Snapshot), &entry.Snapshot)
+		}
+		entries[i] = entry
+	}
+
+	totalPages := int(total) / perPage
+	if int(total)%perPage > 0 {
+		totalPages++
+	}
+
+	return &HistoryResult{
+		Revisions:  entries,
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// RevertFields prepares a revert of an item to one of its revisions. It returns
+// the full state to validate and the updates that produce it, clearing fields
+// set since. Fields no longer in the schema are dropped.
+func (qb *EAVQueryBuilder) RevertFields(schemaName string, itemID, revisionID, userID uint, isAdmin bool) (map[string]interface{}, map[string]interface{}, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var item models.Item
+	if err := utils.DB.Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, fmt.Errorf("item not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	allowed, err := CanEdit(utils.DB, &item, userID, isAdmin)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("unauthorized")
+	}
+
+	var revision models.ItemRevision
+	if err := utils.DB.Where("id = ? AND item_id = ?", revisionID, itemID).First(&revision).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, fmt.Errorf("revision not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get revision: %w", err)
+	}
+
+	var snapshot map[string]interface{}
+	if err := json.Unmarshal([]byte(revision.Snapshot), &snapshot); err != nil {
+		return nil, nil, fmt.Errorf("failed to read revision snapshot: %w", err)
+	}
+
+	current, err := loadFieldValuesMap(utils.DB, itemID, cached.Fields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state := make(map[string]interface{}, len(snapshot))
+	for _, field := range cached.Fields {
+		if value, exists := snapshot[field.Key]; exists && value != nil {
+			state[field.Key] = value
+		}
+	}
+
+	return state, ReplacementUpdates(current, state), nil
+}
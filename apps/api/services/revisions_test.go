@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestDiffFieldValues(t *testing.T) {
+	before := map[string]interface{}{"name": "Brie", "type": "Soft", "age": 4.0, "origin": "France"}
+	after := map[string]interface{}{"name": "Brie", "type": "Hard", "age": 4.0, "organic": true}
+
+	changes := diffFieldValues(before, after)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %v", changes)
+	}
+	if changes["type"].From != "Soft" || changes["type"].To != "Hard" {
+		t.Errorf("unexpected type change: %v", changes["type"])
+	}
+	if changes["origin"].From != "France" || changes["origin"].To != nil {
+		t.Errorf("expected origin to be cleared, got %v", changes["origin"])
+	}
+	if changes["organic"].From != nil || changes["organic"].To != true {
+		t.Errorf("expected organic to be set, got %v", changes["organic"])
+	}
+	if _, changed := changes["age"]; changed {
+		t.Error("expected unchanged age to be left out")
+	}
+}
+
+func TestDiffFieldValues_CreateAndDelete(t *testing.T) {
+	state := map[string]interface{}{"name": "Brie", "type": "Soft"}
+
+	if changes := diffFieldValues(nil, state); len(changes) != 2 || changes["name"].To != "Brie" {
+		t.Errorf("unexpected create diff: %v", changes)
+	}
+	if changes := diffFieldValues(state, nil); len(changes) != 2 || changes["name"].From != "Brie" {
+		t.Errorf("unexpected delete diff: %v", changes)
+	}
+	if changes := diffFieldValues(state, state); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
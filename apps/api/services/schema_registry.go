@@ -135,6 +135,19 @@ func (r *SchemaRegistry) GetActiveSchema(name string) (*CachedSchema, bool) {
 	return cached, true
 }
 
+// GetSchemaByID finds a cached schema from the schema ID stored on items
+func (r *SchemaRegistry) GetSchemaByID(id uint) (*CachedSchema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, schema := range r.schemas {
+		if schema.Schema.ID == id {
+			return schema, true
+		}
+	}
+	return nil, false
+}
+
 func (r *SchemaRegistry) GetAllSchemas() []*CachedSchema {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
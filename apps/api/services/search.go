@@ -0,0 +1,85 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+type SearchParams struct {
+	Query   string
+	Types   []string
+	Page    int
+	PerPage int
+}
+
+type SearchGroup struct {
+	Schema     *CachedSchema
+	Items      []map[string]interface{}
+	Total      int64
+	Page       int
+	PerPage    int
+	TotalPages int
+}
+
+type SearchResult struct {
+	Query  string
+	Total  int64
+	Groups []SearchGroup
+}
+
+// SearchAll runs the per-type list search against every active schema and groups
+// the hits by schema. Page and PerPage apply within each group, so a client can
+// page through a single type by restricting Types to it.
+func (qb *EAVQueryBuilder) SearchAll(params SearchParams) (*SearchResult, error) {
+	query := strings.TrimSpace(params.Query)
+	if query == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+
+	if params.PerPage < 1 {
+		params.PerPage = 5
+	}
+
+	wanted := make(map[string]bool, len(params.Types))
+	for _, t := range params.Types {
+		if t = strings.TrimSpace(t); t != "" {
+			wanted[t] = true
+		}
+	}
+
+	result := &SearchResult{Query: query, Groups: []SearchGroup{}}
+
+	for _, cached := range qb.registry.GetAllSchemas() {
+		if !cached.Schema.IsActive {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[cached.Schema.Name] {
+			continue
+		}
+
+		list, err := qb.BuildListQuery(QueryParams{
+			SchemaName: cached.Schema.Name,
+			Page:       params.Page,
+			PerPage:    params.PerPage,
+			Search:     query,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %w", cached.Schema.Name, err)
+		}
+		if list.Total == 0 {
+			continue
+		}
+
+		result.Total += list.Total
+		result.Groups = append(result.Groups, SearchGroup{
+			Schema:     cached,
+			Items:      list.Items,
+			Total:      list.Total,
+			Page:       list.Page,
+			PerPage:    list.PerPage,
+			TotalPages: list.TotalPages,
+		})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/davidcharbonnier/alacarte-api/utils"
+)
+
+const (
+	// SeedModeInsert skips seed items that match an existing item
+	SeedModeInsert = "insert"
+	// SeedModeUpsert updates matched items with the seed's field values
+	SeedModeUpsert = "upsert"
+)
+
+// SeedAction is what seeding does, or would do in a dry run, with one item
+type SeedAction string
+
+const (
+	SeedActionCreate  SeedAction = "create"
+	SeedActionUpdate  SeedAction = "update"
+	SeedActionSkip    SeedAction = "skip"
+	SeedActionInvalid SeedAction = "invalid"
+)
+
+// SeedPlanEntry describes the outcome for one seed item. Position is the item's
+// 1-based position in the seed data, or its line for file imports.
+type SeedPlanEntry struct {
+	Position int                    `json:"position"`
+	Action   SeedAction             `json:"action"`
+	Name     string                 `json:"name,omitempty"`
+	ItemID   uint                   `json:"item_id,omitempty"`
+	Changes  map[string]FieldChange `json:"changes,omitempty"`
+	Reason   string                 `json:"reason,omitempty"`
+	Errors   []string               `json:"errors,omitempty"`
+	// Image and Ratings tell whether an image was added and how many ratings
+	// were written
+	Image   bool `json:"image,omitempty"`
+	Ratings int  `json:"ratings,omitempty"`
+}
+
+// SeedOptions controls what SeedItems does with items that match an existing
+// item, and whether it writes anything at all
+type SeedOptions struct {
+	Mode   string `json:"mode"`
+	DryRun bool   `json:"dry_run"`
+	// ErrorPrefix, when set, starts each error with it and the item's position
+	ErrorPrefix string `json:"error_prefix,omitempty"`
+}
+
+// ParseSeedOptions reads the mode and dry_run request parameters
+func ParseSeedOptions(mode, dryRun string) (SeedOptions, error) {
+	opts := SeedOptions{Mode: SeedModeInsert, DryRun: dryRun == "true"}
+	switch mode {
+	case "", SeedModeInsert:
+	case SeedModeUpsert:
+		opts.Mode = SeedModeUpsert
+	default:
+		return opts, fmt.Errorf("invalid mode '%s'; use insert or upsert", mode)
+	}
+	return opts, nil
+}
+
+func (opts SeedOptions) errorf(position int, format string, args ...interface{}) string {
+	message := fmt.Sprintf(format, args...)
+	if opts.ErrorPrefix == "" {
+		return message
+	}
+	return fmt.Sprintf("%s %d: %s", opts.ErrorPrefix, position, message)
+}
+
+// SeedItem is an item to seed and its position, used in the plan and errors
+type SeedItem struct {
+	Position int                    `json:"position"`
+	Fields   map[string]interface{} `json:"fields"`
+	Image    *SeedImage             `json:"image,omitempty"`
+	Ratings  []SeedRating           `json:"ratings,omitempty"`
+}
+
+// seedRun carries the state of a SeedItems call across items
+type seedRun struct {
+	qb         *EAVQueryBuilder
+	validation *ValidationEngine
+	cached     *CachedSchema
+	userID     uint
+	opts       SeedOptions
+	result     *utils.SeedResult
+	seen       map[string]bool
+	// users caches user IDs by email, 0 for unknown emails
+	users map[string]uint
+}
+
+// SeedItems creates the given items for userID. Items matching an existing item
+// on the schema's unique fields are skipped, or updated in upsert mode, as are
+// repeats of an earlier item. In a dry run nothing is written and the plan tells
+// what would happen.
+//
+// A run can resume part way: items before start were already processed, and
+// counts and errors are added to result, which holds the totals so far. progress,
+// when set, is called after each item with the number of items done and can stop
+// the run by returning an error, which SeedItems returns.
+func (qb *EAVQueryBuilder) SeedItems(schemaName string, userID uint, items []SeedItem, start int, opts SeedOptions, result *utils.SeedResult, progress func(done int, entry SeedPlanEntry) error) error {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return err
+	}
+	if result.Errors == nil {
+		result.Errors = []string{}
+	}
+
+	run := &seedRun{
+		qb:         qb,
+		validation: NewValidationEngine(qb.registry),
+		cached:     cached,
+		userID:     userID,
+		opts:       opts,
+		result:     result,
+		seen:       make(map[string]bool),
+		users:      make(map[string]uint),
+	}
+
+	if start > len(items) {
+		start = len(items)
+	}
+
+	// Items already processed still count when spotting repeats
+	for _, item := range items[:start] {
+		if key, _ := SeedUniqueKey(cached, item.Fields); key != "" {
+			run.seen[key] = true
+		}
+	}
+
+	for i := start; i < len(items); i++ {
+		entry := run.seed(items[i])
+		if progress != nil {
+			if err := progress(i+1, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SeedUniqueKey identifies a seed item by its unique field values, or returns ""
+// when it has none. fmt prints maps with sorted keys, which makes it stable.
+func SeedUniqueKey(cached *CachedSchema, fields map[string]interface{}) (string, map[string]interface{}) {
+	filters := make(map[string]interface{})
+	for _, key := range cached.UniqueFields {
+		if val, exists := fields[key]; exists {
+			filters[key] = val
+		}
+	}
+	if len(filters) == 0 {
+		return "", nil
+	}
+	return fmt.Sprint(filters), filters
+}
+
+func (run *seedRun) seed(item SeedItem) SeedPlanEntry {
+	entry := SeedPlanEntry{Position: item.Position}
+	if name, ok := item.Fields["name"].(string); ok {
+		entry.Name = name
+	}
+
+	var existingID uint
+	if key, filters := SeedUniqueKey(run.cached, item.Fields); key != "" {
+		if run.seen[key] {
+			entry.Action = SeedActionSkip
+			entry.Reason = "repeats an earlier item"
+			run.result.Skipped++
+			return entry
+		}
+		run.seen[key] = true
+
+		existingItems, err := run.qb.BuildListQuery(QueryParams{
+			SchemaName: run.cached.Schema.Name,
+			Filters:    filters,
+		})
+		if err != nil {
+			run.fail(&entry, run.opts.errorf(entry.Position, "Failed to check duplicates: %v", err), err.Error())
+			return entry
+		}
+		if existingItems.Total > 0 {
+			existingID, _ = existingItems.Items[0]["id"].(uint)
+			if run.opts.Mode != SeedModeUpsert || existingItems.Total > 1 {
+				entry.Action = SeedActionSkip
+				entry.ItemID = existingID
+				entry.Reason = "matches an existing item"
+				if existingItems.Total > 1 {
+					entry.ItemID = 0
+					entry.Reason = fmt.Sprintf("matches %d existing items", existingItems.Total)
+				}
+				run.result.Skipped++
+				return entry
+			}
+		}
+	}
+
+	extras, problems := run.prepareExtras(item)
+	if len(problems) > 0 {
+		run.fail(&entry, run.opts.errorf(entry.Position, "Invalid image or ratings: %s", strings.Join(problems, "; ")), problems...)
+		return entry
+	}
+
+	if existingID != 0 {
+		run.update(&entry, item.Fields, existingID, extras)
+	} else {
+		run.create(&entry, item.Fields, extras)
+	}
+	return entry
+}
+
+func (run *seedRun) create(entry *SeedPlanEntry, fields map[string]interface{}, extras *seedExtras) {
+	validationResult := run.validation.ValidateCreate(run.cached.Schema.Name, fields)
+	if !validationResult.Valid {
+		messages := ValidationMessages(validationResult.Errors)
+		run.fail(entry, run.opts.errorf(entry.Position, "Validation failed: %s", strings.Join(messages, "; ")), messages...)
+		return
+	}
+
+	entry.Action = SeedActionCreate
+	if run.opts.DryRun {
+		run.applyExtras(entry, 0, extras)
+		run.result.Added++
+		return
+	}
+
+	item, err := run.qb.CreateItem(run.cached.Schema.Name, run.userID, fields)
+	if err != nil {
+		nameVal := "unknown"
+		if entry.Name != "" {
+			nameVal = entry.Name
+		}
+		run.fail(entry, run.opts.errorf(entry.Position, "Failed to create %s: %v", nameVal, err), err.Error())
+		return
+	}
+	entry.ItemID = item.ID
+	run.applyExtras(entry, item.ID, extras)
+	run.result.Added++
+}
+
+// update applies the seed's differing field values to a matched item. The item's
+// resulting state is validated as a whole, like a new item. The item's image is
+// only set when it has none, and ratings only written when they differ.
+func (run *seedRun) update(entry *SeedPlanEntry, fields map[string]interface{}, itemID uint, extras *seedExtras) {
+	entry.ItemID = itemID
+	schemaName := run.cached.Schema.Name
+
+	changes, state, version, err := run.qb.SeedChanges(schemaName, itemID, fields)
+	if err != nil {
+		run.fail(entry, run.opts.errorf(entry.Position, "Failed to update item %d: %v", itemID, err), err.Error())
+		return
+	}
+	pending, err := run.pendingExtras(itemID, extras)
+	if err != nil {
+		run.fail(entry, run.opts.errorf(entry.Position, "Failed to update item %d: %v", itemID, err), err.Error())
+		return
+	}
+	if len(changes) == 0 {
+		if pending.empty() {
+			entry.Action = SeedActionSkip
+			entry.Reason = "already up to date"
+			run.result.Skipped++
+			return
+		}
+		entry.Action = SeedActionUpdate
+		run.applyExtras(entry, itemID, pending)
+		run.result.Updated++
+		return
+	}
+
+	validationResult := run.validation.ValidateCreate(schemaName, state)
+	if !validationResult.Valid {
+		messages := ValidationMessages(validationResult.Errors)
+		run.fail(entry, run.opts.errorf(entry.Position, "Validation failed: %s", strings.Join(messages, "; ")), messages...)
+		return
+	}
+
+	entry.Action = SeedActionUpdate
+	entry.Changes = changes
+	if run.opts.DryRun {
+		run.applyExtras(entry, itemID, pending)
+		run.result.Updated++
+		return
+	}
+
+	updates := make(map[string]interface{}, len(changes))
+	for key, change := range changes {
+		updates[key] = change.To
+	}
+	if _, err := run.qb.UpdateItemWithOptions(schemaName, itemID, run.userID, updates, UpdateOptions{
+		IsAdmin:         true,
+		ExpectedVersion: &version,
+	}); err != nil {
+		run.fail(entry, run.opts.errorf(entry.Position, "Failed to update item %d: %v", itemID, err), err.Error())
+		return
+	}
+	run.applyExtras(entry, itemID, pending)
+	run.result.Updated++
+}
+
+func (run *seedRun) fail(entry *SeedPlanEntry, message string, details ...string) {
+	run.result.Errors = append(run.result.Errors, message)
+	entry.Action = SeedActionInvalid
+	entry.Errors = details
+}
+
+// ValidationMessages returns the messages of validation errors
+func ValidationMessages(errors []ValidationError) []string {
+	messages := make([]string, len(errors))
+	for i, err := range errors {
+		messages[i] = err.Message
+	}
+	return messages
+}
+
+// SeedChanges compares seed field values with an item's current values. Only the
+// fields present in the seed are compared, so fields it leaves out are kept; a
+// null value clears the field. It returns the changed fields, the state the item
+// would have once they are applied, and the version they were compared against.
+func (qb *EAVQueryBuilder) SeedChanges(schemaName string, itemID uint, fields map[string]interface{}) (map[string]FieldChange, map[string]interface{}, uint, error) {
+	current, version, err := qb.GetItemFieldValues(schemaName, itemID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	changes := make(map[string]FieldChange)
+	state := make(map[string]interface{}, len(current))
+	for key, value := range current {
+		state[key] = value
+	}
+
+	for key, value := range fields {
+		if _, found := qb.registry.GetFieldByKey(schemaName, key); !found {
+			return nil, nil, 0, fmt.Errorf("unknown field '%s'", key)
+		}
+		existing, exists := current[key]
+		if value == nil {
+			if exists {
+				changes[key] = FieldChange{From: existing, To: nil}
+				delete(state, key)
+			}
+			continue
+		}
+		if exists && seedValueEqual(existing, value) {
+			continue
+		}
+		changes[key] = FieldChange{From: existing, To: value}
+		state[key] = value
+	}
+
+	return changes, state, version, nil
+}
+
+// seedValueEqual compares a stored value with a seed value, which may spell a
+// number or boolean as a string
+func seedValueEqual(existing, value interface{}) bool {
+	value = normalizeSuggestedValue(value)
+	return reflect.DeepEqual(existing, value) || fmt.Sprintf("%v", existing) == fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,417 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// seedImageKey and seedRatingsKey hold an item's image and ratings in seed
+	// data, next to its field values
+	seedImageKey   = "_image"
+	seedRatingsKey = "_ratings"
+)
+
+// SeedImage is an image for a seeded item: a URL, a file in the seed directory,
+// or base64 data, optionally as a data URI
+type SeedImage struct {
+	URL      string `json:"url,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// SeedRating is a rating of a seeded item by an existing user, shared with the
+// users listed by email. Without a grade, the overall is computed from the
+// scores on the schema's rating criteria.
+type SeedRating struct {
+	User       string             `json:"user"`
+	Grade      *float32           `json:"grade"`
+	Scores     map[string]float64 `json:"scores,omitempty"`
+	Note       string             `json:"note,omitempty"`
+	SharedWith []string           `json:"shared_with,omitempty"`
+}
+
+// NewSeedItem reads an item of seed data: its field values, and the image and
+// ratings under the _image and _ratings keys. An image given as a string is a
+// URL.
+func NewSeedItem(position int, data map[string]interface{}) (SeedItem, error) {
+	item := SeedItem{Position: position, Fields: make(map[string]interface{}, len(data))}
+	for key, value := range data {
+		switch key {
+		case seedImageKey:
+			if source, ok := value.(string); ok {
+				item.Image = &SeedImage{URL: source}
+			} else if err := decodeSeedValue(value, &item.Image); err != nil {
+				return item, fmt.Errorf("invalid %s: %v", key, err)
+			}
+		case seedRatingsKey:
+			if err := decodeSeedValue(value, &item.Ratings); err != nil {
+				return item, fmt.Errorf("invalid %s: %v", key, err)
+			}
+		default:
+			item.Fields[key] = value
+		}
+	}
+
+	if item.Image != nil && (item.Image.URL == "") == (item.Image.Data == "") {
+		return item, fmt.Errorf("invalid %s: set either url or data", seedImageKey)
+	}
+	for i, rating := range item.Ratings {
+		if strings.TrimSpace(rating.User) == "" {
+			return item, fmt.Errorf("invalid %s: rating %d has no user", seedRatingsKey, i+1)
+		}
+		if rating.Grade == nil && len(rating.Scores) == 0 {
+			return item, fmt.Errorf("invalid %s: rating %d has no grade", seedRatingsKey, i+1)
+		}
+	}
+	return item, nil
+}
+
+// decodeSeedValue converts a decoded JSON value into target, refusing unknown keys
+func decodeSeedValue(value interface{}, target interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+// seedExtras is an item's image and ratings, ready to be written
+type seedExtras struct {
+	image   *utils.ProcessedImage
+	ratings []seedRatingWrite
+}
+
+type seedRatingWrite struct {
+	userID  uint
+	email   string
+	grade   float32
+	scores  map[string]float64
+	note    string
+	viewers []uint
+}
+
+func (extras *seedExtras) empty() bool {
+	return extras == nil || (extras.image == nil && len(extras.ratings) == 0)
+}
+
+// prepareExtras loads the item's image and looks up its raters and viewers, so
+// an item whose image or users are wrong can be refused before it is written
+func (run *seedRun) prepareExtras(item SeedItem) (*seedExtras, []string) {
+	if item.Image == nil && len(item.Ratings) == 0 {
+		return nil, nil
+	}
+
+	extras := &seedExtras{}
+	var problems []string
+	if item.Image != nil {
+		image, err := loadSeedImage(item.Image)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("image: %v", err))
+		}
+		extras.image = image
+	}
+
+	raters := make(map[uint]bool)
+	for _, rating := range item.Ratings {
+		userID, err := run.lookupUser(rating.User)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if raters[userID] {
+			problems = append(problems, fmt.Sprintf("user '%s' rates the item twice", rating.User))
+			continue
+		}
+		raters[userID] = true
+
+		var grade *float64
+		if rating.Grade != nil {
+			value := float64(*rating.Grade)
+			grade = &value
+		}
+		if result := run.validation.ValidateRating(run.cached.Schema.Name, grade, rating.Scores); !result.Valid {
+			for _, validationErr := range result.Errors {
+				problems = append(problems, fmt.Sprintf("rating by '%s': %s", rating.User, validationErr.Message))
+			}
+			continue
+		}
+		if grade == nil {
+			overall, _ := OverallGrade(run.cached, rating.Scores)
+			grade = &overall
+		}
+
+		write := seedRatingWrite{userID: userID, email: rating.User, grade: float32(*grade), scores: rating.Scores, note: rating.Note}
+		for _, email := range rating.SharedWith {
+			viewerID, err := run.lookupUser(email)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			// Authors see their own ratings without being listed
+			if viewerID != userID {
+				write.viewers = append(write.viewers, viewerID)
+			}
+		}
+		extras.ratings = append(extras.ratings, write)
+	}
+	return extras, problems
+}
+
+// lookupUser returns the ID of the user with an email, caching it for the run
+func (run *seedRun) lookupUser(email string) (uint, error) {
+	key := strings.ToLower(strings.TrimSpace(email))
+	if id, ok := run.users[key]; ok {
+		if id == 0 {
+			return 0, fmt.Errorf("unknown user '%s'", email)
+		}
+		return id, nil
+	}
+
+	var user models.User
+	err := utils.DB.Select("id").Where("LOWER(email) = ?", key).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		run.users[key] = 0
+		return 0, fmt.Errorf("unknown user '%s'", email)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up user '%s': %v", email, err)
+	}
+	run.users[key] = user.ID
+	return user.ID, nil
+}
+
+// loadSeedImage fetches or decodes a seed image and processes it like an upload
+func loadSeedImage(image *SeedImage) (*utils.ProcessedImage, error) {
+	var data []byte
+	filename := image.Filename
+	if image.Data != "" {
+		encoded := image.Data
+		// A data URI carries its media type before the payload
+		if strings.HasPrefix(encoded, "data:") {
+			comma := strings.Index(encoded, ",")
+			if comma < 0 || !strings.HasSuffix(encoded[:comma], ";base64") {
+				return nil, fmt.Errorf("data URI must be base64 encoded")
+			}
+			encoded = encoded[comma+1:]
+		}
+		if base64.StdEncoding.DecodedLen(len(encoded)) > utils.MaxImageSize {
+			return nil, fmt.Errorf("file too large (max: %d bytes)", utils.MaxImageSize)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 data: %v", err)
+		}
+		data = decoded
+	} else {
+		fetched, err := utils.FetchImageData(image.URL)
+		if err != nil {
+			return nil, err
+		}
+		data = fetched
+		if filename == "" {
+			if parsed, err := url.Parse(image.URL); err == nil {
+				filename = path.Base(parsed.Path)
+			}
+		}
+	}
+
+	// Images named without an extension are named after their content
+	if filepath.Ext(filename) == "" {
+		switch http.DetectContentType(data) {
+		case "image/jpeg":
+			filename += ".jpg"
+		case "image/png":
+			filename += ".png"
+		case "image/webp":
+			filename += ".webp"
+		}
+	}
+	return utils.ValidateAndProcessImageData(data, filename)
+}
+
+// pendingExtras narrows extras to what would change on an existing item: the
+// image only when the item has none, and ratings that are new or differ
+func (run *seedRun) pendingExtras(itemID uint, extras *seedExtras) (*seedExtras, error) {
+	if extras.empty() {
+		return nil, nil
+	}
+
+	pending := &seedExtras{}
+	if extras.image != nil {
+		item, err := utils.GetDynamicItem(run.cached.Schema.Name, itemID)
+		if err != nil {
+			return nil, err
+		}
+		if imageURL := item.GetImageURL(); imageURL == nil || *imageURL == "" {
+			pending.image = extras.image
+		}
+	}
+
+	for _, write := range extras.ratings {
+		var rating models.Rating
+		err := utils.DB.Preload("Viewers").Preload("Scores").Where("user_id = ? AND item_id = ?", write.userID, itemID).First(&rating).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			pending.ratings = append(pending.ratings, write)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rating.Grade != write.grade || rating.Note != write.note || !sameUserIDs(rating.Viewers, write.viewers) || !sameScores(rating.Scores, write.scores) {
+			pending.ratings = append(pending.ratings, write)
+		}
+	}
+	return pending, nil
+}
+
+func sameUserIDs(users []models.User, ids []uint) bool {
+	current := make([]uint, len(users))
+	for i, user := range users {
+		current[i] = user.ID
+	}
+	wanted := append([]uint(nil), ids...)
+	sort.Slice(current, func(i, j int) bool { return current[i] < current[j] })
+	sort.Slice(wanted, func(i, j int) bool { return wanted[i] < wanted[j] })
+	if len(current) != len(wanted) {
+		return false
+	}
+	for i := range current {
+		if current[i] != wanted[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameScores(rows []models.RatingScore, scores map[string]float64) bool {
+	if len(rows) != len(scores) {
+		return false
+	}
+	for _, row := range rows {
+		score, ok := scores[row.CriterionKey]
+		if !ok || row.Score != float32(score) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyExtras writes an item's image and ratings, or in a dry run only records
+// them in the plan. The item is kept when they fail; the failure is reported
+// with the item.
+func (run *seedRun) applyExtras(entry *SeedPlanEntry, itemID uint, extras *seedExtras) {
+	if extras.empty() {
+		return
+	}
+	if run.opts.DryRun {
+		entry.Image = extras.image != nil
+		entry.Ratings = len(extras.ratings)
+		return
+	}
+
+	if extras.image != nil {
+		if err := run.attachImage(itemID, extras.image); err != nil {
+			run.extraError(entry, run.opts.errorf(entry.Position, "Failed to add image to item %d: %v", itemID, err), err.Error())
+		} else {
+			entry.Image = true
+		}
+	}
+	for _, write := range extras.ratings {
+		if err := writeSeedRating(itemID, write); err != nil {
+			run.extraError(entry, run.opts.errorf(entry.Position, "Failed to add rating by %s to item %d: %v", write.email, itemID, err), err.Error())
+			continue
+		}
+		entry.Ratings++
+	}
+}
+
+func (run *seedRun) extraError(entry *SeedPlanEntry, message string, detail string) {
+	run.result.Errors = append(run.result.Errors, message)
+	entry.Errors = append(entry.Errors, detail)
+}
+
+// attachImage uploads a processed image and sets it as the item's image
+func (run *seedRun) attachImage(itemID uint, image *utils.ProcessedImage) error {
+	schemaName := run.cached.Schema.Name
+	item, err := utils.GetDynamicItem(schemaName, itemID)
+	if err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("%s_%s%s", schemaName, uuid.New().String(), image.Extension)
+	imageURL, err := utils.UploadToStorage(bytes.NewReader(image.Data.Bytes()), filename, image.ContentType)
+	if err != nil {
+		return err
+	}
+
+	item.SetImageURL(&imageURL)
+	if err := utils.SaveItem(item); err != nil {
+		utils.DeleteFromStorage(filename)
+		return err
+	}
+	return nil
+}
+
+// writeSeedRating creates or replaces a user's rating of an item, and shares it
+// with exactly the listed viewers
+func writeSeedRating(itemID uint, write seedRatingWrite) error {
+	return utils.DB.Transaction(func(tx *gorm.DB) error {
+		var rating models.Rating
+		err := tx.Where("user_id = ? AND item_id = ?", write.userID, itemID).First(&rating).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			rating = models.Rating{UserID: int(write.userID), ItemID: int(itemID)}
+		} else if err != nil {
+			return err
+		}
+
+		rating.Grade = write.grade
+		rating.Note = write.note
+		if err := tx.Save(&rating).Error; err != nil {
+			return err
+		}
+		if err := SaveRatingScores(tx, rating.ID, write.scores); err != nil {
+			return err
+		}
+
+		if len(write.viewers) == 0 {
+			return tx.Model(&rating).Association("Viewers").Clear()
+		}
+		var viewers []models.User
+		if err := tx.Where("id IN ?", write.viewers).Find(&viewers).Error; err != nil {
+			return err
+		}
+		return tx.Model(&rating).Association("Viewers").Replace(&viewers)
+	})
+}
+
+// SeedData writes an item back in the seed data format read by NewSeedItem
+func (item SeedItem) SeedData() map[string]interface{} {
+	data := make(map[string]interface{}, len(item.Fields)+2)
+	for key, value := range item.Fields {
+		data[key] = value
+	}
+	if item.Image != nil {
+		data[seedImageKey] = item.Image
+	}
+	if len(item.Ratings) > 0 {
+		data[seedRatingsKey] = item.Ratings
+	}
+	return data
+}
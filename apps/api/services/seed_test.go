@@ -0,0 +1,119 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestSeedValueEqual(t *testing.T) {
+	tests := []struct {
+		existing, value interface{}
+		expected        bool
+	}{
+		{"Comté", "Comté", true},
+		{"Comté", "Comte", false},
+		{18.0, 18.0, true},
+		{18.0, json.Number("18"), true},
+		{18.0, "18", true},
+		{18.5, 18.0, false},
+		{true, true, true},
+		{true, "true", true},
+		{false, true, false},
+	}
+	for _, tt := range tests {
+		if got := seedValueEqual(tt.existing, tt.value); got != tt.expected {
+			t.Errorf("seedValueEqual(%#v, %#v) = %v, expected %v", tt.existing, tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestNewSeedItem(t *testing.T) {
+	item, err := NewSeedItem(3, map[string]interface{}{
+		"name":   "Comté",
+		"_image": "https://example.com/comte.jpg",
+		"_ratings": []interface{}{
+			map[string]interface{}{"user": "alice@example.com", "grade": 4.5, "note": "Nutty", "shared_with": []interface{}{"bob@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.Position != 3 || len(item.Fields) != 1 || item.Fields["name"] != "Comté" {
+		t.Errorf("expected only field values in fields, got %+v", item)
+	}
+	if item.Image == nil || item.Image.URL != "https://example.com/comte.jpg" {
+		t.Errorf("expected a string image to be a URL, got %+v", item.Image)
+	}
+	if len(item.Ratings) != 1 || *item.Ratings[0].Grade != 4.5 || item.Ratings[0].SharedWith[0] != "bob@example.com" {
+		t.Errorf("unexpected ratings %+v", item.Ratings)
+	}
+
+	item, err = NewSeedItem(1, map[string]interface{}{
+		"name":   "Brie",
+		"_image": map[string]interface{}{"data": "aGVsbG8=", "filename": "brie.png"},
+	})
+	if err != nil || item.Image.Data != "aGVsbG8=" || item.Image.Filename != "brie.png" {
+		t.Errorf("unexpected image %+v, %v", item.Image, err)
+	}
+
+	tests := []struct {
+		data     map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"_image": map[string]interface{}{}}, "set either url or data"},
+		{map[string]interface{}{"_image": map[string]interface{}{"url": "a", "data": "b"}}, "set either url or data"},
+		{map[string]interface{}{"_image": map[string]interface{}{"link": "a"}}, "unknown field"},
+		{map[string]interface{}{"_ratings": "alice"}, "invalid _ratings"},
+		{map[string]interface{}{"_ratings": []interface{}{map[string]interface{}{"grade": 4}}}, "rating 1 has no user"},
+		{map[string]interface{}{"_ratings": []interface{}{map[string]interface{}{"user": "alice@example.com"}}}, "rating 1 has no grade"},
+	}
+	for _, tt := range tests {
+		if _, err := NewSeedItem(1, tt.data); err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%v: expected error containing %q, got %v", tt.data, tt.expected, err)
+		}
+	}
+}
+
+func TestLoadSeedImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 120, 120))
+	for x := 0; x < 120; x++ {
+		for y := 0; y < 120; y++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 180, B: 60, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	// Without a filename, the extension comes from the content
+	for _, data := range []string{encoded, "data:image/png;base64," + encoded} {
+		processed, err := loadSeedImage(&SeedImage{Data: data})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if processed.ContentType != "image/jpeg" || processed.Data.Len() == 0 {
+			t.Errorf("expected a processed JPEG, got %s", processed.ContentType)
+		}
+	}
+
+	tests := []struct {
+		image    SeedImage
+		expected string
+	}{
+		{SeedImage{Data: "not base64!"}, "invalid base64 data"},
+		{SeedImage{Data: "data:image/png," + encoded}, "must be base64 encoded"},
+		{SeedImage{Data: encoded, Filename: "comte.gif"}, "unsupported file extension"},
+		{SeedImage{Data: base64.StdEncoding.EncodeToString([]byte("hello"))}, "unsupported file extension"},
+	}
+	for _, tt := range tests {
+		if _, err := loadSeedImage(&tt.image); err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q, got %v", tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"gorm.io/gorm"
+)
+
+type sortKind int
+
+const (
+	sortKindString sortKind = iota
+	sortKindNumber
+	sortKindTime
+	sortKindID
+)
+
+type sortTerm struct {
+	Expr     string
+	Desc     bool
+	Kind     sortKind
+	Nullable bool
+}
+
+type sortJoin struct {
+	SQL  string
+	Args []interface{}
+}
+
+// sortPlan is the resolved form of a sort spec: the ORDER BY terms, ending with the
+// item ID as a tie-breaker so the order is total, and the joins they need. The same
+// terms drive keyset conditions for cursor pagination.
+type sortPlan struct {
+	Spec  string
+	Terms []sortTerm
+	Joins []sortJoin
+
+	named map[string]bool
+}
+
+// maxSortKeys bounds how many keys a single sort spec may combine
+const maxSortKeys = 4
+
+// buildSortPlan resolves a comma separated sort spec such as "-avg_rating,name".
+// Each key is a built-in column, a computed rating key or an EAV field key, with
+// a leading "-" for descending order. Unknown keys, and personal keys when there
+// is no viewer, are ignored; if nothing is left the list is sorted by name.
+func (qb *EAVQueryBuilder) buildSortPlan(cached *CachedSchema, spec string, viewerID uint) *sortPlan {
+	plan := &sortPlan{Spec: spec, named: map[string]bool{}}
+	used := map[string]bool{}
+
+	for _, part := range strings.Split(spec, ",") {
+		key := strings.TrimSpace(part)
+		desc := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+		if key == "" || used[key] || len(used) >= maxSortKeys {
+			continue
+		}
+
+		switch key {
+		case "id":
+			// The ID is always the final tie-breaker
+			continue
+		case "name":
+			plan.Terms = append(plan.Terms, sortTerm{Expr: "items.name", Desc: desc})
+		case "created_at", "updated_at":
+			plan.Terms = append(plan.Terms, sortTerm{Expr: "items." + key, Desc: desc, Kind: sortKindTime})
+		case "avg_rating":
+			plan.addRatingStatsJoin()
+			plan.Terms = append(plan.Terms, sortTerm{Expr: "CAST(rating_stats.avg_grade AS DECIMAL(20,6))", Desc: desc, Kind: sortKindNumber, Nullable: true})
+		case "rating_count":
+			plan.addRatingStatsJoin()
+			plan.Terms = append(plan.Terms, sortTerm{Expr: "COALESCE(rating_stats.rating_count, 0)", Desc: desc, Kind: sortKindNumber})
+		case "my_grade", "my_rated_at":
+			if viewerID == 0 {
+				continue
+			}
+			plan.addMyRatingJoin(viewerID)
+			if key == "my_grade" {
+				plan.Terms = append(plan.Terms, sortTerm{Expr: "CAST(my_rating.grade AS DECIMAL(20,6))", Desc: desc, Kind: sortKindNumber, Nullable: true})
+			} else {
+				plan.Terms = append(plan.Terms, sortTerm{Expr: "my_rating.updated_at", Desc: desc, Kind: sortKindTime, Nullable: true})
+			}
+		default:
+			field, found := qb.registry.GetFieldByKey(cached.Schema.Name, key)
+			if !found {
+				continue
+			}
+			plan.addFieldTerm(field, desc)
+		}
+		used[key] = true
+	}
+
+	if len(plan.Terms) == 0 {
+		plan.Terms = append(plan.Terms, sortTerm{Expr: "items.name"})
+	}
+
+	// The tie-breaker follows the primary direction so "-created_at" lists the
+	// newest of simultaneous items first
+	plan.Terms = append(plan.Terms, sortTerm{Expr: "items.id", Desc: plan.Terms[0].Desc, Kind: sortKindID})
+	return plan
+}
+
+func (p *sortPlan) addFieldTerm(field *models.ItemTypeField, desc bool) {
+	alias := fmt.Sprintf("sort_%d", len(p.Joins))
+	p.Joins = append(p.Joins, sortJoin{
+		SQL:  fmt.Sprintf("LEFT JOIN item_field_values %[1]s ON %[1]s.item_id = items.id AND %[1]s.field_id = ? AND %[1]s.deleted_at IS NULL", alias),
+		Args: []interface{}{field.ID},
+	})
+
+	term := sortTerm{Expr: alias + ".value", Desc: desc, Nullable: true}
+	if field.FieldType == models.FieldTypeNumber {
+		term.Expr = fmt.Sprintf("CAST(%s.value AS DECIMAL(20,6))", alias)
+		term.Kind = sortKindNumber
+	}
+	p.Terms = append(p.Terms, term)
+}
+
+// addRatingStatsJoin joins the community average grade and rating count per item
+func (p *sortPlan) addRatingStatsJoin() {
+	if p.named["rating_stats"] {
+		return
+	}
+	p.named["rating_stats"] = true
+	p.Joins = append(p.Joins, sortJoin{
+		SQL: "LEFT JOIN (SELECT item_id, AVG(grade) AS avg_grade, COUNT(*) AS rating_count FROM ratings WHERE deleted_at IS NULL GROUP BY item_id) rating_stats ON rating_stats.item_id = items.id",
+	})
+}
+
+// addMyRatingJoin joins the viewer's own rating of each item
+func (p *sortPlan) addMyRatingJoin(viewerID uint) {
+	if p.named["my_rating"] {
+		return
+	}
+	p.named["my_rating"] = true
+	p.Joins = append(p.Joins, sortJoin{
+		SQL:  "LEFT JOIN ratings my_rating ON my_rating.item_id = items.id AND my_rating.user_id = ? AND my_rating.deleted_at IS NULL",
+		Args: []interface{}{viewerID},
+	})
+}
+
+func (p *sortPlan) applyJoins(query *gorm.DB) *gorm.DB {
+	for _, join := range p.Joins {
+		query = query.Joins(join.SQL, join.Args...)
+	}
+	return query
+}
+
+func (p *sortPlan) applyOrder(query *gorm.DB) *gorm.DB {
+	for _, term := range p.Terms {
+		dir := "ASC"
+		if term.Desc {
+			dir = "DESC"
+		}
+		query = query.Order(term.Expr + " " + dir)
+	}
+	return query
+}
+
+// keysetCondition returns a WHERE clause selecting the rows strictly after the row
+// whose sort values are given. MySQL sorts NULLs first ascending and last
+// descending, which the per-term comparisons account for.
+func (p *sortPlan) keysetCondition(raw []interface{}) (string, []interface{}, error) {
+	if len(raw) != len(p.Terms) {
+		return "", nil, fmt.Errorf("invalid cursor")
+	}
+
+	values := make([]interface{}, len(raw))
+	for i, term := range p.Terms {
+		value, err := term.decodeCursorValue(raw[i])
+		if err != nil {
+			return "", nil, err
+		}
+		values[i] = value
+	}
+
+	var clauses []string
+	var args []interface{}
+	for i, term := range p.Terms {
+		var parts []string
+		var partArgs []interface{}
+
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				parts = append(parts, p.Terms[j].Expr+" IS NULL")
+			} else {
+				parts = append(parts, p.Terms[j].Expr+" = ?")
+				partArgs = append(partArgs, values[j])
+			}
+		}
+
+		switch {
+		case values[i] == nil && !term.Desc:
+			parts = append(parts, term.Expr+" IS NOT NULL")
+		case values[i] == nil && term.Desc:
+			// Nothing sorts after NULL in descending order
+			continue
+		case term.Desc && term.Nullable:
+			parts = append(parts, fmt.Sprintf("(%[1]s < ? OR %[1]s IS NULL)", term.Expr))
+			partArgs = append(partArgs, values[i])
+		case term.Desc:
+			parts = append(parts, term.Expr+" < ?")
+			partArgs = append(partArgs, values[i])
+		default:
+			parts = append(parts, term.Expr+" > ?")
+			partArgs = append(partArgs, values[i])
+		}
+
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+		args = append(args, partArgs...)
+	}
+
+	if len(clauses) == 0 {
+		return "1 = 0", nil, nil
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args, nil
+}
+
+// cursorValues reads the sort values of a single item, for use in the next cursor
+func (p *sortPlan) cursorValues(tx *gorm.DB, itemID uint) ([]interface{}, error) {
+	exprs := make([]string, len(p.Terms))
+	for i, term := range p.Terms {
+		exprs[i] = term.Expr
+	}
+
+	query := p.applyJoins(tx.Table("items").Select(strings.Join(exprs, ", ")))
+	row := query.Where("items.id = ?", itemID).Row()
+
+	scanned := make([]interface{}, len(p.Terms))
+	targets := make([]interface{}, len(p.Terms))
+	for i := range scanned {
+		targets[i] = &scanned[i]
+	}
+	if err := row.Scan(targets...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("item not found")
+		}
+		return nil, err
+	}
+
+	values := make([]interface{}, len(p.Terms))
+	for i, term := range p.Terms {
+		values[i] = term.encodeCursorValue(scanned[i])
+	}
+	return values, nil
+}
+
+func (t sortTerm) encodeCursorValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if value == nil {
+		return nil
+	}
+
+	switch t.Kind {
+	case sortKindNumber:
+		if s, ok := value.(string); ok {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f
+			}
+		}
+	case sortKindTime:
+		if ts, ok := value.(time.Time); ok {
+			return ts.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return value
+}
+
+func (t sortTerm) decodeCursorValue(value interface{}) (interface{}, error) {
+	if value == nil {
+		if !t.Nullable {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		return nil, nil
+	}
+
+	switch t.Kind {
+	case sortKindID:
+		return cursorID(value)
+	case sortKindNumber:
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		f, err := number.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		return f, nil
+	case sortKindTime:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		return ts, nil
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		return s, nil
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func sortPlanExprs(plan *sortPlan) []string {
+	exprs := make([]string, len(plan.Terms))
+	for i, term := range plan.Terms {
+		dir := " ASC"
+		if term.Desc {
+			dir = " DESC"
+		}
+		exprs[i] = term.Expr + dir
+	}
+	return exprs
+}
+
+func TestSortPlan_MultiKey(t *testing.T) {
+	qb := NewEAVQueryBuilder(createTestRegistry())
+	cached, _ := qb.registry.GetActiveSchema("cheese")
+
+	plan := qb.buildSortPlan(cached, "-avg_rating, name", 0)
+	got := strings.Join(sortPlanExprs(plan), ", ")
+	expected := "CAST(rating_stats.avg_grade AS DECIMAL(20,6)) DESC, items.name ASC, items.id DESC"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if len(plan.Joins) != 1 {
+		t.Errorf("expected 1 join, got %d", len(plan.Joins))
+	}
+
+	// Rating count shares the stats join
+	plan = qb.buildSortPlan(cached, "rating_count,-avg_rating", 0)
+	if len(plan.Joins) != 1 {
+		t.Errorf("expected rating keys to share one join, got %d", len(plan.Joins))
+	}
+
+	// Field keys get their own aliased joins
+	plan = qb.buildSortPlan(cached, "origin,-age", 0)
+	got = strings.Join(sortPlanExprs(plan), ", ")
+	expected = "sort_0.value ASC, CAST(sort_1.value AS DECIMAL(20,6)) DESC, items.id ASC"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestSortPlan_PersonalKeys(t *testing.T) {
+	qb := NewEAVQueryBuilder(createTestRegistry())
+	cached, _ := qb.registry.GetActiveSchema("cheese")
+
+	// Without a viewer, personal keys are dropped
+	plan := qb.buildSortPlan(cached, "-my_grade", 0)
+	got := strings.Join(sortPlanExprs(plan), ", ")
+	if got != "items.name ASC, items.id ASC" {
+		t.Errorf("expected fallback to name, got %q", got)
+	}
+
+	plan = qb.buildSortPlan(cached, "-my_grade,-my_rated_at", 7)
+	got = strings.Join(sortPlanExprs(plan), ", ")
+	expected := "CAST(my_rating.grade AS DECIMAL(20,6)) DESC, my_rating.updated_at DESC, items.id DESC"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if len(plan.Joins) != 1 || plan.Joins[0].Args[0] != uint(7) {
+		t.Errorf("expected a single join bound to the viewer, got %v", plan.Joins)
+	}
+}
+
+func TestSortPlan_IgnoresUnknownAndDuplicateKeys(t *testing.T) {
+	qb := NewEAVQueryBuilder(createTestRegistry())
+	cached, _ := qb.registry.GetActiveSchema("cheese")
+
+	plan := qb.buildSortPlan(cached, "bogus,-name,name,id,", 0)
+	got := strings.Join(sortPlanExprs(plan), ", ")
+	if got != "items.name DESC, items.id DESC" {
+		t.Errorf("unexpected plan: %q", got)
+	}
+
+	plan = qb.buildSortPlan(cached, "name,type,origin,age,style,color", 0)
+	if len(plan.Terms) != maxSortKeys+1 {
+		t.Errorf("expected %d terms, got %d", maxSortKeys+1, len(plan.Terms))
+	}
+}
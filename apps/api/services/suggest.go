@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+)
+
+const maxSuggestions = 20
+
+// ErrFieldNotSuggestible is returned for fields that did not opt into autocomplete
+var ErrFieldNotSuggestible = errors.New("field not suggestible")
+
+type FieldSuggestion struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// IsFieldSuggestible reports whether the field opted into autocomplete through its display config
+func IsFieldSuggestible(field *models.ItemTypeField) bool {
+	display, err := ParseFieldDisplay(field)
+	if err != nil {
+		return false
+	}
+	suggestible, _ := display["suggestible"].(bool)
+	return suggestible
+}
+
+// SuggestFieldValues returns the existing values of a field that start with prefix,
+// most used first. The match relies on the column collation, so it is
+// case-insensitive and served by the (field_id, value) prefix index.
+func (qb *EAVQueryBuilder) SuggestFieldValues(schemaName, fieldKey, prefix string, limit int) ([]FieldSuggestion, error) {
+	if _, err := qb.getCachedSchema(schemaName); err != nil {
+		return nil, err
+	}
+
+	field, found := qb.registry.GetFieldByKey(schemaName, fieldKey)
+	if !found {
+		return nil, fmt.Errorf("field '%s' not found", fieldKey)
+	}
+	if !IsFieldSuggestible(field) {
+		return nil, ErrFieldNotSuggestible
+	}
+
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > maxSuggestions {
+		limit = maxSuggestions
+	}
+
+	suggestions := []FieldSuggestion{}
+	err := utils.DB.Model(&models.ItemFieldValue{}).
+		Select("item_field_values.value AS value, COUNT(*) AS count").
+		Joins("JOIN items ON items.id = item_field_values.item_id AND items.deleted_at IS NULL").
+		Where("item_field_values.field_id = ? AND item_field_values.value LIKE ?", field.ID, escapeLike(strings.TrimSpace(prefix))+"%").
+		Where("item_field_values.value <> ''").
+		Group("item_field_values.value").
+		Order("count DESC, value ASC").
+		Limit(limit).
+		Scan(&suggestions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load suggestions: %w", err)
+	}
+
+	return suggestions, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,563 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+type SuggestionComment struct {
+	ID              uint      `json:"id"`
+	UserID          int       `json:"user_id"`
+	UserDisplayName string    `json:"user_display_name,omitempty"`
+	Body            string    `json:"body"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type SuggestionEntry struct {
+	ID              uint                    `json:"id"`
+	ItemID          uint                    `json:"item_id"`
+	ItemName        string                  `json:"item_name"`
+	SchemaType      string                  `json:"schema_type"`
+	UserID          int                     `json:"user_id"`
+	UserDisplayName string                  `json:"user_display_name,omitempty"`
+	Changes         map[string]FieldChange  `json:"changes"`
+	Message         string                  `json:"message,omitempty"`
+	BaseVersion     uint                    `json:"base_version"`
+	Status          models.SuggestionStatus `json:"status"`
+	ReviewerID      *int                    `json:"reviewer_id,omitempty"`
+	ReviewedAt      *time.Time              `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time               `json:"created_at"`
+	Comments        []SuggestionComment     `json:"comments,omitempty"`
+}
+
+// SuggestionParams selects suggestions. Each non-zero field narrows the list:
+// OwnerID keeps suggestions on items that user owns, which is their review queue,
+// and ViewerID keeps the ones that user made or owns the item of.
+type SuggestionParams struct {
+	SchemaName  string
+	ItemID      uint
+	SubmitterID uint
+	OwnerID     uint
+	ViewerID    uint
+	Status      models.SuggestionStatus
+	Page        int
+	PerPage     int
+}
+
+type SuggestionListResult struct {
+	Suggestions []SuggestionEntry
+	Total       int64
+	Page        int
+	PerPage     int
+	TotalPages  int
+}
+
+// SuggestionState returns the item's field values with changes applied, for
+// validation. A null change clears the field.
+func (qb *EAVQueryBuilder) SuggestionState(schemaName string, itemID uint, changes map[string]interface{}) (map[string]interface{}, error) {
+	current, _, err := qb.GetItemFieldValues(schemaName, itemID)
+	if err != nil {
+		return nil, err
+	}
+	return qb.applySuggestedChanges(schemaName, current, changes)
+}
+
+func (qb *EAVQueryBuilder) applySuggestedChanges(schemaName string, current map[string]interface{}, changes map[string]interface{}) (map[string]interface{}, error) {
+	for key, value := range changes {
+		if _, found := qb.registry.GetFieldByKey(schemaName, key); !found {
+			return nil, fmt.Errorf("unknown field '%s'", key)
+		}
+		if value == nil {
+			delete(current, key)
+		} else {
+			current[key] = value
+		}
+	}
+	return current, nil
+}
+
+// SubmitSuggestion records a proposed edit to an item. Changes that match the
+// current values are dropped; owners and editors are expected to edit directly.
+func (qb *EAVQueryBuilder) SubmitSuggestion(schemaName string, itemID uint, userID uint, changes map[string]interface{}, message string) (*SuggestionEntry, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.Item
+	if err := utils.DB.Where("id = ? AND schema_id = ?", itemID, cached.Schema.ID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("item not found")
+		}
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	canEdit, err := CanEdit(utils.DB, &item, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	if canEdit {
+		return nil, fmt.Errorf("you can edit this item directly")
+	}
+
+	current, err := loadFieldValuesMap(utils.DB, item.ID, cached.Fields)
+	if err != nil {
+		return nil, err
+	}
+	effective := make(map[string]interface{}, len(changes))
+	for key, value := range changes {
+		if _, found := qb.registry.GetFieldByKey(schemaName, key); !found {
+			return nil, fmt.Errorf("unknown field '%s'", key)
+		}
+		if existing, exists := current[key]; (value == nil && !exists) || (exists && reflect.DeepEqual(normalizeSuggestedValue(value), existing)) {
+			continue
+		}
+		effective[key] = value
+	}
+	if len(effective) == 0 {
+		return nil, fmt.Errorf("suggestion changes nothing")
+	}
+
+	changesJSON, err := json.Marshal(effective)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal changes: %w", err)
+	}
+	base := make(map[string]interface{}, len(effective))
+	for key := range effective {
+		base[key] = current[key]
+	}
+	baseJSON, err := json.Marshal(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal base values: %w", err)
+	}
+
+	suggestion := models.ItemSuggestion{
+		ItemID:      item.ID,
+		SchemaID:    cached.Schema.ID,
+		UserID:      int(userID),
+		Changes:     string(changesJSON),
+		Message:     strings.TrimSpace(message),
+		BaseVersion: item.Version,
+		BaseValues:  string(baseJSON),
+		Status:      models.SuggestionStatusPending,
+	}
+	if err := utils.DB.Create(&suggestion).Error; err != nil {
+		return nil, fmt.Errorf("failed to save suggestion: %w", err)
+	}
+
+	entries, err := qb.buildSuggestionEntries([]models.ItemSuggestion{suggestion})
+	if err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// normalizeSuggestedValue brings a JSON value to the type field values are read
+// back as, so unchanged values are recognised
+func normalizeSuggestedValue(value interface{}) interface{} {
+	if number, ok := value.(json.Number); ok {
+		if f, err := number.Float64(); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// ListSuggestions returns suggestions, newest first
+func (qb *EAVQueryBuilder) ListSuggestions(params SuggestionParams) (*SuggestionListResult, error) {
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	if params.PerPage < 1 {
+		params.PerPage = 20
+	}
+	if params.PerPage > 100 {
+		params.PerPage = 100
+	}
+
+	query := utils.DB.Model(&models.ItemSuggestion{}).
+		Joins("JOIN items ON items.id = item_suggestions.item_id AND items.deleted_at IS NULL")
+
+	if params.SchemaName != "" {
+		cached, err := qb.getCachedSchema(params.SchemaName)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("item_suggestions.schema_id = ?", cached.Schema.ID)
+	}
+	if params.ItemID != 0 {
+		query = query.Where("item_suggestions.item_id = ?", params.ItemID)
+	}
+	if params.SubmitterID != 0 {
+		query = query.Where("item_suggestions.user_id = ?", params.SubmitterID)
+	}
+	if params.OwnerID != 0 {
+		query = query.Where("items.user_id = ?", params.OwnerID)
+	}
+	if params.ViewerID != 0 {
+		query = query.Where("item_suggestions.user_id = ? OR items.user_id = ?", params.ViewerID, params.ViewerID)
+	}
+	if params.Status != "" {
+		query = query.Where("item_suggestions.status = ?", params.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count suggestions: %w", err)
+	}
+
+	var suggestions []models.ItemSuggestion
+	if err := query.Select("item_suggestions.*").
+		Order("item_suggestions.id DESC").
+		Offset((params.Page - 1) * params.PerPage).
+		Limit(params.PerPage).
+		Find(&suggestions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list suggestions: %w", err)
+	}
+
+	entries, err := qb.buildSuggestionEntries(suggestions)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPages := int(total) / params.PerPage
+	if int(total)%params.PerPage > 0 {
+		totalPages++
+	}
+
+	return &SuggestionListResult{
+		Suggestions: entries,
+		Total:       total,
+		Page:        params.Page,
+		PerPage:     params.PerPage,
+		TotalPages:  totalPages,
+	}, nil
+}
+
+// GetSuggestion returns a suggestion with its comments. Only the submitter, the
+// item owner and admins may see it.
+func (qb *EAVQueryBuilder) GetSuggestion(schemaName string, suggestionID uint, userID uint, isAdmin bool) (*SuggestionEntry, error) {
+	suggestion, item, err := qb.loadSuggestion(utils.DB, schemaName, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+	if !canSeeSuggestion(suggestion, item, userID, isAdmin) {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	entries, err := qb.buildSuggestionEntries([]models.ItemSuggestion{*suggestion})
+	if err != nil {
+		return nil, err
+	}
+	entry := &entries[0]
+
+	var comments []models.ItemSuggestionComment
+	if err := utils.DB.Where("suggestion_id = ?", suggestion.ID).Order("id ASC").Find(&comments).Error; err != nil {
+		return nil, fmt.Errorf("failed to load comments: %w", err)
+	}
+	userIDs := make([]int, len(comments))
+	for i, comment := range comments {
+		userIDs[i] = comment.UserID
+	}
+	names := displayNamesByUser(userIDs)
+
+	entry.Comments = make([]SuggestionComment, len(comments))
+	for i, comment := range comments {
+		entry.Comments[i] = SuggestionComment{
+			ID:              comment.ID,
+			UserID:          comment.UserID,
+			UserDisplayName: names[comment.UserID],
+			Body:            comment.Body,
+			CreatedAt:       comment.CreatedAt,
+		}
+	}
+
+	return entry, nil
+}
+
+// AcceptSuggestion applies a pending suggestion as a regular update of the item,
+// credited to the submitter in the item history, and closes it. The reviewer's
+// rights are checked first. A suggestion made on an older version of the item is
+// applied on top of the current one, unless a field it changes was edited since,
+// which is refused with a version conflict so the later edit is not overwritten.
+// When the resulting item is invalid, the validation result is returned instead.
+func (qb *EAVQueryBuilder) AcceptSuggestion(validator *ValidationEngine, schemaName string, suggestionID uint, reviewerID uint, isAdmin bool) (*models.Item, *ValidationResult, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var item *models.Item
+	var validation *ValidationResult
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		suggestion, current, err := qb.reviewableSuggestion(tx, schemaName, suggestionID, reviewerID, isAdmin)
+		if err != nil {
+			return err
+		}
+
+		changes := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(suggestion.Changes), &changes); err != nil {
+			return fmt.Errorf("failed to read suggestion changes: %w", err)
+		}
+
+		values, err := loadFieldValuesMap(tx, current.ID, cached.Fields)
+		if err != nil {
+			return err
+		}
+		if current.Version != suggestion.BaseVersion {
+			conflict, err := suggestionConflicts(suggestion, values, changes)
+			if err != nil {
+				return err
+			}
+			if conflict {
+				return fmt.Errorf("version conflict")
+			}
+		}
+
+		state, err := qb.applySuggestedChanges(schemaName, values, changes)
+		if err != nil {
+			return err
+		}
+		if result := validator.ValidateCreate(schemaName, state); !result.Valid {
+			validation = result
+			return nil
+		}
+
+		expected := current.Version
+		item, err = qb.updateItem(tx, cached, suggestion.ItemID, uint(suggestion.UserID), changes, UpdateOptions{IsAdmin: true, ExpectedVersion: &expected})
+		if err != nil {
+			return err
+		}
+
+		return closeSuggestion(tx, suggestion, models.SuggestionStatusAccepted, reviewerID)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return item, validation, nil
+}
+
+// suggestionConflicts tells whether a field the suggestion changes was edited
+// since it was made, to a value other than the suggested one. Suggestions saved
+// without their base values conflict with any later version.
+func suggestionConflicts(suggestion *models.ItemSuggestion, current map[string]interface{}, changes map[string]interface{}) (bool, error) {
+	if suggestion.BaseValues == "" {
+		return true, nil
+	}
+	base := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(suggestion.BaseValues), &base); err != nil {
+		return false, fmt.Errorf("failed to read suggestion base values: %w", err)
+	}
+	for key, to := range changes {
+		now := current[key]
+		if reflect.DeepEqual(now, base[key]) || reflect.DeepEqual(now, to) {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// RejectSuggestion closes a pending suggestion without applying it. A reason,
+// when given, is added as a comment.
+func (qb *EAVQueryBuilder) RejectSuggestion(schemaName string, suggestionID uint, reviewerID uint, isAdmin bool, reason string) error {
+	return utils.DB.Transaction(func(tx *gorm.DB) error {
+		suggestion, _, err := qb.reviewableSuggestion(tx, schemaName, suggestionID, reviewerID, isAdmin)
+		if err != nil {
+			return err
+		}
+
+		if reason = strings.TrimSpace(reason); reason != "" {
+			comment := models.ItemSuggestionComment{SuggestionID: suggestion.ID, UserID: int(reviewerID), Body: reason}
+			if err := tx.Create(&comment).Error; err != nil {
+				return fmt.Errorf("failed to save comment: %w", err)
+			}
+		}
+
+		return closeSuggestion(tx, suggestion, models.SuggestionStatusRejected, reviewerID)
+	})
+}
+
+// CommentOnSuggestion adds a comment to a suggestion's discussion. The submitter,
+// the item owner and admins may comment.
+func (qb *EAVQueryBuilder) CommentOnSuggestion(schemaName string, suggestionID uint, userID uint, isAdmin bool, body string) (*SuggestionComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, fmt.Errorf("comment body is required")
+	}
+
+	suggestion, item, err := qb.loadSuggestion(utils.DB, schemaName, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+	if !canSeeSuggestion(suggestion, item, userID, isAdmin) {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	comment := models.ItemSuggestionComment{SuggestionID: suggestion.ID, UserID: int(userID), Body: body}
+	if err := utils.DB.Create(&comment).Error; err != nil {
+		return nil, fmt.Errorf("failed to save comment: %w", err)
+	}
+
+	return &SuggestionComment{
+		ID:              comment.ID,
+		UserID:          comment.UserID,
+		UserDisplayName: displayNamesByUser([]int{comment.UserID})[comment.UserID],
+		Body:            comment.Body,
+		CreatedAt:       comment.CreatedAt,
+	}, nil
+}
+
+func (qb *EAVQueryBuilder) loadSuggestion(tx *gorm.DB, schemaName string, suggestionID uint) (*models.ItemSuggestion, *models.Item, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var suggestion models.ItemSuggestion
+	if err := tx.Where("id = ? AND schema_id = ?", suggestionID, cached.Schema.ID).First(&suggestion).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, fmt.Errorf("suggestion not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get suggestion: %w", err)
+	}
+
+	var item models.Item
+	if err := tx.Where("id = ?", suggestion.ItemID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, fmt.Errorf("suggestion not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	return &suggestion, &item, nil
+}
+
+// reviewableSuggestion loads a suggestion the reviewer may accept or reject, and
+// its item
+func (qb *EAVQueryBuilder) reviewableSuggestion(tx *gorm.DB, schemaName string, suggestionID uint, reviewerID uint, isAdmin bool) (*models.ItemSuggestion, *models.Item, error) {
+	suggestion, item, err := qb.loadSuggestion(tx, schemaName, suggestionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isAdmin && uint(item.UserID) != reviewerID {
+		return nil, nil, fmt.Errorf("unauthorized")
+	}
+	if suggestion.Status != models.SuggestionStatusPending {
+		return nil, nil, fmt.Errorf("suggestion is already %s", suggestion.Status)
+	}
+	return suggestion, item, nil
+}
+
+func closeSuggestion(tx *gorm.DB, suggestion *models.ItemSuggestion, status models.SuggestionStatus, reviewerID uint) error {
+	now := time.Now()
+	reviewer := int(reviewerID)
+	result := tx.Model(suggestion).
+		Where("status = ?", models.SuggestionStatusPending).
+		Updates(map[string]interface{}{"status": status, "reviewer_id": reviewer, "reviewed_at": now})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update suggestion: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("suggestion is no longer pending")
+	}
+
+	suggestion.Status = status
+	suggestion.ReviewerID = &reviewer
+	suggestion.ReviewedAt = &now
+	return nil
+}
+
+func canSeeSuggestion(suggestion *models.ItemSuggestion, item *models.Item, userID uint, isAdmin bool) bool {
+	return isAdmin || uint(suggestion.UserID) == userID || uint(item.UserID) == userID
+}
+
+// buildSuggestionEntries resolves submitter names, item names and the current
+// value of each suggested field in a few batched queries
+func (qb *EAVQueryBuilder) buildSuggestionEntries(suggestions []models.ItemSuggestion) ([]SuggestionEntry, error) {
+	entries := make([]SuggestionEntry, len(suggestions))
+	if len(suggestions) == 0 {
+		return entries, nil
+	}
+
+	userIDs := make([]int, len(suggestions))
+	itemIDs := make([]uint, len(suggestions))
+	for i, suggestion := range suggestions {
+		userIDs[i] = suggestion.UserID
+		itemIDs[i] = suggestion.ItemID
+	}
+	names := displayNamesByUser(userIDs)
+
+	var items []models.Item
+	if err := utils.DB.Unscoped().Preload("FieldValuesRows").Where("id IN ?", itemIDs).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to load items: %w", err)
+	}
+	itemsByID := make(map[uint]models.Item, len(items))
+	for _, item := range items {
+		itemsByID[item.ID] = item
+	}
+
+	schemas := make(map[uint]*CachedSchema)
+	for _, cached := range qb.registry.GetAllSchemas() {
+		schemas[cached.Schema.ID] = cached
+	}
+
+	for i, suggestion := range suggestions {
+		proposed := map[string]interface{}{}
+		json.Unmarshal([]byte(suggestion.Changes), &proposed)
+
+		current := map[string]interface{}{}
+		item := itemsByID[suggestion.ItemID]
+		cached := schemas[suggestion.SchemaID]
+		schemaType := ""
+		if cached != nil {
+			current = buildFieldValuesMap(item.FieldValuesRows, cached.Fields)
+			schemaType = cached.Schema.Name
+		}
+
+		changes := make(map[string]FieldChange, len(proposed))
+		for key, value := range proposed {
+			changes[key] = FieldChange{From: current[key], To: value}
+		}
+
+		entries[i] = SuggestionEntry{
+			ID:              suggestion.ID,
+			ItemID:          suggestion.ItemID,
+			ItemName:        item.Name,
+			SchemaType:      schemaType,
+			UserID:          suggestion.UserID,
+			UserDisplayName: names[suggestion.UserID],
+			Changes:         changes,
+			Message:         suggestion.Message,
+			BaseVersion:     suggestion.BaseVersion,
+			Status:          suggestion.Status,
+			ReviewerID:      suggestion.ReviewerID,
+			ReviewedAt:      suggestion.ReviewedAt,
+			CreatedAt:       suggestion.CreatedAt,
+		}
+	}
+
+	return entries, nil
+}
+
+func displayNamesByUser(userIDs []int) map[int]string {
+	names := make(map[int]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return names
+	}
+
+	var users []models.User
+	utils.DB.Unscoped().Select("id, display_name").Where("id IN ?", userIDs).Find(&users)
+	for _, user := range users {
+		names[int(user.ID)] = user.DisplayName
+	}
+	return names
+}
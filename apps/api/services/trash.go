@@ -0,0 +1,349 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/davidcharbonnier/alacarte-api/models"
+	"github.com/davidcharbonnier/alacarte-api/utils"
+	"gorm.io/gorm"
+)
+
+// TrashParams selects trashed items. An empty SchemaName lists every schema and
+// a zero OwnerID every owner.
+type TrashParams struct {
+	SchemaName string
+	OwnerID    uint
+	Page       int
+	PerPage    int
+}
+
+type TrashResult struct {
+	Items      []map[string]interface{}
+	Total      int64
+	Page       int
+	PerPage    int
+	TotalPages int
+}
+
+// PurgeResult reports a permanent deletion. ImageURLs lists the images of the
+// purged items, which the caller removes from storage once the purge committed.
+type PurgeResult struct {
+	Purged    int
+	ImageURLs []string
+}
+
+// purgeBatchSize bounds how many items a retention purge removes per transaction
+const purgeBatchSize = 100
+
+// ListTrash returns soft-deleted items, most recently deleted first. Each item
+// carries when it was deleted and by whom.
+func (qb *EAVQueryBuilder) ListTrash(params TrashParams) (*TrashResult, error) {
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	if params.PerPage < 1 {
+		params.PerPage = 20
+	}
+	if params.PerPage > 100 {
+		params.PerPage = 100
+	}
+
+	schemas := make(map[uint]*CachedSchema)
+	query := utils.DB.Unscoped().Model(&models.Item{}).Where("deleted_at IS NOT NULL")
+
+	if params.SchemaName != "" {
+		cached, err := qb.getCachedSchema(params.SchemaName)
+		if err != nil {
+			return nil, err
+		}
+		schemas[cached.Schema.ID] = cached
+		query = query.Where("schema_id = ?", cached.Schema.ID)
+	} else {
+		for _, cached := range qb.registry.GetAllSchemas() {
+			schemas[cached.Schema.ID] = cached
+		}
+	}
+
+	if params.OwnerID != 0 {
+		query = query.Where("user_id = ?", params.OwnerID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count trashed items: %w", err)
+	}
+
+	var items []models.Item
+	if err := query.Order("deleted_at DESC, id DESC").
+		Offset((params.Page - 1) * params.PerPage).
+		Limit(params.PerPage).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list trashed items: %w", err)
+	}
+
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	deletedBy, err := deletersByItem(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	resultItems := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		cached, ok := schemas[item.SchemaID]
+		if !ok {
+			continue
+		}
+		entry := qb.buildItemMap(&item, cached)
+		entry["deleted_at"] = item.DeletedAt.Time
+		if userID, ok := deletedBy[item.ID]; ok {
+			entry["deleted_by"] = userID
+		}
+		resultItems = append(resultItems, entry)
+	}
+
+	totalPages := int(total) / params.PerPage
+	if int(total)%params.PerPage > 0 {
+		totalPages++
+	}
+
+	return &TrashResult{
+		Items:      resultItems,
+		Total:      total,
+		Page:       params.Page,
+		PerPage:    params.PerPage,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// deletersByItem reads who deleted each item from its latest delete revision
+func deletersByItem(ids []uint) (map[uint]int, error) {
+	result := make(map[uint]int, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var revisions []models.ItemRevision
+	if err := utils.DB.Select("item_id, user_id").
+		Where("item_id IN ? AND action = ?", ids, models.RevisionActionDelete).
+		Order("id ASC").
+		Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load deletions: %w", err)
+	}
+	for _, revision := range revisions {
+		result[revision.ItemID] = revision.UserID
+	}
+	return result, nil
+}
+
+// RestoreItem brings a trashed item back along with the field values and ratings
+// deleted with it. Uniqueness is checked again, against live items only, since
+// another item may have taken the name in the meantime.
+func (qb *EAVQueryBuilder) RestoreItem(schemaName string, itemID uint, userID uint, isAdmin bool) (*models.Item, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := utils.DB.Begin()
+
+	item, err := qb.restoreItem(tx, cached, itemID, userID, isAdmin)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return item, nil
+}
+
+func (qb *EAVQueryBuilder) restoreItem(tx *gorm.DB, cached *CachedSchema, itemID uint, userID uint, isAdmin bool) (*models.Item, error) {
+	item, err := findTrashedItem(tx, cached, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := CanEdit(tx, item, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	deletedAt := item.DeletedAt.Time
+
+	var rows []models.ItemFieldValue
+	if err := tx.Unscoped().Where("item_id = ? AND deleted_at = ?", item.ID, deletedAt).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read field values: %w", err)
+	}
+	state := buildFieldValuesMap(rows, cached.Fields)
+
+	uniqueFields := make(map[string]interface{}, len(state)+1)
+	for key, value := range state {
+		uniqueFields[key] = value
+	}
+	uniqueFields["name"] = item.Name
+
+	unique, err := qb.checkUniqueness(tx, cached, uniqueFields, &item.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !unique {
+		return nil, fmt.Errorf("duplicate item")
+	}
+
+	if err := tx.Unscoped().Model(&models.ItemFieldValue{}).
+		Where("item_id = ? AND deleted_at = ?", item.ID, deletedAt).
+		Update("deleted_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("failed to restore field values: %w", err)
+	}
+
+	if err := tx.Unscoped().Model(&models.Rating{}).
+		Where("item_id = ? AND deleted_at = ?", item.ID, deletedAt).
+		Update("deleted_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("failed to restore ratings: %w", err)
+	}
+
+	// A merged duplicate stops redirecting once it is back
+	if err := tx.Unscoped().Where("from_item_id = ?", item.ID).Delete(&models.ItemRedirect{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove redirect: %w", err)
+	}
+
+	item.Version++
+	if err := tx.Unscoped().Model(item).Updates(map[string]interface{}{
+		"deleted_at": nil,
+		"version":    item.Version,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to restore item: %w", err)
+	}
+	item.DeletedAt = gorm.DeletedAt{}
+
+	if err := recordRevision(tx, cached, item, userID, models.RevisionActionRestore, nil, state); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// PurgeItem permanently deletes a trashed item with its field values, ratings,
+// shares, editors, history and the redirects pointing to it
+func (qb *EAVQueryBuilder) PurgeItem(schemaName string, itemID uint) (*PurgeResult, error) {
+	cached, err := qb.getCachedSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *PurgeResult
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		item, err := findTrashedItem(tx, cached, itemID)
+		if err != nil {
+			return err
+		}
+		result, err = purgeItems(tx, []models.Item{*item})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PurgeTrashedItems permanently deletes every item trashed before cutoff, in
+// batches so a large backlog does not hold one long transaction
+func PurgeTrashedItems(cutoff time.Time) (*PurgeResult, error) {
+	total := &PurgeResult{ImageURLs: []string{}}
+
+	for {
+		var items []models.Item
+		if err := utils.DB.Unscoped().
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Order("id ASC").
+			Limit(purgeBatchSize).
+			Find(&items).Error; err != nil {
+			return total, fmt.Errorf("failed to list expired items: %w", err)
+		}
+		if len(items) == 0 {
+			return total, nil
+		}
+
+		var batch *PurgeResult
+		if err := utils.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			batch, err = purgeItems(tx, items)
+			return err
+		}); err != nil {
+			return total, err
+		}
+
+		total.Purged += batch.Purged
+		total.ImageURLs = append(total.ImageURLs, batch.ImageURLs...)
+
+		if len(items) < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func findTrashedItem(tx *gorm.DB, cached *CachedSchema, itemID uint) (*models.Item, error) {
+	var item models.Item
+	if err := tx.Unscoped().
+		Where("id = ? AND schema_id = ? AND deleted_at IS NOT NULL", itemID, cached.Schema.ID).
+		First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("item not found in trash")
+		}
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+	return &item, nil
+}
+
+// purgeItems hard deletes items and everything attached to them, children first
+func purgeItems(tx *gorm.DB, items []models.Item) (*PurgeResult, error) {
+	result := &PurgeResult{ImageURLs: []string{}}
+	if len(items) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+		if item.ImageURL != nil && *item.ImageURL != "" {
+			result.ImageURLs = append(result.ImageURLs, *item.ImageURL)
+		}
+	}
+
+	ratingIDs := tx.Unscoped().Model(&models.Rating{}).Select("id").Where("item_id IN ?", ids)
+	if err := tx.Exec("DELETE FROM rating_viewers WHERE rating_id IN (?)", ratingIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to purge rating shares: %w", err)
+	}
+	if err := tx.Unscoped().Where("item_id IN ?", ids).Delete(&models.Rating{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to purge ratings: %w", err)
+	}
+	if err := tx.Unscoped().Where("item_id IN ?", ids).Delete(&models.ItemFieldValue{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to purge field values: %w", err)
+	}
+	if err := tx.Where("item_id IN ?", ids).Delete(&models.ItemEditor{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to purge editors: %w", err)
+	}
+	if err := tx.Unscoped().Where("item_id IN ?", ids).Delete(&models.ItemRevision{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to purge revisions: %w", err)
+	}
+	if err := tx.Unscoped().Where("to_item_id IN ?", ids).Delete(&models.ItemRedirect{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to purge redirects: %w", err)
+	}
+	if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Item{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to purge items: %w", err)
+	}
+
+	result.Purged = len(items)
+	return result, nil
+}
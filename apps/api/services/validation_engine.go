@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -326,3 +327,77 @@ func (e *ValidationEngine) findField(fields []*models.ItemTypeField, key string)
 	}
 	return nil, false
 }
+
+// ValidateRating checks a rating of a schema's item: its overall grade on the
+// schema's rating scale, and its scores on the schema's criteria and their
+// scales. A grade is required unless scores give the overall.
+func (e *ValidationEngine) ValidateRating(schemaName string, grade *float64, scores map[string]float64) *ValidationResult {
+	result := &ValidationResult{Valid: true, Errors: []ValidationError{}}
+
+	cached, ok := e.registry.GetSchema(schemaName)
+	if !ok {
+		result.Valid = false
+		result.Errors = append(result.Errors, ValidationError{
+			Code:    "unknown_schema",
+			Message: fmt.Sprintf("Schema '%s' not found", schemaName),
+		})
+		return result
+	}
+
+	scale := cached.RatingScale()
+	if grade != nil {
+		if err := e.validateRatingValue("grade", "Grade", *grade, scale); err != nil {
+			result.Errors = append(result.Errors, *err)
+		}
+	} else if _, ok := OverallGrade(cached, scores); !ok {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "grade",
+			Label:   "Grade",
+			Code:    "required",
+			Message: "Grade is required",
+		})
+	}
+
+	criteria := make(map[string]RatingCriterion)
+	for _, criterion := range cached.RatingCriteria() {
+		criteria[criterion.Key] = criterion
+	}
+	keys := make([]string, 0, len(scores))
+	for key := range scores {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		criterion, exists := criteria[key]
+		if !exists {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   "scores." + key,
+				Code:    "unknown_criterion",
+				Message: fmt.Sprintf("'%s' is not a rating criterion of %s", key, cached.Schema.DisplayName),
+			})
+			continue
+		}
+		if err := e.validateRatingValue("scores."+key, criterion.Label, scores[key], criterion.ScaleOf(scale)); err != nil {
+			result.Errors = append(result.Errors, *err)
+		}
+	}
+
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+func (e *ValidationEngine) validateRatingValue(field, label string, value float64, scale RatingScale) *ValidationError {
+	details := map[string]interface{}{"min": scale.Min, "max": scale.Max, "step": scale.Step, "actual": value}
+	switch {
+	case value < scale.Min-ratingScaleEpsilon:
+		return &ValidationError{Field: field, Label: label, Code: "min_value", Details: details,
+			Message: fmt.Sprintf("%s must be at least %g", label, scale.Min)}
+	case value > scale.Max+ratingScaleEpsilon:
+		return &ValidationError{Field: field, Label: label, Code: "max_value", Details: details,
+			Message: fmt.Sprintf("%s must be at most %g", label, scale.Max)}
+	case scale.Check(value) != nil:
+		return &ValidationError{Field: field, Label: label, Code: "invalid_step", Details: details,
+			Message: fmt.Sprintf("%s must be in steps of %g from %g", label, scale.Step, scale.Min)}
+	}
+	return nil
+}
@@ -73,15 +73,53 @@ func RunMigrations() {
 	err := DB.AutoMigrate(
 		&models.User{},
 		&models.Rating{},
+		&models.RatingScore{},
 		&models.ItemTypeSchema{},
 		&models.ItemTypeField{},
 		&models.SchemaVersion{},
 		&models.Item{},
 		&models.ItemFieldValue{},
+		&models.ItemRevision{},
+		&models.ItemRedirect{},
+		&models.ItemSuggestion{},
+		&models.ItemSuggestionComment{},
+		&models.ItemEditor{},
+		&models.ItemTransfer{},
+		&models.Job{},
 	)
 	if err != nil {
 		log.Fatal("Database migration failed:", err)
 	}
 
+	if err := restrictItemOwnerDeletes(); err != nil {
+		log.Fatal("Database migration failed:", err)
+	}
+
 	log.Println("Database migrations completed successfully")
 }
+
+// restrictItemOwnerDeletes replaces the former ON DELETE CASCADE of fk_items_user,
+// which removed a user's catalog items, and everyone's ratings on them, along with
+// the account. AutoMigrate does not update existing constraints.
+func restrictItemOwnerDeletes() error {
+	var deleteRule string
+	if err := DB.Raw(`
+		SELECT DELETE_RULE FROM information_schema.REFERENTIAL_CONSTRAINTS
+		WHERE CONSTRAINT_SCHEMA = DATABASE() AND CONSTRAINT_NAME = 'fk_items_user'
+	`).Scan(&deleteRule).Error; err != nil {
+		return fmt.Errorf("failed to read fk_items_user: %w", err)
+	}
+	if deleteRule != "CASCADE" {
+		return nil
+	}
+
+	if err := DB.Exec("ALTER TABLE items DROP FOREIGN KEY fk_items_user").Error; err != nil {
+		return fmt.Errorf("failed to drop fk_items_user: %w", err)
+	}
+	if err := DB.Migrator().CreateConstraint(&models.Item{}, "User"); err != nil {
+		return fmt.Errorf("failed to recreate fk_items_user: %w", err)
+	}
+
+	log.Println("Changed fk_items_user from ON DELETE CASCADE to RESTRICT")
+	return nil
+}
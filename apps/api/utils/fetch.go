@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultFetchMaxBytes and DefaultFetchTimeout bound what a seed source can
+	// cost the server
+	DefaultFetchMaxBytes = 10 << 20
+	DefaultFetchTimeout  = 30 * time.Second
+
+	fetchMaxRedirects = 5
+)
+
+// fetchContentTypes are the response types accepted for seed data. Raw file
+// hosts such as GitHub serve JSON as text/plain.
+var fetchContentTypes = []string{"application/json", "text/json", "text/plain"}
+
+// imageContentTypes are the response types accepted for seed images. Object
+// stores often serve files as octet-stream; the image content is checked when
+// it is processed.
+var imageContentTypes = []string{"image/jpeg", "image/png", "image/webp", "application/octet-stream"}
+
+// blockedNetworks are address ranges a fetch may never reach, on top of the
+// loopback, private, link-local and multicast ranges known to net.IP
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // "this" network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"64:ff9b::/96",  // NAT64, which can embed any IPv4 address
+)
+
+// URLFetcher reads seed data from a remote URL or a local file, within limits:
+//   - remote hosts must be on AllowedHosts, and are only reached on public
+//     addresses, checked after DNS resolution so a name cannot point inward
+//   - responses must be JSON or plain text, and are cut off at MaxBytes and
+//     Timeout
+//   - local files are only read from inside SeedDir
+type URLFetcher struct {
+	// AllowedHosts lists the hosts remote data can come from. An entry starting
+	// with a dot, or "*.", also matches its subdomains. When empty, remote
+	// fetching is disabled.
+	AllowedHosts []string
+	// SeedDir is the directory local files can be read from. When empty, local
+	// files cannot be read.
+	SeedDir  string
+	MaxBytes int64
+	Timeout  time.Duration
+	// ContentTypes lists the accepted response media types; JSON and plain text
+	// when empty
+	ContentTypes []string
+
+	// checkIP vets each address before it is dialed; tests swap it to reach
+	// their loopback server
+	checkIP func(ip net.IP) error
+}
+
+// NewURLFetcher returns a fetcher configured from the environment:
+// SEED_ALLOWED_HOSTS, a comma-separated host allowlist, and SEED_DATA_DIR, the
+// directory local seed files can be read from
+func NewURLFetcher() *URLFetcher {
+	var hosts []string
+	for _, host := range strings.Split(os.Getenv("SEED_ALLOWED_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return &URLFetcher{
+		AllowedHosts: hosts,
+		SeedDir:      os.Getenv("SEED_DATA_DIR"),
+		MaxBytes:     DefaultFetchMaxBytes,
+		Timeout:      DefaultFetchTimeout,
+	}
+}
+
+// FetchURLData fetches data from a URL or local file path, within the limits
+// configured by NewURLFetcher
+// This is a generic utility that can be used by any controller
+func FetchURLData(source string) ([]byte, error) {
+	return NewURLFetcher().Fetch(source)
+}
+
+// FetchImageData fetches an image from a URL or local file path, within the
+// limits configured by NewURLFetcher and the maximum image size
+func FetchImageData(source string) ([]byte, error) {
+	fetcher := NewURLFetcher()
+	fetcher.MaxBytes = MaxImageSize
+	fetcher.ContentTypes = imageContentTypes
+	return fetcher.Fetch(source)
+}
+
+// Fetch reads source, an http(s) URL or a path relative to SeedDir
+func (f *URLFetcher) Fetch(source string) ([]byte, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return f.fetchRemote(source)
+	}
+	if strings.Contains(source, "://") {
+		return nil, fmt.Errorf("unsupported URL scheme; use http or https")
+	}
+	return f.readLocal(source)
+}
+
+func (f *URLFetcher) fetchRemote(source string) ([]byte, error) {
+	target, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := f.checkHost(target); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Fetching data from URL: %s", source)
+	resp, err := f.client().Get(target.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch remote data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+	if err := f.checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > f.maxBytes() {
+		return nil, fmt.Errorf("remote data is larger than %d bytes", f.maxBytes())
+	}
+
+	data, err := readLimited(resp.Body, f.maxBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return data, nil
+}
+
+func (f *URLFetcher) client() *http.Client {
+	checkIP := f.checkIP
+	if checkIP == nil {
+		checkIP = CheckPublicIP
+	}
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		// Control runs after DNS resolution, on the address actually dialed
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("unexpected address %s", address)
+			}
+			return checkIP(ip)
+		},
+	}
+	transport := &http.Transport{
+		// No proxy: it would be dialed instead of the target, bypassing the checks
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: f.timeout(),
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   f.timeout(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= fetchMaxRedirects {
+				return fmt.Errorf("too many redirects")
+			}
+			return f.checkHost(req.URL)
+		},
+	}
+}
+
+// checkHost refuses URLs whose host is not on the allowlist
+func (f *URLFetcher) checkHost(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme; use http or https")
+	}
+	if len(f.AllowedHosts) == 0 {
+		return fmt.Errorf("fetching remote data is disabled; set SEED_ALLOWED_HOSTS to allow hosts")
+	}
+	host := strings.ToLower(target.Hostname())
+	for _, allowed := range f.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimPrefix(allowed, "*"))
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host '%s' is not allowed", host)
+}
+
+// CheckPublicIP refuses addresses that are not publicly routable, such as
+// loopback, private networks and the link-local cloud metadata endpoint
+func CheckPublicIP(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("address %s is not public", ip)
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("address %s is not public", ip)
+		}
+	}
+	return nil
+}
+
+func (f *URLFetcher) checkContentType(contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("unsupported content type '%s'", contentType)
+	}
+	allowedTypes := f.ContentTypes
+	if len(allowedTypes) == 0 {
+		if strings.HasSuffix(mediaType, "+json") {
+			return nil
+		}
+		allowedTypes = fetchContentTypes
+	}
+	for _, allowed := range allowedTypes {
+		if mediaType == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported content type '%s'", mediaType)
+}
+
+// readLocal reads a file inside SeedDir. Symlinks are resolved first, so a link
+// cannot lead out of the directory.
+func (f *URLFetcher) readLocal(source string) ([]byte, error) {
+	if f.SeedDir == "" {
+		return nil, fmt.Errorf("reading local files is disabled; set SEED_DATA_DIR to allow a seed directory")
+	}
+	root, err := filepath.EvalSymlinks(f.SeedDir)
+	if err != nil {
+		return nil, fmt.Errorf("seed directory is not available: %w", err)
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return nil, fmt.Errorf("seed directory is not available: %w", err)
+	}
+
+	path := source
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("file is outside the seed directory")
+	}
+
+	log.Printf("Loading data from file: %s", resolved)
+	file, err := os.Open(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("failed to read file: not a regular file")
+	}
+
+	data, err := readLimited(file, f.maxBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
+// readLimited reads r to the end, failing once it goes past maxBytes
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("data is larger than %d bytes", maxBytes)
+	}
+	return data, nil
+}
+
+func (f *URLFetcher) maxBytes() int64 {
+	if f.MaxBytes > 0 {
+		return f.MaxBytes
+	}
+	return DefaultFetchMaxBytes
+}
+
+func (f *URLFetcher) timeout() time.Duration {
+	if f.Timeout > 0 {
+		return f.Timeout
+	}
+	return DefaultFetchTimeout
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
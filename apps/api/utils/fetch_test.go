@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFetcher allows the httptest server's host, which listens on loopback
+func testFetcher(t *testing.T, server *httptest.Server) *URLFetcher {
+	t.Helper()
+	target, _ := url.Parse(server.URL)
+	return &URLFetcher{
+		AllowedHosts: []string{target.Hostname()},
+		MaxBytes:     1024,
+		Timeout:      time.Second,
+		checkIP:      func(net.IP) error { return nil },
+	}
+}
+
+func TestURLFetcher_Remote(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cheeses.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`[{"name":"Comté"}]`))
+	})
+	mux.HandleFunc("/raw.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html></html>`))
+	})
+	mux.HandleFunc("/large.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.Repeat(" ", 2048)))
+	})
+	mux.HandleFunc("/streamed.json", func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before the end leaves out Content-Length
+		w.Header().Set("Content-Type", "application/json")
+		for i := 0; i < 4; i++ {
+			w.Write([]byte(strings.Repeat(" ", 512)))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/slow.json", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/missing.json", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/elsewhere.json", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://metadata.google.internal/computeMetadata/v1/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := testFetcher(t, server)
+
+	data, err := fetcher.Fetch(server.URL + "/cheeses.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != `[{"name":"Comté"}]` {
+		t.Errorf("unexpected data %q", data)
+	}
+	if _, err := fetcher.Fetch(server.URL + "/raw.json"); err != nil {
+		t.Errorf("expected plain text to be accepted, got %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/page.html", "unsupported content type 'text/html'"},
+		{"/large.json", "larger than 1024 bytes"},
+		{"/streamed.json", "larger than 1024 bytes"},
+		{"/slow.json", "failed to fetch remote data"},
+		{"/missing.json", "HTTP error: 404"},
+		{"/elsewhere.json", "host 'metadata.google.internal' is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := fetcher.Fetch(server.URL + tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestURLFetcher_BlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the server should not be reached")
+	}))
+	defer server.Close()
+
+	// The host is allowed, but resolves to loopback
+	fetcher := testFetcher(t, server)
+	fetcher.checkIP = nil
+	_, err := fetcher.Fetch(server.URL + "/cheeses.json")
+	if err == nil || !strings.Contains(err.Error(), "is not public") {
+		t.Errorf("expected the loopback address to be refused, got %v", err)
+	}
+
+	// A name is checked on the address it resolves to
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	fetcher.AllowedHosts = []string{"localhost"}
+	_, err = fetcher.Fetch("http://localhost" + port + "/cheeses.json")
+	if err == nil || !strings.Contains(err.Error(), "is not public") {
+		t.Errorf("expected localhost to be refused, got %v", err)
+	}
+}
+
+func TestURLFetcher_AllowedHosts(t *testing.T) {
+	fetcher := &URLFetcher{AllowedHosts: []string{"raw.githubusercontent.com", "*.example.com"}}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://raw.githubusercontent.com/data/cheeses.json", true},
+		{"https://RAW.githubusercontent.com/data/cheeses.json", true},
+		{"https://data.example.com/cheeses.json", true},
+		{"https://example.com/cheeses.json", false},
+		{"https://evil-example.com/cheeses.json", false},
+		{"https://raw.githubusercontent.com.evil.io/cheeses.json", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"ftp://raw.githubusercontent.com/cheeses.json", false},
+	}
+	for _, tt := range tests {
+		target, _ := url.Parse(tt.url)
+		if err := fetcher.checkHost(target); (err == nil) != tt.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", tt.url, tt.allowed, err)
+		}
+	}
+
+	disabled := &URLFetcher{}
+	if _, err := disabled.Fetch("https://raw.githubusercontent.com/cheeses.json"); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("expected remote fetching to be disabled without an allowlist, got %v", err)
+	}
+}
+
+func TestCheckPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+	for _, tt := range tests {
+		if err := CheckPublicIP(net.ParseIP(tt.ip)); (err == nil) != tt.public {
+			t.Errorf("%s: expected public=%v, got %v", tt.ip, tt.public, err)
+		}
+	}
+}
+
+func TestURLFetcher_Local(t *testing.T) {
+	base := t.TempDir()
+	seedDir := filepath.Join(base, "seeds")
+	os.MkdirAll(filepath.Join(seedDir, "cheese"), 0o755)
+	os.WriteFile(filepath.Join(seedDir, "cheese", "cheeses.json"), []byte(`[]`), 0o644)
+	os.WriteFile(filepath.Join(seedDir, "large.json"), []byte(strings.Repeat(" ", 2048)), 0o644)
+	os.WriteFile(filepath.Join(base, "secret.json"), []byte(`{"secret":true}`), 0o644)
+	os.Symlink(filepath.Join(base, "secret.json"), filepath.Join(seedDir, "link.json"))
+
+	fetcher := &URLFetcher{SeedDir: seedDir, MaxBytes: 1024}
+
+	for _, source := range []string{"cheese/cheeses.json", filepath.Join(seedDir, "cheese", "cheeses.json"), "cheese/../cheese/cheeses.json"} {
+		if data, err := fetcher.Fetch(source); err != nil || string(data) != `[]` {
+			t.Errorf("%s: expected the file to be read, got %q, %v", source, data, err)
+		}
+	}
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"../secret.json", "outside the seed directory"},
+		{filepath.Join(base, "secret.json"), "outside the seed directory"},
+		{"link.json", "outside the seed directory"},
+		{"/etc/passwd", "outside the seed directory"},
+		{"large.json", "larger than 1024 bytes"},
+		{"cheese", "not a regular file"},
+		{"missing.json", "failed to read file"},
+		{"file:///etc/passwd", "unsupported URL scheme"},
+	}
+	for _, tt := range tests {
+		_, err := fetcher.Fetch(tt.source)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.source, tt.expected, err)
+		}
+	}
+
+	disabled := &URLFetcher{}
+	if _, err := disabled.Fetch("/etc/passwd"); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("expected local files to be disabled without a seed directory, got %v", err)
+	}
+}
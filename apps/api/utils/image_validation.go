@@ -21,6 +21,9 @@ type ProcessedImage struct {
 	Extension   string
 }
 
+// MaxImageSize is the largest image accepted, before processing
+const MaxImageSize = 5 * 1024 * 1024 // 5MB
+
 // ValidateAndProcessImage performs complete validation and processing of an uploaded image
 func ValidateAndProcessImage(file multipart.File, header *multipart.FileHeader) (*ProcessedImage, error) {
 	// Step 1: Validate file extension
@@ -29,9 +32,8 @@ func ValidateAndProcessImage(file multipart.File, header *multipart.FileHeader)
 	}
 
 	// Step 2: Validate file size
-	const maxSize = 5 * 1024 * 1024 // 5MB
-	if header.Size > maxSize {
-		return nil, fmt.Errorf("file too large: %d bytes (max: %d bytes)", header.Size, maxSize)
+	if header.Size > MaxImageSize {
+		return nil, fmt.Errorf("file too large: %d bytes (max: %d bytes)", header.Size, MaxImageSize)
 	}
 
 	// Step 3: Validate content type (magic bytes)
@@ -67,6 +69,20 @@ func ValidateAndProcessImage(file multipart.File, header *multipart.FileHeader)
 	return result, nil
 }
 
+// ValidateAndProcessImageData validates and processes an image held in memory,
+// such as one fetched or decoded from seed data
+func ValidateAndProcessImageData(data []byte, filename string) (*ProcessedImage, error) {
+	header := &multipart.FileHeader{Filename: filename, Size: int64(len(data))}
+	return ValidateAndProcessImage(imageData{bytes.NewReader(data)}, header)
+}
+
+// imageData makes an in-memory image usable as a multipart.File
+type imageData struct {
+	*bytes.Reader
+}
+
+func (imageData) Close() error { return nil }
+
 func validateFileExtension(filename string) error {
 	allowedExtensions := map[string]bool{
 		".jpg":  true,
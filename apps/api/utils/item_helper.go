@@ -28,9 +28,22 @@ func GetDynamicItem(schemaName string, itemID uint) (*models.Item, error) {
 	return &item, nil
 }
 
-// SaveItem saves an item to the database
+// SaveItem saves an item to the database and bumps its version. The write only
+// applies if the stored version is still the one the item was read at.
 func SaveItem(item *models.Item) error {
-	return DB.Save(item).Error
+	readVersion := item.Version
+	item.Version = readVersion + 1
+
+	result := DB.Model(item).Where("version = ?", readVersion).Select("*").Updates(item)
+	if result.Error != nil {
+		item.Version = readVersion
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		item.Version = readVersion
+		return fmt.Errorf("version conflict")
+	}
+	return nil
 }
 
 // ValidateItemType checks if item type is supported via schema lookup
@@ -3,11 +3,7 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +11,7 @@ import (
 // SeedResult contains the results of a seeding operation
 type SeedResult struct {
 	Added   int
+	Updated int
 	Skipped int
 	Errors  []string
 }
@@ -54,42 +51,6 @@ func GetSeedData(c *gin.Context) ([]byte, error) {
 		return req.Data, nil
 	}
 
-	// Fall back to URL fetching
-	log.Printf("Fetching data from URL: %s", req.URL)
+	// Fall back to URL fetching, which logs remote fetches
 	return FetchURLData(req.URL)
 }
-
-// FetchURLData fetches data from a URL or local file path
-// This is a generic utility that can be used by any controller
-func FetchURLData(source string) ([]byte, error) {
-	var data []byte
-	var err error
-
-	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
-		// Remote URL
-		log.Printf("Fetching data from URL: %s", source)
-		resp, err := http.Get(source)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch remote data: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("HTTP error: %s", resp.Status)
-		}
-
-		data, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
-		}
-	} else {
-		// Local file path
-		log.Printf("Loading data from file: %s", source)
-		data, err = os.ReadFile(source)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read file: %w", err)
-		}
-	}
-
-	return data, nil
-}
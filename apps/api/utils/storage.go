@@ -142,3 +142,7 @@ func DeleteFromStorage(filename string) error {
 	return nil
 }
 
+// DeleteImageURLFromStorage deletes the stored file behind a public image URL
+func DeleteImageURLFromStorage(imageURL string) error {
+	return DeleteFromStorage(imageURL[strings.LastIndex(imageURL, "/")+1:])
+}